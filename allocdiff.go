@@ -0,0 +1,142 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/tklauser/gobench_exporter/bench"
+	"github.com/tklauser/gobench_exporter/escape"
+	"github.com/tklauser/gobench_exporter/regression"
+	"github.com/tklauser/gobench_exporter/runner"
+)
+
+// allocUnits are the units whose regressions are explained by the changes of the escape analysis
+// and inlining decisions of the compiler.
+var allocUnits = map[string]bool{"allocs/op": true, "B/op": true}
+
+// allocRegressions returns the benchmarks (without GOMAXPROCS suffix) whose allocs/op or B/op
+// regressed per package. The packages are looked up in sets.
+func allocRegressions(results []regression.Result, sets ...bench.Set) map[string][]string {
+	pkgs := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, r := range results {
+		if !r.Regression || !allocUnits[r.Unit] {
+			continue
+		}
+		pkg := ""
+		for _, bs := range sets {
+			if bb := bs[r.Name]; len(bb) > 0 {
+				pkg = bb[0].Pkg
+				break
+			}
+		}
+		name, _, _ := bench.ParseName(r.Name)
+		if pkg == "" || seen[pkg+"."+name] {
+			continue
+		}
+		seen[pkg+"."+name] = true
+		pkgs[pkg] = append(pkgs[pkg], name)
+	}
+	return pkgs
+}
+
+// compilerDecisions returns the escape analysis and inlining decisions of the compiler in the
+// package pkg of the target's repository checked out in dir, along with the functions reachable
+// from the given benchmarks.
+func compilerDecisions(ctx context.Context, rt runner.Target, dir, pkg string, benchmarks []string) ([]escape.Decision, map[string]bool, error) {
+	out, pkgDir, err := runner.CompilerDiagnostics(ctx, rt, dir, pkg)
+	if err != nil {
+		return nil, nil, err
+	}
+	ds, err := escape.Parse(bytes.NewReader(out), pkgDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := escape.LoadPackage(pkgDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.Annotate(ds)
+	reachable := make(map[string]bool)
+	for _, b := range benchmarks {
+		for fn := range p.Reachable(b) {
+			reachable[fn] = true
+		}
+	}
+	return ds, reachable, nil
+}
+
+// writeAllocDiffs writes the changes of the escape analysis and inlining decisions of the
+// compiler between the target's repository checked out at the git refs base and head (the
+// working tree if empty) to w, for the packages of benchmarks whose allocs/op or B/op regressed
+// according to results. Only decisions in functions reachable from the regressed benchmarks are
+// written. The packages of the benchmarks are looked up in sets.
+func writeAllocDiffs(ctx context.Context, w io.Writer, rt runner.Target, base, head string, results []regression.Result, sets ...bench.Set) error {
+	regressed := allocRegressions(results, sets...)
+	if len(regressed) == 0 {
+		return nil
+	}
+	baseDir, cleanup, err := runner.Worktree(ctx, rt.RepoPath, base)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	headDir := rt.RepoPath
+	if head != "" {
+		dir, cleanup, err := runner.Worktree(ctx, rt.RepoPath, head)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		headDir = dir
+	}
+
+	pkgs := make([]string, 0, len(regressed))
+	for pkg := range regressed {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	for _, pkg := range pkgs {
+		benchmarks := regressed[pkg]
+		sort.Strings(benchmarks)
+		fmt.Fprintf(w, "\nEscape analysis and inlining changes in %s %v:\n", pkg, benchmarks)
+		baseDecisions, baseReachable, err := compilerDecisions(ctx, rt, baseDir, pkg, benchmarks)
+		if err != nil {
+			fmt.Fprintf(w, "  failed to analyze base: %v\n", err)
+			continue
+		}
+		headDecisions, headReachable, err := compilerDecisions(ctx, rt, headDir, pkg, benchmarks)
+		if err != nil {
+			fmt.Fprintf(w, "  failed to analyze head: %v\n", err)
+			continue
+		}
+		changes := escape.Diff(baseDecisions, headDecisions, func(fn string) bool {
+			return baseReachable[fn] || headReachable[fn]
+		})
+		if len(changes) == 0 {
+			fmt.Fprintln(w, "  none in functions reachable from the benchmarks")
+			continue
+		}
+		if err := escape.WriteDiff(w, changes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -18,6 +18,8 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -35,14 +37,98 @@ const (
 
 // Benchmark is one run of a single benchmark. Based on x/tools/benchmark/parse.Benchmark.
 type Benchmark struct {
-	Name              string  // benchmark name
-	N                 int     // number of iterations
-	NsPerOp           float64 // nanoseconds per iteration
-	AllocedBytesPerOp uint64  // bytes allocated per iteration
-	AllocsPerOp       uint64  // allocs per iteration
-	MBPerS            float64 // MB processed per second
-	Measured          int     // which measurements were recorded
-	Ord               int     // ordinal position within a benchmark run
+	Name              string  `json:"name"`                    // benchmark name
+	N                 int     `json:"n"`                       // number of iterations
+	NsPerOp           float64 `json:"ns_per_op,omitempty"`     // nanoseconds per iteration
+	AllocedBytesPerOp uint64  `json:"b_per_op,omitempty"`      // bytes allocated per iteration
+	AllocsPerOp       uint64  `json:"allocs_per_op,omitempty"` // allocs per iteration
+	MBPerS            float64 `json:"mb_per_s,omitempty"`      // MB processed per second
+	Measured          int     `json:"measured"`                // which measurements were recorded
+	Ord               int     `json:"ord"`                     // ordinal position within a benchmark run
+	Pkg               string  `json:"pkg,omitempty"`           // import path of the benchmarked package, if known
+
+	// Config holds the configuration lines (e.g. "goos: linux") preceding the benchmark in
+	// the output. The map is shared between benchmarks and must not be modified.
+	Config map[string]string `json:"config,omitempty"`
+
+	// Extra holds additional measurements reported using testing.B.ReportMetric, keyed by
+	// unit (e.g. "pkts/s").
+	Extra map[string]float64 `json:"extra,omitempty"`
+}
+
+// StandardUnits lists the units with a dedicated field in Benchmark, in the order they are
+// printed by the testing package.
+var StandardUnits = []string{"ns/op", "MB/s", "B/op", "allocs/op"}
+
+// Value returns the measurement of b in the given unit, if recorded.
+func (b *Benchmark) Value(unit string) (float64, bool) {
+	switch unit {
+	case "ns/op":
+		return b.NsPerOp, b.Measured&NsPerOp != 0
+	case "MB/s":
+		return b.MBPerS, b.Measured&MBPerS != 0
+	case "B/op":
+		return float64(b.AllocedBytesPerOp), b.Measured&AllocedBytesPerOp != 0
+	case "allocs/op":
+		return float64(b.AllocsPerOp), b.Measured&AllocsPerOp != 0
+	}
+	v, ok := b.Extra[unit]
+	return v, ok
+}
+
+// Units returns the units of all measurements recorded in b. Standard units come first, followed
+// by additional units in lexical order.
+func (b *Benchmark) Units() []string {
+	var units []string
+	for _, u := range StandardUnits {
+		if _, ok := b.Value(u); ok {
+			units = append(units, u)
+		}
+	}
+	extra := make([]string, 0, len(b.Extra))
+	for u := range b.Extra {
+		extra = append(extra, u)
+	}
+	sort.Strings(extra)
+	return append(units, extra...)
+}
+
+// String formats b in the Go benchmark output format.
+func (b *Benchmark) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %d", b.Name, b.N)
+	for _, u := range b.Units() {
+		v, _ := b.Value(u)
+		fmt.Fprintf(&sb, " %s %s", strconv.FormatFloat(v, 'f', -1, 64), u)
+	}
+	return sb.String()
+}
+
+// isStandardUnit reports whether unit is one of the units with a dedicated field in Benchmark.
+func isStandardUnit(unit string) bool {
+	switch unit {
+	case "ns/op", "MB/s", "B/op", "allocs/op":
+		return true
+	}
+	return false
+}
+
+// parseExtra records all non-standard measurement pairs in fields[start:] in b.Extra.
+func parseExtra(b *Benchmark, fields []string, start int) {
+	for i := start; i+1 < len(fields); i += 2 {
+		quant, unit := fields[i], fields[i+1]
+		if isStandardUnit(unit) {
+			continue
+		}
+		f, err := strconv.ParseFloat(quant, 64)
+		if err != nil {
+			continue
+		}
+		if b.Extra == nil {
+			b.Extra = make(map[string]float64)
+		}
+		b.Extra[unit] = f
+	}
 }
 
 // parseGoCheckLine extracts a parse.Benchmark from a single line of benchmark output as emitted by
@@ -111,7 +197,7 @@ func ParseLine(line string) (*Benchmark, error) {
 		if err != nil {
 			return nil, err
 		}
-		return &Benchmark{
+		bb := &Benchmark{
 			Name:              b.Name,
 			N:                 b.N,
 			NsPerOp:           b.NsPerOp,
@@ -120,7 +206,10 @@ func ParseLine(line string) (*Benchmark, error) {
 			MBPerS:            b.MBPerS,
 			Measured:          b.Measured,
 			Ord:               b.Ord,
-		}, err
+		}
+		// Skip benchmark name and iterations.
+		parseExtra(bb, strings.Fields(line), 2)
+		return bb, nil
 	} else if strings.HasPrefix(line, "PASS:") && strings.Contains(line, "Benchmark") {
 		return parseGoCheckLine(line)
 	}
@@ -132,18 +221,75 @@ func ParseLine(line string) (*Benchmark, error) {
 // Based on x/tools/benchmark/parse.Set.
 type Set map[string][]*Benchmark
 
+// configKeyRegexp matches the keys of configuration lines accepted by parseConfigLine.
+var configKeyRegexp = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// parseConfigLine extracts a key-value pair from a configuration line of the form "key: value" as
+// defined by the Go benchmark data format. Keys are restricted to lower-case letters, digits,
+// underscores and dashes, which excludes e.g. "foo_test.go: 12: message" logged by a benchmark.
+func parseConfigLine(line string) (key, value string, ok bool) {
+	line = strings.TrimSpace(line)
+	i := strings.Index(line, ":")
+	if i <= 0 || !configKeyRegexp.MatchString(line[:i]) {
+		return "", "", false
+	}
+	return line[:i], strings.TrimSpace(line[i+1:]), true
+}
+
+// parseSummaryLine extracts the package import path from the "ok  <path> <duration>" summary
+// printed by go test after a package's tests completed.
+func parseSummaryLine(line string) (pkg string, ok bool) {
+	fields := strings.Fields(line)
+	if len(fields) >= 2 && (fields[0] == "ok" || fields[0] == "FAIL") {
+		return fields[1], true
+	}
+	return "", false
+}
+
 // ParseSet extracts a Set from testing.B or check.C benchmark output.
 // ParseSet preserves the order of benchmarks that have identical
-// names.
+// names. If the output contains "pkg:" configuration lines or package summaries (as printed by go
+// test), the package of each benchmark is recorded in Benchmark.Pkg.
 func ParseSet(r io.Reader) (Set, error) {
 	bb := make(Set)
 	scan := bufio.NewScanner(r)
 	ord := 0
+	pkg := ""
+	var config map[string]string
+	// benchmarks parsed since the last package summary without a "pkg:" configuration line
+	var pending []*Benchmark
 	for scan.Scan() {
-		if b, err := ParseLine(scan.Text()); err == nil {
+		line := scan.Text()
+		if b, err := ParseLine(line); err == nil {
 			b.Ord = ord
+			b.Pkg = pkg
+			b.Config = config
 			ord++
 			bb[b.Name] = append(bb[b.Name], b)
+			if pkg == "" {
+				pending = append(pending, b)
+			}
+		} else if p, ok := parseSummaryLine(line); ok {
+			// gocheck benchmarks are not preceded by a header, attribute them to the
+			// package in the summary.
+			for _, b := range pending {
+				b.Pkg = p
+			}
+			pending = pending[:0]
+			// The configuration lines are printed per package.
+			pkg = ""
+			config = nil
+		} else if key, value, ok := parseConfigLine(line); ok {
+			// Copy on write, as the map is shared by the benchmarks parsed so far.
+			c := make(map[string]string, len(config)+1)
+			for k, v := range config {
+				c[k] = v
+			}
+			c[key] = value
+			config = c
+			if key == "pkg" {
+				pkg = value
+			}
 		}
 	}
 
@@ -153,3 +299,28 @@ func ParseSet(r io.Reader) (Set, error) {
 
 	return bb, nil
 }
+
+// ParseSetPackage is like ParseSet, but attributes benchmarks to the package with import path pkg
+// unless the output names another package. This is used for the output of test binaries, which
+// do not print package summaries.
+func ParseSetPackage(r io.Reader, pkg string) (Set, error) {
+	bb, err := ParseSet(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, bs := range bb {
+		for _, b := range bs {
+			if b.Pkg == "" {
+				b.Pkg = pkg
+			}
+		}
+	}
+	return bb, nil
+}
+
+// Add adds all benchmarks in o to s, appending to the benchmarks with identical names.
+func (s Set) Add(o Set) {
+	for name, bb := range o {
+		s[name] = append(s[name], bb...)
+	}
+}
@@ -17,6 +17,7 @@ package bench_test
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/tklauser/gobench_exporter/bench"
@@ -60,6 +61,20 @@ func TestParseLine(t *testing.T) {
 				Measured:          bench.NsPerOp | bench.MBPerS | bench.AllocedBytesPerOp | bench.AllocsPerOp,
 			},
 		},
+		{
+			line: "BenchmarkDecode-8   	   10000	    102345 ns/op	  1.52 ms/frame	 42.00 pkts/s	      64 B/op",
+			want: &bench.Benchmark{
+				Name:              "BenchmarkDecode-8",
+				N:                 10000,
+				NsPerOp:           102345.0,
+				AllocedBytesPerOp: 64,
+				Measured:          bench.NsPerOp | bench.AllocedBytesPerOp,
+				Extra: map[string]float64{
+					"ms/frame": 1.52,
+					"pkts/s":   42,
+				},
+			},
+		},
 		{
 			line: "PASS: main_test.go:49: MySuite.BenchmarkSortSlice	   20000	     89618 ns/op",
 			want: &bench.Benchmark{
@@ -142,6 +157,44 @@ func TestParseLine(t *testing.T) {
 	}
 }
 
+func TestParseSetConfigPerPackage(t *testing.T) {
+	// The gocheck benchmarks of the second package are printed without configuration lines and
+	// must not inherit those of the first package.
+	in := `
+goos: linux
+pkg: example.com/a
+BenchmarkA-8   	 1000	       100 ns/op
+PASS
+ok  	example.com/a	1.000s
+PASS: b_test.go:10: Suite.BenchmarkB	 1000	       200 ns/op
+PASS
+ok  	example.com/b	1.000s
+`
+	bs, err := bench.ParseSet(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]struct {
+		pkg    string
+		config map[string]string
+	}{
+		"BenchmarkA-8":     {"example.com/a", map[string]string{"goos": "linux", "pkg": "example.com/a"}},
+		"Suite.BenchmarkB": {"example.com/b", nil},
+	}
+	for name, w := range want {
+		bb := bs[name]
+		if len(bb) != 1 {
+			t.Fatalf("got %d results of %s, want 1", len(bb), name)
+		}
+		if bb[0].Pkg != w.pkg {
+			t.Errorf("package of %s = %q, want %q", name, bb[0].Pkg, w.pkg)
+		}
+		if diff := cmp.Diff(w.config, bb[0].Config); diff != "" {
+			t.Errorf("config of %s [-want +got]:\n%s", name, diff)
+		}
+	}
+}
+
 func TestParseSet(t *testing.T) {
 	// Output involving go testing.B and gocheck benchmarks with noise inbetween. Test that
 	// benchmarks with the same name (e.g. from multiple runs) have their order preserved.
@@ -159,12 +212,18 @@ func TestParseSet(t *testing.T) {
 		goos: linux
 		goarch: amd64
 		pkg: github.com/cilium/cilium/pkg/labels
+		labels_test.go:42: logged by the benchmark
 		BenchmarkParseLabel-8   	 2032945	       569 ns/op
 		BenchmarkParseLabel-8   	 2042311	       557 ns/op
 		PASS
 		ok  	github.com/cilium/cilium/pkg/labels	3.217s
 	`
 
+	labelsConfig := map[string]string{
+		"goos":   "linux",
+		"goarch": "amd64",
+		"pkg":    "github.com/cilium/cilium/pkg/labels",
+	}
 	want := bench.Set{
 		"IDPoolTestSuite.BenchmarkLeaseIDs": []*bench.Benchmark{
 			{
@@ -175,6 +234,7 @@ func TestParseSet(t *testing.T) {
 				AllocsPerOp:       3,
 				Measured:          bench.NsPerOp | bench.AllocedBytesPerOp | bench.AllocsPerOp,
 				Ord:               0,
+				Pkg:               "github.com/cilium/cilium/pkg/idpool",
 			},
 			{
 				Name:              "IDPoolTestSuite.BenchmarkLeaseIDs",
@@ -184,6 +244,7 @@ func TestParseSet(t *testing.T) {
 				AllocsPerOp:       3,
 				Measured:          bench.NsPerOp | bench.AllocedBytesPerOp | bench.AllocsPerOp,
 				Ord:               3,
+				Pkg:               "github.com/cilium/cilium/pkg/idpool",
 			},
 		},
 		"IDPoolTestSuite.BenchmarkRemoveIDs": []*bench.Benchmark{
@@ -195,6 +256,7 @@ func TestParseSet(t *testing.T) {
 				AllocsPerOp:       3,
 				Measured:          bench.NsPerOp | bench.AllocedBytesPerOp | bench.AllocsPerOp,
 				Ord:               1,
+				Pkg:               "github.com/cilium/cilium/pkg/idpool",
 			},
 			{
 				Name:              "IDPoolTestSuite.BenchmarkRemoveIDs",
@@ -204,6 +266,7 @@ func TestParseSet(t *testing.T) {
 				AllocsPerOp:       3,
 				Measured:          bench.NsPerOp | bench.AllocedBytesPerOp | bench.AllocsPerOp,
 				Ord:               4,
+				Pkg:               "github.com/cilium/cilium/pkg/idpool",
 			},
 		},
 		"IDPoolTestSuite.BenchmarkUseAndRelease": []*bench.Benchmark{
@@ -215,6 +278,7 @@ func TestParseSet(t *testing.T) {
 				AllocsPerOp:       6,
 				Measured:          bench.NsPerOp | bench.AllocedBytesPerOp | bench.AllocsPerOp,
 				Ord:               2,
+				Pkg:               "github.com/cilium/cilium/pkg/idpool",
 			},
 			{
 				Name:              "IDPoolTestSuite.BenchmarkUseAndRelease",
@@ -224,6 +288,7 @@ func TestParseSet(t *testing.T) {
 				AllocsPerOp:       6,
 				Measured:          bench.NsPerOp | bench.AllocedBytesPerOp | bench.AllocsPerOp,
 				Ord:               5,
+				Pkg:               "github.com/cilium/cilium/pkg/idpool",
 			},
 		},
 		"BenchmarkParseLabel-8": []*bench.Benchmark{
@@ -233,6 +298,8 @@ func TestParseSet(t *testing.T) {
 				NsPerOp:  569,
 				Measured: bench.NsPerOp,
 				Ord:      6,
+				Pkg:      "github.com/cilium/cilium/pkg/labels",
+				Config:   labelsConfig,
 			},
 			{
 				Name:     "BenchmarkParseLabel-8",
@@ -240,6 +307,8 @@ func TestParseSet(t *testing.T) {
 				NsPerOp:  557,
 				Measured: bench.NsPerOp,
 				Ord:      7,
+				Pkg:      "github.com/cilium/cilium/pkg/labels",
+				Config:   labelsConfig,
 			},
 		},
 	}
@@ -252,3 +321,172 @@ func TestParseSet(t *testing.T) {
 		t.Errorf("ParseSet [-want +got]:\n%s", diff)
 	}
 }
+
+func TestParseName(t *testing.T) {
+	names := []struct {
+		name       string
+		wantBase   string
+		wantParams map[string]string
+		wantProcs  int
+	}{
+		{"BenchmarkSortSlice-8", "BenchmarkSortSlice", nil, 8},
+		{"BenchmarkSortSlice", "BenchmarkSortSlice", nil, 0},
+		{"MySuite.BenchmarkSortSlice", "MySuite.BenchmarkSortSlice", nil, 0},
+		{
+			"BenchmarkDecode/size=10/mode=fast/gzip-16",
+			"BenchmarkDecode/size=10/mode=fast/gzip",
+			map[string]string{"size": "10", "mode": "fast"},
+			16,
+		},
+		{"BenchmarkDecode/level=-1", "BenchmarkDecode/level=-1", map[string]string{"level": "-1"}, 0},
+	}
+
+	for _, n := range names {
+		base, params, procs := bench.ParseName(n.name)
+		if base != n.wantBase || procs != n.wantProcs {
+			t.Errorf("ParseName(%q) = %q, _, %d, want %q, _, %d", n.name, base, procs, n.wantBase, n.wantProcs)
+		}
+		if diff := cmp.Diff(n.wantParams, params); diff != "" {
+			t.Errorf("ParseName(%q) params [-want +got]:\n%s", n.name, diff)
+		}
+	}
+}
+
+func TestReadSetJSON(t *testing.T) {
+	in := "pkg: example.com/foo\nBenchmarkDecode-8 10000 102345 ns/op 1.52 ms/frame 64 B/op\n"
+	want, err := bench.ParseSet(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseSet: %v", err)
+	}
+
+	var buf strings.Builder
+	if err := bench.WriteJSON(&buf, want); err != nil {
+		t.Fatalf("WriteJSON: %v", err)
+	}
+	got, err := bench.ReadSet(strings.NewReader(buf.String()))
+	if err != nil {
+		t.Fatalf("ReadSet: %v", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ReadSet [-want +got]:\n%s", diff)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	old, err := bench.ParseSet(strings.NewReader(`
+		BenchmarkA-8 100 500 ns/op 2 allocs/op
+		BenchmarkA-8 100 520 ns/op 2 allocs/op
+		BenchmarkB-8 100 100 ns/op
+	`))
+	if err != nil {
+		t.Fatalf("ParseSet: %v", err)
+	}
+	new, err := bench.ParseSet(strings.NewReader(`
+		BenchmarkA-8 100 612 ns/op 3 allocs/op
+		BenchmarkC-8 100 100 ns/op
+	`))
+	if err != nil {
+		t.Fatalf("ParseSet: %v", err)
+	}
+
+	want := []bench.Delta{
+		{Name: "BenchmarkA-8", Unit: "allocs/op", Old: 2, New: 3, Change: 0.5},
+		{Name: "BenchmarkA-8", Unit: "ns/op", Old: 510, New: 612, Change: 0.2},
+	}
+	if diff := cmp.Diff(want, bench.Compare(old, new)); diff != "" {
+		t.Errorf("Compare [-want +got]:\n%s", diff)
+	}
+}
+
+func TestMannWhitneyU(t *testing.T) {
+	tests := []struct {
+		x, y    []float64
+		wantMin float64
+		wantMax float64
+	}{
+		// Single samples are never significant.
+		{[]float64{100}, []float64{200}, 1, 1},
+		// Identical samples.
+		{[]float64{1, 1, 1}, []float64{1, 1, 1}, 1, 1},
+		// Clearly shifted distributions.
+		{[]float64{100, 101, 102, 103, 104}, []float64{110, 111, 112, 113, 114}, 0.005, 0.02},
+		// Overlapping distributions.
+		{[]float64{100, 110, 102, 108, 104}, []float64{101, 109, 103, 107, 105}, 0.5, 1},
+	}
+
+	for _, tt := range tests {
+		got := bench.MannWhitneyU(tt.x, tt.y)
+		if got < tt.wantMin || got > tt.wantMax {
+			t.Errorf("MannWhitneyU(%v, %v) = %v, want in [%v, %v]", tt.x, tt.y, got, tt.wantMin, tt.wantMax)
+		}
+	}
+}
+
+func TestParseSetPackage(t *testing.T) {
+	// gocheck benchmarks are not preceded by a "pkg:" line.
+	in := `
+PASS: foo_test.go:10: Suite.BenchmarkB	 1000	 20 ns/op
+OK: 1 passed
+PASS
+pkg: example.com/foo
+BenchmarkA-8 100 10 ns/op
+PASS
+`
+	bs, err := bench.ParseSetPackage(strings.NewReader(in), "example.com/bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for name, bb := range bs {
+		got[name] = bb[0].Pkg
+	}
+	want := map[string]string{
+		"BenchmarkA-8":     "example.com/foo",
+		"Suite.BenchmarkB": "example.com/bar",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParseSetPackage packages mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseGCTrace(t *testing.T) {
+	in := `gc 1 @0.004s 3%: 0.011+0.56+0.003 ms clock, 0.089+0.10/0.61/0.25+0.029 ms cpu, 3->4->1 MB, 4 MB goal, 0 MB stacks, 0 MB globals, 8 P
+goos: linux
+BenchmarkA-8 100 10 ns/op
+gc 2 @1.500s 5%: 0.5+2+0.5 ms clock, 4+1/2/3+4 ms cpu, 8->10->2 MB, 9 MB goal, 8 P (forced)
+gc 3 @bogus
+`
+	got, err := bench.ParseGCTrace(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bench.GCCycle{
+		{
+			Num: 1, Start: 4 * time.Millisecond, CPUPercent: 3,
+			Pause: 14 * time.Microsecond, Mark: 560 * time.Microsecond, CPU: 1078 * time.Microsecond,
+			HeapStart: 3 << 20, HeapEnd: 4 << 20, HeapLive: 1 << 20, HeapGoal: 4 << 20, Procs: 8,
+		},
+		{
+			Num: 2, Start: 1500 * time.Millisecond, CPUPercent: 5,
+			Pause: time.Millisecond, Mark: 2 * time.Millisecond, CPU: 14 * time.Millisecond,
+			HeapStart: 8 << 20, HeapEnd: 10 << 20, HeapLive: 2 << 20, HeapGoal: 9 << 20, Procs: 8,
+			Forced: true,
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("ParseGCTrace mismatch (-want +got):\n%s", diff)
+	}
+
+	s := bench.SummarizeGC(got)
+	s.Add(bench.SummarizeGC(got[:1]))
+	s.Add(bench.SummarizeGC(nil))
+	wantSummary := bench.GCSummary{
+		Runs: 3, Cycles: 3, Forced: 1,
+		Pause: 1028 * time.Microsecond, MaxPause: time.Millisecond, Mark: 3120 * time.Microsecond, CPU: 16156 * time.Microsecond,
+		CPUPercent:   5,
+		AvgHeapStart: 14 << 20 / 3, AvgHeapEnd: 6 << 20, AvgHeapLive: 4 << 20 / 3, MaxHeap: 10 << 20,
+	}
+	if diff := cmp.Diff(wantSummary, s); diff != "" {
+		t.Errorf("GCSummary mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+)
+
+// Values returns the measurements in the given unit of all runs in bb.
+func Values(bb []*Benchmark, unit string) []float64 {
+	var vs []float64
+	for _, b := range bb {
+		if v, ok := b.Value(unit); ok {
+			vs = append(vs, v)
+		}
+	}
+	return vs
+}
+
+// Mean returns the arithmetic mean of vs, or NaN if vs is empty.
+func Mean(vs []float64) float64 {
+	if len(vs) == 0 {
+		return math.NaN()
+	}
+	sum := 0.0
+	for _, v := range vs {
+		sum += v
+	}
+	return sum / float64(len(vs))
+}
+
+// Delta is the change of the measurements of a benchmark in one unit between two sets.
+type Delta struct {
+	Name   string
+	Unit   string
+	Old    float64 // mean of the old measurements
+	New    float64 // mean of the new measurements
+	Change float64 // relative change from Old to New, NaN if Old is zero
+}
+
+// Compare returns the deltas of all benchmarks and units present in both old and new, sorted by
+// benchmark name and unit. Benchmarks are matched by name.
+func Compare(old, new Set) []Delta {
+	var deltas []Delta
+	for name, oldBB := range old {
+		newBB, ok := new[name]
+		if !ok || len(oldBB) == 0 || len(newBB) == 0 {
+			continue
+		}
+		for _, unit := range oldBB[0].Units() {
+			oldVs, newVs := Values(oldBB, unit), Values(newBB, unit)
+			if len(newVs) == 0 {
+				continue
+			}
+			d := Delta{Name: name, Unit: unit, Old: Mean(oldVs), New: Mean(newVs), Change: math.NaN()}
+			if d.Old != 0 {
+				d.Change = (d.New - d.Old) / d.Old
+			}
+			deltas = append(deltas, d)
+		}
+	}
+	sort.Slice(deltas, func(i, j int) bool {
+		if deltas[i].Name != deltas[j].Name {
+			return deltas[i].Name < deltas[j].Name
+		}
+		return deltas[i].Unit < deltas[j].Unit
+	})
+	return deltas
+}
+
+// WriteDeltas writes deltas to w as a table.
+func WriteDeltas(w io.Writer, deltas []Delta) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "name\tunit\told\tnew\tdelta\t")
+	for _, d := range deltas {
+		change := "~"
+		if !math.IsNaN(d.Change) {
+			change = fmt.Sprintf("%+.2f%%", d.Change*100)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.6g\t%.6g\t%s\t\n", d.Name, d.Unit, d.Old, d.New, change)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Benchmarks returns all benchmarks in s, sorted by their ordinal position.
+func (s Set) Benchmarks() []*Benchmark {
+	var res []*Benchmark
+	for _, bb := range s {
+		res = append(res, bb...)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Ord != res[j].Ord {
+			return res[i].Ord < res[j].Ord
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// WriteText writes s to w in the Go benchmark output format, preceded by "pkg:" configuration
+// lines where the package changes.
+func WriteText(w io.Writer, s Set) error {
+	pkg := ""
+	for _, b := range s.Benchmarks() {
+		if b.Pkg != pkg && b.Pkg != "" {
+			if _, err := fmt.Fprintf(w, "pkg: %s\n", b.Pkg); err != nil {
+				return err
+			}
+			pkg = b.Pkg
+		}
+		if _, err := fmt.Fprintln(w, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes s to w encoded as JSON.
+func WriteJSON(w io.Writer, s Set) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// WriteCSV writes s to w as CSV with one row per benchmark run. Columns are the benchmark name,
+// package, number of iterations and one column per unit. Units not recorded for a run are left
+// empty.
+func WriteCSV(w io.Writer, s Set) error {
+	benchmarks := s.Benchmarks()
+	units := append([]string(nil), StandardUnits...)
+	seen := make(map[string]bool)
+	var extra []string
+	for _, b := range benchmarks {
+		for u := range b.Extra {
+			if !seen[u] {
+				seen[u] = true
+				extra = append(extra, u)
+			}
+		}
+	}
+	sort.Strings(extra)
+	units = append(units, extra...)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"name", "package", "iterations"}, units...)); err != nil {
+		return err
+	}
+	for _, b := range benchmarks {
+		row := []string{b.Name, b.Pkg, strconv.Itoa(b.N)}
+		for _, u := range units {
+			if v, ok := b.Value(u); ok {
+				row = append(row, strconv.FormatFloat(v, 'g', -1, 64))
+			} else {
+				row = append(row, "")
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadSet reads a Set from r, which contains either benchmark output as accepted by ParseSet or a
+// Set encoded as JSON by WriteJSON.
+func ReadSet(r io.Reader) (Set, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '{' {
+		var s Set
+		if err := json.Unmarshal(trimmed, &s); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	return ParseSet(bytes.NewReader(content))
+}
+
+// ReadSetFile reads a Set from the file with the given name, see ReadSet.
+func ReadSetFile(filename string) (Set, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSet(f)
+}
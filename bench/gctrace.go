@@ -0,0 +1,183 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GCCycle is a garbage collection cycle reported by the runtime with GODEBUG=gctrace=1.
+type GCCycle struct {
+	Num int
+	// Start is the time of the start of the cycle since the start of the program.
+	Start time.Duration
+	// CPUPercent is the percentage of the CPU time used by the GC since the start of the
+	// program.
+	CPUPercent float64
+	// Pause is the wall-clock time of the stop-the-world sweep termination and mark
+	// termination phases, Mark the one of the concurrent mark phase.
+	Pause time.Duration
+	Mark  time.Duration
+	// CPU is the CPU time used by all phases of the cycle.
+	CPU time.Duration
+	// HeapStart, HeapEnd and HeapLive are the heap size at the start and end of the cycle and
+	// the marked live heap in bytes, HeapGoal the heap goal. The runtime reports them in MB,
+	// so they are multiples of 1 MiB.
+	HeapStart, HeapEnd, HeapLive, HeapGoal uint64
+	Procs                                  int
+	// Forced reports whether the cycle was forced, e.g. by runtime.GC.
+	Forced bool
+}
+
+// gctraceRegexp matches the gctrace lines printed by the runtime, e.g.
+// gc 1 @0.004s 3%: 0.011+0.56+0.003 ms clock, 0.089+0.10/0.61/0.25+0.029 ms cpu, 3->4->1 MB, 4 MB goal, 0 MB stacks, 0 MB globals, 8 P
+// Go releases before 1.18 omit the stacks and globals.
+var gctraceRegexp = regexp.MustCompile(`^gc (\d+) @([0-9.]+)s (\d+)%: ([0-9.]+)\+([0-9.]+)\+([0-9.]+) ms clock, ([0-9.+/]+) ms cpu, (\d+)->(\d+)->(\d+) MB, (\d+) MB goal, (?:.*, )?(\d+) P( \(forced\))?$`)
+
+// ms converts a duration in milliseconds as printed by the runtime.
+func ms(s string) time.Duration {
+	v, _ := strconv.ParseFloat(s, 64)
+	return time.Duration(v * float64(time.Millisecond))
+}
+
+// mb converts a size in MB as printed by the runtime into bytes.
+func mb(s string) uint64 {
+	v, _ := strconv.ParseUint(s, 10, 64)
+	return v << 20
+}
+
+// ParseGCTraceLine parses a gctrace line into a GC cycle. It returns false if the line is not
+// a gctrace line.
+func ParseGCTraceLine(line string) (GCCycle, bool) {
+	m := gctraceRegexp.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return GCCycle{}, false
+	}
+	c := GCCycle{
+		Pause:     ms(m[4]) + ms(m[6]),
+		Mark:      ms(m[5]),
+		HeapStart: mb(m[8]),
+		HeapEnd:   mb(m[9]),
+		HeapLive:  mb(m[10]),
+		HeapGoal:  mb(m[11]),
+		Forced:    m[13] != "",
+	}
+	c.Num, _ = strconv.Atoi(m[1])
+	start, _ := strconv.ParseFloat(m[2], 64)
+	c.Start = time.Duration(start * float64(time.Second))
+	c.CPUPercent, _ = strconv.ParseFloat(m[3], 64)
+	for _, f := range strings.FieldsFunc(m[7], func(r rune) bool { return r == '+' || r == '/' }) {
+		c.CPU += ms(f)
+	}
+	c.Procs, _ = strconv.Atoi(m[12])
+	return c, true
+}
+
+// ParseGCTrace parses the gctrace lines in r, e.g. the standard error of a test binary run with
+// GODEBUG=gctrace=1. Other lines are ignored.
+func ParseGCTrace(r io.Reader) ([]GCCycle, error) {
+	var cycles []GCCycle
+	scan := bufio.NewScanner(r)
+	scan.Buffer(nil, 1<<20)
+	for scan.Scan() {
+		if c, ok := ParseGCTraceLine(scan.Text()); ok {
+			cycles = append(cycles, c)
+		}
+	}
+	return cycles, scan.Err()
+}
+
+// GCSummary aggregates the GC cycles of one or more runs of a program.
+type GCSummary struct {
+	Runs   int `json:"runs"` // number of summarized runs
+	Cycles int `json:"cycles"`
+	Forced int `json:"forced"` // number of forced cycles
+	// Pause and MaxPause are the total and maximum stop-the-world time of the cycles, Mark the
+	// total time of the concurrent mark phases and CPU the CPU time used by the GC.
+	Pause    time.Duration `json:"pause"`
+	MaxPause time.Duration `json:"max_pause"`
+	Mark     time.Duration `json:"mark"`
+	CPU      time.Duration `json:"cpu"`
+	// CPUPercent is the maximum over all runs of the percentage of CPU time used by the GC, as
+	// reported by the last cycle of each run.
+	CPUPercent float64 `json:"cpu_percent"`
+	// AvgHeapStart, AvgHeapEnd and AvgHeapLive are the average heap sizes at the start and end
+	// of the cycles and the average marked live heap in bytes. MaxHeap is the maximum heap size
+	// at the end of any cycle.
+	AvgHeapStart uint64 `json:"avg_heap_start"`
+	AvgHeapEnd   uint64 `json:"avg_heap_end"`
+	AvgHeapLive  uint64 `json:"avg_heap_live"`
+	MaxHeap      uint64 `json:"max_heap"`
+}
+
+// SummarizeGC summarizes the GC cycles of a single run of a program.
+func SummarizeGC(cycles []GCCycle) GCSummary {
+	s := GCSummary{Runs: 1, Cycles: len(cycles)}
+	var start, end, live uint64
+	for _, c := range cycles {
+		if c.Forced {
+			s.Forced++
+		}
+		s.Pause += c.Pause
+		if c.Pause > s.MaxPause {
+			s.MaxPause = c.Pause
+		}
+		s.Mark += c.Mark
+		s.CPU += c.CPU
+		s.CPUPercent = c.CPUPercent
+		start += c.HeapStart
+		end += c.HeapEnd
+		live += c.HeapLive
+		if c.HeapEnd > s.MaxHeap {
+			s.MaxHeap = c.HeapEnd
+		}
+	}
+	if n := uint64(len(cycles)); n > 0 {
+		s.AvgHeapStart, s.AvgHeapEnd, s.AvgHeapLive = start/n, end/n, live/n
+	}
+	return s
+}
+
+// Add adds the GC cycles summarized in o to s.
+func (s *GCSummary) Add(o GCSummary) {
+	if n := uint64(s.Cycles + o.Cycles); n > 0 {
+		avg := func(a, b uint64) uint64 {
+			return (a*uint64(s.Cycles) + b*uint64(o.Cycles)) / n
+		}
+		s.AvgHeapStart = avg(s.AvgHeapStart, o.AvgHeapStart)
+		s.AvgHeapEnd = avg(s.AvgHeapEnd, o.AvgHeapEnd)
+		s.AvgHeapLive = avg(s.AvgHeapLive, o.AvgHeapLive)
+	}
+	s.Runs += o.Runs
+	s.Cycles += o.Cycles
+	s.Forced += o.Forced
+	s.Pause += o.Pause
+	if o.MaxPause > s.MaxPause {
+		s.MaxPause = o.MaxPause
+	}
+	s.Mark += o.Mark
+	s.CPU += o.CPU
+	if o.CPUPercent > s.CPUPercent {
+		s.CPUPercent = o.CPUPercent
+	}
+	if o.MaxHeap > s.MaxHeap {
+		s.MaxHeap = o.MaxHeap
+	}
+}
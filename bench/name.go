@@ -0,0 +1,43 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ParseName splits a benchmark name such as "BenchmarkFoo/size=10/fast-8" into the name without
+// the GOMAXPROCS suffix ("BenchmarkFoo/size=10/fast"), the key=value parameters of its
+// sub-benchmarks ({"size": "10"}) and the GOMAXPROCS value (8, or 0 if not present).
+func ParseName(name string) (base string, params map[string]string, procs int) {
+	base = name
+	// A dash directly following '=' is the sign of a negative parameter value.
+	if i := strings.LastIndexByte(name, '-'); i > 0 && name[i-1] != '=' && !strings.Contains(name[i:], "/") {
+		if n, err := strconv.Atoi(name[i+1:]); err == nil && n > 0 {
+			base, procs = name[:i], n
+		}
+	}
+	parts := strings.Split(base, "/")
+	for _, part := range parts[1:] {
+		if i := strings.IndexByte(part, '='); i > 0 {
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[part[:i]] = part[i+1:]
+		}
+	}
+	return base, params, procs
+}
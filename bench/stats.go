@@ -0,0 +1,134 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"math"
+	"sort"
+)
+
+// Summary holds descriptive statistics of the samples of a benchmark in one unit, e.g. from
+// repeated runs using go test -count.
+type Summary struct {
+	N      int
+	Mean   float64
+	Median float64
+	StdDev float64 // sample standard deviation, zero for less than two samples
+	Min    float64
+	Max    float64
+}
+
+// Summarize computes descriptive statistics of vs. All fields but N are NaN if vs is empty.
+func Summarize(vs []float64) Summary {
+	s := Summary{N: len(vs)}
+	if len(vs) == 0 {
+		nan := math.NaN()
+		s.Mean, s.Median, s.StdDev, s.Min, s.Max = nan, nan, nan, nan, nan
+		return s
+	}
+	sorted := append([]float64(nil), vs...)
+	sort.Float64s(sorted)
+	s.Min, s.Max = sorted[0], sorted[len(sorted)-1]
+	if n := len(sorted); n%2 == 1 {
+		s.Median = sorted[n/2]
+	} else {
+		s.Median = (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	s.Mean = Mean(vs)
+	if len(vs) > 1 {
+		sum := 0.0
+		for _, v := range vs {
+			sum += (v - s.Mean) * (v - s.Mean)
+		}
+		s.StdDev = math.Sqrt(sum / float64(len(vs)-1))
+	}
+	return s
+}
+
+// MannWhitneyU returns the two-sided p-value of the Mann-Whitney U test for the null hypothesis
+// that x and y are drawn from the same distribution. It uses the normal approximation with tie
+// and continuity correction. The p-value is 1 if either sample is empty or all values are equal,
+// and a single sample on each side never yields a significant result.
+func MannWhitneyU(x, y []float64) float64 {
+	n1, n2 := len(x), len(y)
+	if n1 == 0 || n2 == 0 {
+		return 1
+	}
+
+	type obs struct {
+		v     float64
+		fromX bool
+	}
+	all := make([]obs, 0, n1+n2)
+	for _, v := range x {
+		all = append(all, obs{v, true})
+	}
+	for _, v := range y {
+		all = append(all, obs{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+
+	// Assign average ranks to ties and accumulate the tie correction term.
+	n := len(all)
+	rankSumX, ties := 0.0, 0.0
+	for i := 0; i < n; {
+		j := i
+		for j < n && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2 // ranks are 1-based
+		for k := i; k < j; k++ {
+			if all[k].fromX {
+				rankSumX += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+
+	u := rankSumX - float64(n1*(n1+1))/2
+	mu := float64(n1*n2) / 2
+	variance := float64(n1*n2) / 12 * (float64(n+1) - ties/float64(n*(n-1)))
+	if variance <= 0 {
+		return 1
+	}
+	z := (math.Abs(u-mu) - 0.5) / math.Sqrt(variance)
+	if z <= 0 {
+		return 1
+	}
+	return math.Erfc(z / math.Sqrt2)
+}
+
+// tQuantile975 holds the 97.5% quantiles of Student's t-distribution for 1 to 30 degrees of
+// freedom.
+var tQuantile975 = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// ConfidenceInterval returns the half-width of the 95% confidence interval of the mean, or +Inf
+// for less than two samples.
+func (s Summary) ConfidenceInterval() float64 {
+	if s.N < 2 {
+		return math.Inf(1)
+	}
+	t := 1.96
+	if df := s.N - 1; df <= len(tQuantile975) {
+		t = tQuantile975[df-1]
+	}
+	return t * s.StdDev / math.Sqrt(float64(s.N))
+}
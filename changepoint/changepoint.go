@@ -0,0 +1,231 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package changepoint detects shifts in the distribution of benchmark results over a series of
+// runs using E-Divisive means, see Matteson and James, "A Nonparametric Approach for Multiple
+// Change Point Analysis of Multivariate Data" (2014).
+package changepoint
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Kind distinguishes sudden steps from slow drift.
+type Kind string
+
+// Kinds of change points.
+const (
+	// Step is a sudden shift between two consecutive runs.
+	Step Kind = "step"
+	// Drift is a gradual shift over several runs.
+	Drift Kind = "drift"
+)
+
+// Options configures the detection.
+type Options struct {
+	// MinSize is the minimum number of values on each side of a change point.
+	MinSize int
+	// Permutations is the number of random permutations used to test significance.
+	Permutations int
+	// Alpha is the significance level.
+	Alpha float64
+	// Window is the number of values before and after a change point compared to tell steps
+	// from drift.
+	Window int
+	// StepRatio is the minimum ratio of the shift within the window to the overall shift for a
+	// change point to be considered a step.
+	StepRatio float64
+}
+
+// DefaultOptions are the default detection options.
+var DefaultOptions = Options{
+	MinSize:      3,
+	Permutations: 99,
+	Alpha:        0.05,
+	Window:       2,
+	StepRatio:    0.5,
+}
+
+// Point is a change point in a series of values.
+type Point struct {
+	Index  int     // index of the first value after the change
+	Before float64 // mean of the segment before the change
+	After  float64 // mean of the segment after the change
+	P      float64 // p-value of the permutation test
+	Kind   Kind
+}
+
+// statistic returns the index maximizing the E-Divisive divergence between xs[lo:tau] and
+// xs[tau:hi] along with its value, where d holds the pairwise distances indexed by perm.
+func statistic(d [][]float64, perm []int, lo, hi, minSize int) (int, float64) {
+	n := hi - lo
+	if n < 2*minSize {
+		return -1, 0
+	}
+	dist := func(i, j int) float64 { return d[perm[i]][perm[j]] }
+
+	// within[k] is the sum of distances between all pairs in xs[lo:lo+k], withinR[k] the sum
+	// over all pairs in xs[lo+k:hi].
+	within := make([]float64, n+1)
+	for k := 2; k <= n; k++ {
+		s := within[k-1]
+		for i := lo; i < lo+k-1; i++ {
+			s += dist(i, lo+k-1)
+		}
+		within[k] = s
+	}
+	withinR := make([]float64, n+1)
+	for k := n - 2; k >= 0; k-- {
+		s := withinR[k+1]
+		for j := lo + k + 1; j < hi; j++ {
+			s += dist(lo+k, j)
+		}
+		withinR[k] = s
+	}
+
+	// between is the sum of distances between xs[lo:lo+k] and xs[lo+k:hi], starting at k = 1.
+	between := 0.0
+	for j := lo + 1; j < hi; j++ {
+		between += dist(lo, j)
+	}
+	best, bestQ := -1, math.Inf(-1)
+	for k := 1; k < n; k++ {
+		if k > 1 {
+			// Move xs[lo+k-1] from the right to the left segment.
+			m := lo + k - 1
+			for i := lo; i < m; i++ {
+				between -= dist(i, m)
+			}
+			for j := m + 1; j < hi; j++ {
+				between += dist(m, j)
+			}
+		}
+		if k < minSize || n-k < minSize {
+			continue
+		}
+		l, r := float64(k), float64(n-k)
+		e := 2 * between / (l * r)
+		if k > 1 {
+			e -= within[k] / (l * (l - 1) / 2)
+		}
+		if n-k > 1 {
+			e -= withinR[k] / (r * (r - 1) / 2)
+		}
+		q := l * r / (l + r) * e
+		if q > bestQ {
+			best, bestQ = lo+k, q
+		}
+	}
+	return best, bestQ
+}
+
+func mean(xs []float64) float64 {
+	sum := 0.0
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+// classify tells a step from drift by comparing the shift across the change point within a
+// window of values to the overall shift between the adjacent segments.
+func classify(xs []float64, lo, tau, hi int, opts Options) Kind {
+	w := opts.Window
+	if tau-lo < w {
+		w = tau - lo
+	}
+	if hi-tau < w {
+		w = hi - tau
+	}
+	overall := math.Abs(mean(xs[tau:hi]) - mean(xs[lo:tau]))
+	if overall == 0 {
+		return Step
+	}
+	local := math.Abs(mean(xs[tau:tau+w]) - mean(xs[tau-w:tau]))
+	if local >= opts.StepRatio*overall {
+		return Step
+	}
+	return Drift
+}
+
+// Detect returns the significant change points in xs, sorted by index.
+func Detect(xs []float64, opts Options) []Point {
+	n := len(xs)
+	if opts.MinSize < 1 {
+		opts.MinSize = 1
+	}
+	d := make([][]float64, n)
+	for i := range d {
+		d[i] = make([]float64, n)
+		for j := range d[i] {
+			d[i][j] = math.Abs(xs[i] - xs[j])
+		}
+	}
+	identity := make([]int, n)
+	for i := range identity {
+		identity[i] = i
+	}
+	// A fixed seed keeps the results reproducible across scrapes.
+	rng := rand.New(rand.NewSource(1))
+
+	// Recursively bisect the segments [lo, hi) at their most significant change point.
+	var points []Point
+	segments := [][2]int{{0, n}}
+	for len(segments) > 0 {
+		lo, hi := segments[0][0], segments[0][1]
+		segments = segments[1:]
+		tau, q := statistic(d, identity, lo, hi, opts.MinSize)
+		if tau < 0 || q <= 0 {
+			continue
+		}
+		exceeded := 0
+		perm := append([]int(nil), identity...)
+		for i := 0; i < opts.Permutations; i++ {
+			seg := perm[lo:hi]
+			rng.Shuffle(len(seg), func(i, j int) { seg[i], seg[j] = seg[j], seg[i] })
+			if _, pq := statistic(d, perm, lo, hi, opts.MinSize); pq >= q {
+				exceeded++
+			}
+		}
+		p := float64(exceeded+1) / float64(opts.Permutations+1)
+		if p > opts.Alpha {
+			continue
+		}
+		points = append(points, Point{
+			Index:  tau,
+			Before: mean(xs[lo:tau]),
+			After:  mean(xs[tau:hi]),
+			P:      p,
+			Kind:   classify(xs, lo, tau, hi, opts),
+		})
+		segments = append(segments, [2]int{lo, tau}, [2]int{tau, hi})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Index < points[j].Index })
+
+	// The segment means are recomputed, as later bisections may have split the segments.
+	for i := range points {
+		lo, hi := 0, n
+		if i > 0 {
+			lo = points[i-1].Index
+		}
+		if i+1 < len(points) {
+			hi = points[i+1].Index
+		}
+		points[i].Before = mean(xs[lo:points[i].Index])
+		points[i].After = mean(xs[points[i].Index:hi])
+	}
+	return points
+}
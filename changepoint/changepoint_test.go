@@ -0,0 +1,141 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package changepoint_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tklauser/gobench_exporter/bench"
+	"github.com/tklauser/gobench_exporter/changepoint"
+	"github.com/tklauser/gobench_exporter/history"
+)
+
+func TestDetect(t *testing.T) {
+	noise := []float64{1, -2, 0, 2, -1, 1, 0, -1, 2, -2}
+	series := func(f func(i int) float64, n int) []float64 {
+		xs := make([]float64, n)
+		for i := range xs {
+			xs[i] = f(i) + noise[i%len(noise)]
+		}
+		return xs
+	}
+
+	type point struct {
+		Index int
+		Kind  changepoint.Kind
+	}
+	tests := []struct {
+		name string
+		xs   []float64
+		want []point
+	}{
+		{
+			name: "flat",
+			xs:   series(func(int) float64 { return 100 }, 20),
+		},
+		{
+			name: "step",
+			xs: series(func(i int) float64 {
+				if i < 12 {
+					return 100
+				}
+				return 150
+			}, 24),
+			want: []point{{12, changepoint.Step}},
+		},
+		{
+			name: "two steps",
+			xs: series(func(i int) float64 {
+				switch {
+				case i < 10:
+					return 100
+				case i < 20:
+					return 150
+				}
+				return 100
+			}, 30),
+			want: []point{{10, changepoint.Step}, {20, changepoint.Step}},
+		},
+		{
+			name: "drift",
+			xs: series(func(i int) float64 {
+				switch {
+				case i < 8:
+					return 100
+				case i < 24:
+					return 100 + float64(i-8)*5
+				}
+				return 180
+			}, 32),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []point
+			for _, p := range changepoint.Detect(tt.xs, changepoint.DefaultOptions) {
+				got = append(got, point{p.Index, p.Kind})
+			}
+			if tt.name == "drift" {
+				// The exact position within the ramp is not well-defined.
+				if len(got) == 0 {
+					t.Fatal("no change point detected")
+				}
+				for _, p := range got {
+					if p.Kind != changepoint.Drift {
+						t.Errorf("change point at %d is a %s, want %s", p.Index, p.Kind, changepoint.Drift)
+					}
+				}
+				return
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Detect mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	t0 := time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)
+	var runs []*history.Run
+	for i := 0; i < 12; i++ {
+		ns := 100.0 + float64(i%3)
+		if i >= 6 {
+			ns += 50
+		}
+		runs = append(runs, &history.Run{
+			ID:     string(rune('a' + i)),
+			Time:   t0.Add(time.Duration(i) * time.Hour),
+			Target: "foo",
+			Commit: string(rune('A' + i)),
+			Results: bench.Set{
+				"BenchmarkFoo": {{Name: "BenchmarkFoo", N: 1, NsPerOp: ns, Measured: bench.NsPerOp}},
+			},
+		})
+	}
+	cps := changepoint.Analyze(runs, changepoint.DefaultOptions)
+	if len(cps) != 1 {
+		t.Fatalf("got %d change points, want 1: %+v", len(cps), cps)
+	}
+	cp := cps[0]
+	if cp.RunID != "g" || cp.Commit != "G" || cp.Unit != "ns/op" || cp.Kind != changepoint.Step {
+		t.Errorf("unexpected change point %+v", cp)
+	}
+	if cp.Before != 101 || cp.After != 151 {
+		t.Errorf("Before, After = %v, %v, want 101, 151", cp.Before, cp.After)
+	}
+}
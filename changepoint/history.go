@@ -0,0 +1,103 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package changepoint
+
+import (
+	"sort"
+	"time"
+
+	"github.com/tklauser/gobench_exporter/bench"
+	"github.com/tklauser/gobench_exporter/history"
+)
+
+// ChangePoint is a change point in the results of a benchmark in one unit over the runs of a
+// target (or a variant of the target's build matrix).
+type ChangePoint struct {
+	Target    string    `json:"target"`
+	Variant   string    `json:"variant,omitempty"`
+	Benchmark string    `json:"benchmark"`
+	Unit      string    `json:"unit"`
+	RunID     string    `json:"run_id"` // first run after the change
+	Commit    string    `json:"commit,omitempty"`
+	Time      time.Time `json:"time"`
+	Before    float64   `json:"before"` // mean of the run medians before the change
+	After     float64   `json:"after"`  // mean of the run medians after the change
+	Change    float64   `json:"change"` // relative change in percent
+	P         float64   `json:"p"`
+	Kind      Kind      `json:"kind"`
+}
+
+type seriesKey struct {
+	target, variant, benchmark, unit string
+}
+
+// Analyze detects change points in the median results of each benchmark and unit over runs,
+// which must be in chronological order. Each variant of a target is analyzed separately. The
+// change points are sorted by target, variant, benchmark, unit and time.
+func Analyze(runs []*history.Run, opts Options) []ChangePoint {
+	values := make(map[seriesKey][]float64)
+	series := make(map[seriesKey][]*history.Run)
+	for _, r := range runs {
+		for name, bb := range r.Results {
+			if len(bb) == 0 {
+				continue
+			}
+			for _, unit := range bb[len(bb)-1].Units() {
+				k := seriesKey{r.Target, r.Variant, name, unit}
+				values[k] = append(values[k], bench.Summarize(bench.Values(bb, unit)).Median)
+				series[k] = append(series[k], r)
+			}
+		}
+	}
+
+	var cps []ChangePoint
+	for k, xs := range values {
+		for _, p := range Detect(xs, opts) {
+			r := series[k][p.Index]
+			cp := ChangePoint{
+				Target:    k.target,
+				Variant:   k.variant,
+				Benchmark: k.benchmark,
+				Unit:      k.unit,
+				RunID:     r.ID,
+				Commit:    r.Commit,
+				Time:      r.Time,
+				Before:    p.Before,
+				After:     p.After,
+				P:         p.P,
+				Kind:      p.Kind,
+			}
+			if p.Before != 0 {
+				cp.Change = (p.After - p.Before) / p.Before * 100
+			}
+			cps = append(cps, cp)
+		}
+	}
+	sort.Slice(cps, func(i, j int) bool {
+		a, b := cps[i], cps[j]
+		switch {
+		case a.Target != b.Target:
+			return a.Target < b.Target
+		case a.Variant != b.Variant:
+			return a.Variant < b.Variant
+		case a.Benchmark != b.Benchmark:
+			return a.Benchmark < b.Benchmark
+		case a.Unit != b.Unit:
+			return a.Unit < b.Unit
+		}
+		return a.Time.Before(b.Time)
+	})
+	return cps
+}
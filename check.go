@@ -0,0 +1,303 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tklauser/gobench_exporter/bench"
+	"github.com/tklauser/gobench_exporter/collector"
+	"github.com/tklauser/gobench_exporter/config"
+	"github.com/tklauser/gobench_exporter/regression"
+	"github.com/tklauser/gobench_exporter/runner"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// checkCommand compares a candidate run with a baseline and fails on regressions, e.g. as a CI
+// gate.
+type checkCommand struct {
+	targets         *targetFlags
+	baselineFile    string
+	baselineHistory bool
+	baselineVariant string
+	baselineRef     string
+	candidateFile   string
+	historyPath     string
+	thresholdsFile  string
+	budgetFile      string
+	count           int
+	requireSamples  bool
+	allocDiff       bool
+}
+
+func registerCheckCommand(app *kingpin.Application) {
+	c := &checkCommand{}
+	cmd := app.Command("check", "Compare a candidate run with a baseline and exit non-zero on regressions beyond the thresholds.")
+	c.targets = registerTargetFlags(cmd)
+	cmd.Flag(
+		"baseline.file",
+		"Result file containing the baseline benchmark output or JSON.",
+	).StringVar(&c.baselineFile)
+	cmd.Flag(
+		"baseline.history",
+		"Use the most recent run of the target, variant and profile in the history store as baseline.",
+	).BoolVar(&c.baselineHistory)
+	cmd.Flag(
+		"baseline.variant",
+		"Build matrix variant of the run used by --baseline.history, e.g. go1.22.5,tags=. Empty for targets without a build matrix.",
+	).StringVar(&c.baselineVariant)
+	cmd.Flag(
+		"baseline.ref",
+		"Git ref of the target's repository to check out in a temporary worktree and benchmark as baseline.",
+	).StringVar(&c.baselineRef)
+	cmd.Flag(
+		"candidate.file",
+		"Result file containing the candidate benchmark output or JSON. Runs the benchmarks of the target if empty.",
+	).StringVar(&c.candidateFile)
+	cmd.Flag(
+		"history.path",
+		"Directory of the history store used by --baseline.history.",
+	).StringVar(&c.historyPath)
+	cmd.Flag(
+		"thresholds.file",
+		"YAML file with the regression thresholds. Defaults to ns/op +5% if significant and any increase in B/op and allocs/op.",
+	).StringVar(&c.thresholdsFile)
+	cmd.Flag(
+		"budget.file",
+		"YAML file with absolute limits per benchmark glob pattern and unit to check the candidate against.",
+	).StringVar(&c.budgetFile)
+	cmd.Flag(
+		"count",
+		"Number of times to run each benchmark (go test -count). 0 uses the target's and profile's arguments.",
+	).Default("0").IntVar(&c.count)
+	cmd.Flag(
+		"regression.require-samples",
+		fmt.Sprintf("Fail on changes beyond the threshold of rules requiring significance if a benchmark has fewer than %d samples on either side, instead of reporting them as inconclusive.", regression.MinSamples),
+	).BoolVar(&c.requireSamples)
+	cmd.Flag(
+		"alloc-diff",
+		"Explain allocs/op and B/op regressions by the changes of the escape analysis and inlining decisions of the compiler between the baseline commit (with --baseline.ref or --baseline.history) and the working tree.",
+	).Default("true").BoolVar(&c.allocDiff)
+	cmd.Action(c.run)
+}
+
+// runTarget runs the benchmarks of the selected target. If dir is non-empty, it replaces the
+// target's repository path.
+func (c *checkCommand) runTarget(ctx context.Context, t *config.Target, p *config.Profile, dir string) (bench.Set, error) {
+	rt, benchRegex := c.targets.runnerTarget(t, p)
+	if dir != "" {
+		rt.RepoPath = dir
+	}
+	if c.count > 0 {
+		rt.GoArgs = append(rt.GoArgs, "-count="+strconv.Itoa(c.count))
+	}
+	bs, err := runner.Run(ctx, rt, benchRegex)
+	if err != nil && len(bs) > 0 {
+		// E.g. a test binary failed after some benchmarks completed.
+		log.Printf("Ignoring error after collecting %d benchmarks: %v", len(bs), err)
+		err = nil
+	}
+	return bs, err
+}
+
+// baseline returns the baseline benchmark results and the git commit or ref they were obtained
+// at, if known.
+func (c *checkCommand) baseline(ctx context.Context, t *config.Target, p *config.Profile) (bench.Set, string, error) {
+	switch {
+	case c.baselineFile != "":
+		bs, err := bench.ReadSetFile(c.baselineFile)
+		return bs, "", err
+	case c.baselineHistory:
+		store, err := openHistory(c.historyPath)
+		if err != nil {
+			return nil, "", err
+		}
+		if store == nil {
+			return nil, "", fmt.Errorf("--baseline.history requires --history.path")
+		}
+		// Runs of other variants or profiles are not comparable with the candidate.
+		r, err := store.Latest(t.Name, c.baselineVariant, c.targets.profile)
+		if err != nil {
+			return nil, "", err
+		}
+		if r == nil {
+			return nil, "", fmt.Errorf("no runs of target %q (variant %q, profile %q) in history store", t.Name, c.baselineVariant, c.targets.profile)
+		}
+		log.Printf("Using run %s (commit %s) as baseline", r.ID, r.Commit)
+		return r.Results, r.Commit, nil
+	default:
+		dir, cleanup, err := runner.Worktree(ctx, t.RepoPath, c.baselineRef)
+		if err != nil {
+			return nil, "", err
+		}
+		defer cleanup()
+		log.Printf("Benchmarking baseline %s", c.baselineRef)
+		bs, err := c.runTarget(ctx, t, p, dir)
+		return bs, c.baselineRef, err
+	}
+}
+
+func (c *checkCommand) run(*kingpin.ParseContext) error {
+	n := 0
+	for _, set := range []bool{c.baselineFile != "", c.baselineHistory, c.baselineRef != ""} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 || n == 0 && c.budgetFile == "" {
+		return fmt.Errorf("exactly one of --baseline.file, --baseline.history and --baseline.ref or a --budget.file is required")
+	}
+	th := regression.DefaultThresholds()
+	if c.thresholdsFile != "" {
+		var err error
+		if th, err = regression.LoadThresholds(c.thresholdsFile); err != nil {
+			return err
+		}
+	}
+	if c.requireSamples {
+		th.RequireSamples = true
+	}
+	var budget *regression.Budget
+	if c.budgetFile != "" {
+		var err error
+		if budget, err = regression.LoadBudget(c.budgetFile); err != nil {
+			return err
+		}
+	}
+	_, t, p, err := c.targets.load()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var (
+		baseline    bench.Set
+		baselineRef string
+	)
+	if n > 0 {
+		if baseline, baselineRef, err = c.baseline(ctx, t, p); err != nil {
+			return fmt.Errorf("failed to get baseline: %v", err)
+		}
+	}
+	var candidate bench.Set
+	if c.candidateFile != "" {
+		candidate, err = bench.ReadSetFile(c.candidateFile)
+	} else {
+		candidate, err = c.runTarget(ctx, t, p, "")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get candidate: %v", err)
+	}
+
+	failures := 0
+	if baseline != nil {
+		results := regression.Check(baseline, candidate, th)
+		if len(results) == 0 {
+			return fmt.Errorf("no benchmarks in common between baseline and candidate")
+		}
+		if err := regression.WriteReport(os.Stdout, results, th.Alpha); err != nil {
+			return err
+		}
+		if n := regression.TooFewSamples(results); n > 0 {
+			log.Printf("Warning: %d result(s) have fewer than %d samples to test for significance, changes beyond their threshold are inconclusive; use --count=%d or more",
+				n, regression.MinSamples, regression.MinSamples)
+		}
+		if c.allocDiff && baselineRef != "" {
+			rt, _ := c.targets.runnerTarget(t, p)
+			if err := writeAllocDiffs(ctx, os.Stdout, rt, baselineRef, "", results, candidate, baseline); err != nil {
+				log.Printf("Failed to diff escape analysis and inlining decisions: %v", err)
+			}
+		}
+		failures += regression.Regressions(results)
+	}
+	if budget != nil {
+		results := budget.Evaluate(candidate)
+		if baseline != nil {
+			fmt.Println()
+		}
+		if err := regression.WriteBudgetReport(os.Stdout, results); err != nil {
+			return err
+		}
+		for _, r := range results {
+			if r.Violation {
+				failures++
+			}
+		}
+	}
+	if failures > 0 {
+		return fmt.Errorf("%d regression(s) beyond thresholds or budget", failures)
+	}
+	return nil
+}
+
+// compareRefsCommand runs the benchmarks of a target at two git refs interleaved and prints the
+// comparison.
+type compareRefsCommand struct {
+	targets   *targetFlags
+	base      string
+	head      string
+	rounds    int
+	format    string
+	allocDiff bool
+}
+
+func registerCompareRefsCommand(app *kingpin.Application) {
+	c := &compareRefsCommand{}
+	cmd := app.Command("compare-refs", "Benchmark two git refs by alternately running their test binaries and print the comparison.")
+	c.targets = registerTargetFlags(cmd)
+	cmd.Arg("base", "Git ref of the baseline.").Required().StringVar(&c.base)
+	cmd.Arg("head", "Git ref to compare with the baseline.").Required().StringVar(&c.head)
+	cmd.Flag("rounds", "Number of rounds to run the benchmarks of both refs.").Default(strconv.Itoa(defaultABRounds)).IntVar(&c.rounds)
+	cmd.Flag("format", "Output format: a table (text) or delta gauges (prometheus).").Default("text").EnumVar(&c.format, "text", "prometheus")
+	cmd.Flag(
+		"alloc-diff",
+		"Explain allocs/op and B/op regressions by the changes of the escape analysis and inlining decisions of the compiler between the refs.",
+	).Default("true").BoolVar(&c.allocDiff)
+	cmd.Action(c.run)
+}
+
+func (c *compareRefsCommand) run(*kingpin.ParseContext) error {
+	_, t, p, err := c.targets.load()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	rt, benchRegex := c.targets.runnerTarget(t, p)
+	base, head, err := runner.RunAB(ctx, rt, c.base, c.head, c.rounds, benchRegex)
+	if err != nil {
+		return err
+	}
+	th := regression.DefaultThresholds()
+	results := regression.Check(base, head, th)
+	if c.format == "prometheus" {
+		ab := collector.NewABCollector()
+		ab.Set(t.Name, c.base, c.head, results)
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(ab)
+		return writeMetrics(os.Stdout, reg)
+	}
+	if err := regression.WriteReport(os.Stdout, results, th.Alpha); err != nil {
+		return err
+	}
+	if c.allocDiff {
+		return writeAllocDiffs(ctx, os.Stdout, rt, c.base, c.head, results, head, base)
+	}
+	return nil
+}
@@ -0,0 +1,434 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/prometheus/common/expfmt"
+	"github.com/tklauser/gobench_exporter/bench"
+	"github.com/tklauser/gobench_exporter/collector"
+	"github.com/tklauser/gobench_exporter/config"
+	"github.com/tklauser/gobench_exporter/history"
+	"github.com/tklauser/gobench_exporter/regression"
+	"github.com/tklauser/gobench_exporter/runner"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// Output formats supported by the run and parse commands.
+var formats = []string{"text", "json", "csv", "prometheus"}
+
+// defaultConfig returns the configuration used if no configuration file is given, consisting of
+// a single target named "default" for the Go packages in repoPath.
+func defaultConfig(repoPath string) *config.Config {
+	return &config.Config{
+		Targets: []*config.Target{
+			{Name: "default", RepoPath: repoPath},
+		},
+	}
+}
+
+// targetFlags holds the flags selecting the target and profile to run benchmarks for.
+type targetFlags struct {
+	configFile string
+	repoPath   string
+	target     string
+	profile    string
+	bench      string
+	cachePath  string
+}
+
+func registerTargetFlags(cmd *kingpin.CmdClause) *targetFlags {
+	f := &targetFlags{}
+	cmd.Flag(
+		"config.file",
+		"YAML configuration file declaring targets and run profiles.",
+	).StringVar(&f.configFile)
+	cmd.Flag(
+		"fs.repo-path",
+		"Filesystem path of the Go package to benchmark if no configuration file is given.",
+	).Default(".").StringVar(&f.repoPath)
+	cmd.Flag(
+		"target",
+		"Name of the configured target to benchmark.",
+	).Default("default").StringVar(&f.target)
+	cmd.Flag(
+		"profile",
+		"Name of the configured run profile to use.",
+	).StringVar(&f.profile)
+	cmd.Flag(
+		"bench",
+		"Regular expression selecting the benchmarks to run. Overrides the profile.",
+	).StringVar(&f.bench)
+	cmd.Flag(
+		"cache.path",
+		"Directory in which compiled test binaries are cached by commit, build flags and Go version. Overrides the configuration file.",
+	).StringVar(&f.cachePath)
+	return f
+}
+
+// load returns the configuration and the selected target and profile.
+func (f *targetFlags) load() (*config.Config, *config.Target, *config.Profile, error) {
+	cfg := defaultConfig(f.repoPath)
+	if f.configFile != "" {
+		var err error
+		if cfg, err = config.Load(f.configFile); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	t := cfg.Target(f.target)
+	if t == nil {
+		return nil, nil, nil, fmt.Errorf("unknown target %q", f.target)
+	}
+	p, err := cfg.Profile(f.profile)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return cfg, t, p, nil
+}
+
+// runnerTarget returns the runner target and benchmark regular expression for target t and
+// profile p, taking the --bench and --cache.path flags into account.
+func (f *targetFlags) runnerTarget(t *config.Target, p *config.Profile) (runner.Target, string) {
+	rt, benchRegex := t.RunnerTarget(p)
+	return rt, f.override(&rt, benchRegex)
+}
+
+// override applies the --bench and --cache.path flags to rt and returns the benchmark regular
+// expression to use instead of benchRegex.
+func (f *targetFlags) override(rt *runner.Target, benchRegex string) string {
+	if f.cachePath != "" {
+		rt.CacheDir = f.cachePath
+	}
+	if f.bench != "" {
+		return f.bench
+	}
+	return benchRegex
+}
+
+// runVariants runs the benchmarks of all variants of the target and profile selected by f.
+func (f *targetFlags) runVariants(ctx context.Context) (*config.Config, *config.Target, []variantRun, error) {
+	cfg, t, p, err := f.load()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	runs, _, err := runVariants(ctx, cfg, t, p, f.override)
+	return cfg, t, runs, err
+}
+
+// openHistory opens the history store in dir, or returns nil if dir is empty.
+func openHistory(dir string) (*history.Store, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	return history.Open(dir)
+}
+
+// recordRun records the results of running variant vr of target t using the named profile in
+// store, along with the commit checked out in the target's repository and the recorded profiles,
+// and sets the run ID of vr. It returns the recorded run, or nil if store is nil.
+func recordRun(ctx context.Context, store *history.Store, t *config.Target, profile string, vr *variantRun) (*history.Run, error) {
+	if store == nil {
+		return nil, nil
+	}
+	r := &history.Run{
+		Target:      t.Name,
+		Profile:     profile,
+		Variant:     vr.variant.Name,
+		Labels:      vr.labels,
+		Environment: vr.env,
+		Usage:       vr.usage,
+		Results:     vr.results,
+		PGOResults:  vr.pgoResults,
+		Traces:      vr.traces,
+	}
+	srcs := make([]string, 0, len(vr.profiles))
+	for _, p := range vr.profiles {
+		r.Profiles = append(r.Profiles, history.ProfileFile{
+			Pkg:       p.Pkg,
+			Benchmark: p.Benchmark,
+			Kind:      p.Kind,
+			File:      filepath.Base(p.Path),
+		})
+		srcs = append(srcs, p.Path)
+	}
+	if commit, err := runner.Commit(ctx, t.RepoPath); err == nil {
+		r.Commit = commit
+	}
+	if err := store.AddWithProfiles(r, srcs); err != nil {
+		return nil, err
+	}
+	vr.runID = r.ID
+	return r, nil
+}
+
+// gatherer returns a registry exporting the benchmarks in bs.
+func gatherer(bs bench.Set, opts collector.Options, src collector.Source) *prometheus.Registry {
+	c := collector.NewGoBenchCollectorWithOptions(opts)
+	c.Update(bs, src)
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	return reg
+}
+
+// writeMetrics writes the metrics gathered from g in the Prometheus text format.
+func writeMetrics(w io.Writer, g prometheus.Gatherer) error {
+	mfs, err := g.Gather()
+	if err != nil {
+		return err
+	}
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeResults writes bs to w in the given format.
+func writeResults(w io.Writer, bs bench.Set, format string, opts collector.Options) error {
+	switch format {
+	case "json":
+		return bench.WriteJSON(w, bs)
+	case "csv":
+		return bench.WriteCSV(w, bs)
+	case "prometheus":
+		return writeMetrics(w, gatherer(bs, opts, collector.Source{}))
+	default:
+		return bench.WriteText(w, bs)
+	}
+}
+
+// runCommand runs benchmarks once and prints the results.
+type runCommand struct {
+	global      *globalFlags
+	targets     *targetFlags
+	format      string
+	historyPath string
+}
+
+func registerRunCommand(app *kingpin.Application, g *globalFlags) {
+	c := &runCommand{global: g}
+	cmd := app.Command("run", "Run benchmarks once and print the results.")
+	c.targets = registerTargetFlags(cmd)
+	cmd.Flag("format", "Output format.").Default("text").EnumVar(&c.format, formats...)
+	cmd.Flag(
+		"history.path",
+		"Directory of the history store to record the results in.",
+	).StringVar(&c.historyPath)
+	cmd.Action(c.run)
+}
+
+func (c *runCommand) run(*kingpin.ParseContext) error {
+	escaping, err := c.global.escaping()
+	if err != nil {
+		return err
+	}
+	store, err := openHistory(c.historyPath)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	cfg, t, runs, err := c.targets.runVariants(ctx)
+	defer cleanupRuns(runs)
+	for i := range runs {
+		if _, herr := recordRun(ctx, store, t, c.targets.profile, &runs[i]); herr != nil {
+			return herr
+		}
+		if runs[i].runID != "" {
+			log.Printf("Recorded run %s", runs[i].runID)
+		}
+	}
+	if len(runs) > 0 {
+		if werr := c.writeResults(os.Stdout, cfg, t, runs, escaping); werr != nil {
+			return werr
+		}
+	}
+	return err
+}
+
+// writeResults writes the results of the variants of target t in the selected format.
+func (c *runCommand) writeResults(w io.Writer, cfg *config.Config, t *config.Target, runs []variantRun, escaping collector.NameEscaping) error {
+	if len(runs) == 1 && runs[0].variant.Name == "" && runs[0].pgoResults == nil {
+		return writeResults(w, runs[0].results, c.format, cfg.CollectorOptions(escaping))
+	}
+	switch c.format {
+	case "text":
+		return writeVariantResults(w, runs, regression.DefaultThresholds())
+	case "prometheus":
+		coll := collector.NewGoBenchCollectorWithOptions(cfg.CollectorOptions(escaping))
+		for _, r := range runs {
+			coll.Update(r.results, r.source(t))
+		}
+		vc := collector.NewVariantCollector()
+		vc.Set(t.Name, compareVariants(runs, regression.DefaultThresholds()))
+		pc := collector.NewPGOCollector()
+		for _, r := range runs {
+			if r.pgoResults != nil {
+				pc.Set(t.Name, r.variant.Name, regression.Check(r.results, r.pgoResults, regression.DefaultThresholds()))
+			}
+		}
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(coll, vc, pc)
+		return writeMetrics(w, reg)
+	default:
+		return fmt.Errorf("format %s does not support build matrices or PGO, use text or prometheus", c.format)
+	}
+}
+
+// parseCommand converts benchmark output read from stdin.
+type parseCommand struct {
+	global *globalFlags
+	format string
+}
+
+func registerParseCommand(app *kingpin.Application, g *globalFlags) {
+	c := &parseCommand{global: g}
+	cmd := app.Command("parse", "Convert benchmark output read from stdin.")
+	cmd.Flag("format", "Output format.").Default("json").EnumVar(&c.format, formats...)
+	cmd.Action(c.run)
+}
+
+func (c *parseCommand) run(*kingpin.ParseContext) error {
+	escaping, err := c.global.escaping()
+	if err != nil {
+		return err
+	}
+	bs, err := bench.ParseSet(os.Stdin)
+	if err != nil {
+		return err
+	}
+	return writeResults(os.Stdout, bs, c.format, collector.Options{NameEscaping: escaping})
+}
+
+// compareCommand prints the differences between two result files.
+type compareCommand struct {
+	oldFile string
+	newFile string
+}
+
+func registerCompareCommand(app *kingpin.Application) {
+	c := &compareCommand{}
+	cmd := app.Command("compare", "Compare two result files containing benchmark output or JSON.")
+	cmd.Arg("old", "Result file with the old benchmark results.").Required().StringVar(&c.oldFile)
+	cmd.Arg("new", "Result file with the new benchmark results.").Required().StringVar(&c.newFile)
+	cmd.Action(c.run)
+}
+
+func (c *compareCommand) run(*kingpin.ParseContext) error {
+	oldSet, err := bench.ReadSetFile(c.oldFile)
+	if err != nil {
+		return err
+	}
+	newSet, err := bench.ReadSetFile(c.newFile)
+	if err != nil {
+		return err
+	}
+	return bench.WriteDeltas(os.Stdout, bench.Compare(oldSet, newSet))
+}
+
+// exportCommand writes benchmark results to a node_exporter textfile or pushes them to a
+// Pushgateway.
+type exportCommand struct {
+	global   *globalFlags
+	input    string
+	textfile string
+	pushURL  string
+	pushJob  string
+}
+
+func registerExportCommand(app *kingpin.Application, g *globalFlags) {
+	c := &exportCommand{global: g}
+	cmd := app.Command("export", "Export benchmark results to a textfile or a Pushgateway.")
+	cmd.Flag(
+		"input",
+		"Result file containing benchmark output or JSON. Reads from stdin if empty.",
+	).StringVar(&c.input)
+	cmd.Flag(
+		"textfile",
+		"Path of the textfile (e.g. for the node_exporter textfile collector) to write.",
+	).StringVar(&c.textfile)
+	cmd.Flag(
+		"push.url",
+		"URL of the Pushgateway to push to.",
+	).StringVar(&c.pushURL)
+	cmd.Flag(
+		"push.job",
+		"Job name used when pushing to the Pushgateway.",
+	).Default("gobench").StringVar(&c.pushJob)
+	cmd.Action(c.run)
+}
+
+// writeTextfile atomically writes the metrics gathered from g to filename.
+func writeTextfile(filename string, g prometheus.Gatherer) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := writeMetrics(tmp, g); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// TempFile creates the file with mode 0600, which the node exporter could not read if it
+	// runs as another user.
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+func (c *exportCommand) run(*kingpin.ParseContext) error {
+	if c.textfile == "" && c.pushURL == "" {
+		return fmt.Errorf("either --textfile or --push.url is required")
+	}
+	escaping, err := c.global.escaping()
+	if err != nil {
+		return err
+	}
+	var bs bench.Set
+	if c.input == "" {
+		bs, err = bench.ReadSet(os.Stdin)
+	} else {
+		bs, err = bench.ReadSetFile(c.input)
+	}
+	if err != nil {
+		return err
+	}
+
+	reg := gatherer(bs, collector.Options{NameEscaping: escaping}, collector.Source{})
+	if c.textfile != "" {
+		if err := writeTextfile(c.textfile, reg); err != nil {
+			return err
+		}
+	}
+	if c.pushURL != "" {
+		if err := push.New(c.pushURL, c.pushJob).Gatherer(reg).Push(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tklauser/gobench_exporter/regression"
+)
+
+// abComparison is the comparison of the benchmarks of a target at two git refs.
+type abComparison struct {
+	base, head string
+	results    []regression.Result
+}
+
+// ABCollector exports the most recent A/B comparison of each target as delta gauges.
+type ABCollector struct {
+	mu          sync.Mutex
+	comparisons map[string]abComparison // keyed by target
+
+	changeDesc *prometheus.Desc
+	pValueDesc *prometheus.Desc
+}
+
+// NewABCollector returns a collector without any comparisons.
+func NewABCollector() *ABCollector {
+	labels := []string{"target", "benchmark", "unit", "base", "head"}
+	return &ABCollector{
+		comparisons: make(map[string]abComparison),
+		changeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "ab", "change_ratio"),
+			"Relative change of the benchmark median from the base to the head ref in an interleaved A/B run",
+			labels, nil,
+		),
+		pValueDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "ab", "p_value"),
+			"p-value of the Mann-Whitney U test comparing the base and head samples in an interleaved A/B run",
+			labels, nil,
+		),
+	}
+}
+
+// Set replaces the comparison of target with the results of comparing the base and head refs.
+func (c *ABCollector) Set(target, base, head string, results []regression.Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.comparisons[target] = abComparison{base: base, head: head, results: results}
+}
+
+// Describe implements prometheus.Collector.
+func (c *ABCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.changeDesc
+	ch <- c.pValueDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *ABCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for target, cmp := range c.comparisons {
+		for _, r := range cmp.results {
+			if r.Old.Median == 0 {
+				continue
+			}
+			change := (r.New.Median - r.Old.Median) / r.Old.Median
+			ch <- prometheus.MustNewConstMetric(c.changeDesc, prometheus.GaugeValue, change, target, r.Name, r.Unit, cmp.base, cmp.head)
+			ch <- prometheus.MustNewConstMetric(c.pValueDesc, prometheus.GaugeValue, r.P, target, r.Name, r.Unit, cmp.base, cmp.head)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tklauser/gobench_exporter/regression"
+)
+
+func TestABCollector(t *testing.T) {
+	base := mustParseSet(t, "BenchmarkA 100 100 ns/op\nBenchmarkA 100 102 ns/op\nBenchmarkA 100 98 ns/op")
+	head := mustParseSet(t, "BenchmarkA 100 90 ns/op\nBenchmarkA 100 92 ns/op\nBenchmarkA 100 88 ns/op")
+	c := NewABCollector()
+	c.Set("foo", "v1.0", "main", regression.Check(base, head, regression.DefaultThresholds()))
+
+	want := `
+# HELP gobench_ab_change_ratio Relative change of the benchmark median from the base to the head ref in an interleaved A/B run
+# TYPE gobench_ab_change_ratio gauge
+gobench_ab_change_ratio{base="v1.0",benchmark="BenchmarkA",head="main",target="foo",unit="ns/op"} -0.1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "gobench_ab_change_ratio"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tklauser/gobench_exporter/runner"
+)
+
+// AvailableCollector exports the benchmarks available in the packages of each target, whether
+// they were run or not.
+type AvailableCollector struct {
+	mu         sync.Mutex
+	benchmarks map[string][]runner.Available
+
+	availableDesc *prometheus.Desc
+}
+
+// NewAvailableCollector returns a collector without any benchmarks.
+func NewAvailableCollector() *AvailableCollector {
+	return &AvailableCollector{
+		benchmarks: make(map[string][]runner.Available),
+		availableDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "benchmark", "available"),
+			"Benchmark available in a package of the target, whether it was run or not",
+			[]string{"target", "package", "benchmark"}, nil,
+		),
+	}
+}
+
+// Set replaces the available benchmarks of target.
+func (c *AvailableCollector) Set(target string, av []runner.Available) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.benchmarks[target] = av
+}
+
+// Available returns the available benchmarks of target and whether they are known.
+func (c *AvailableCollector) Available(target string) ([]runner.Available, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	av, ok := c.benchmarks[target]
+	return av, ok
+}
+
+// Describe implements prometheus.Collector.
+func (c *AvailableCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.availableDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *AvailableCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for target, av := range c.benchmarks {
+		for _, a := range av {
+			ch <- prometheus.MustNewConstMetric(c.availableDesc, prometheus.GaugeValue, 1, target, a.Pkg, a.Name)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tklauser/gobench_exporter/runner"
+)
+
+func TestAvailableCollector(t *testing.T) {
+	c := NewAvailableCollector()
+	av := []runner.Available{
+		{Pkg: "example.com/a", Name: "BenchmarkFoo", Results: true},
+		{Pkg: "example.com/a", Name: "MySuite.BenchmarkBar", Gocheck: true},
+	}
+	c.Set("foo", av)
+	c.Set("bar", nil)
+
+	want := `
+# HELP gobench_benchmark_available Benchmark available in a package of the target, whether it was run or not
+# TYPE gobench_benchmark_available gauge
+gobench_benchmark_available{benchmark="BenchmarkFoo",package="example.com/a",target="foo"} 1
+gobench_benchmark_available{benchmark="MySuite.BenchmarkBar",package="example.com/a",target="foo"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+
+	got, ok := c.Available("foo")
+	if !ok {
+		t.Fatalf("Available(%q) not known", "foo")
+	}
+	if diff := cmp.Diff(av, got); diff != "" {
+		t.Errorf("Available [-want +got]:\n%s", diff)
+	}
+	if _, ok := c.Available("baz"); ok {
+		t.Errorf("Available(%q) known", "baz")
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tklauser/gobench_exporter/bench"
+	"github.com/tklauser/gobench_exporter/regression"
+)
+
+// BudgetCollector exports the performance budget of benchmarks along with whether the most
+// recent results of each target and variant violate it.
+type BudgetCollector struct {
+	budget *regression.Budget
+
+	mu      sync.Mutex
+	results map[measurementKey]regression.BudgetResult
+
+	budgetDesc    *prometheus.Desc
+	violationDesc *prometheus.Desc
+}
+
+// NewBudgetCollector returns a collector evaluating benchmark results against budget.
+func NewBudgetCollector(budget *regression.Budget) *BudgetCollector {
+	labels := []string{"target", "variant", "benchmark", "unit"}
+	return &BudgetCollector{
+		budget:  budget,
+		results: make(map[measurementKey]regression.BudgetResult),
+		budgetDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "budget"),
+			"Limit of the benchmark measurement in the given unit according to the performance budget, a floor for units where higher is better and a ceiling otherwise",
+			labels,
+			nil,
+		),
+		violationDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "budget_violation"),
+			"Whether the median of the most recent benchmark results violates the performance budget",
+			labels,
+			nil,
+		),
+	}
+}
+
+// Update evaluates bs of the variant (empty for targets without a build matrix) of target
+// against the budget, replacing earlier results of the same benchmarks of the variant. It returns
+// the results evaluated.
+func (c *BudgetCollector) Update(target, variant string, bs bench.Set) []regression.BudgetResult {
+	results := c.budget.Evaluate(bs)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, r := range results {
+		c.results[measurementKey{runKey{target, variant}, r.Name, r.Unit}] = r
+	}
+	return results
+}
+
+// Describe implements prometheus.Collector.
+func (c *BudgetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.budgetDesc
+	ch <- c.violationDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *BudgetCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, r := range c.results {
+		violation := 0.0
+		if r.Violation {
+			violation = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.budgetDesc, prometheus.GaugeValue, r.Limit, k.target, k.variant, r.Name, r.Unit)
+		ch <- prometheus.MustNewConstMetric(c.violationDesc, prometheus.GaugeValue, violation, k.target, k.variant, r.Name, r.Unit)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tklauser/gobench_exporter/regression"
+)
+
+func TestBudgetCollector(t *testing.T) {
+	budget, err := regression.ParseBudget([]byte(`
+BenchmarkParse*:
+  ns/op: 2000
+  allocs/op: 3
+  MB/s: 100
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewBudgetCollector(budget)
+	c.Update("foo", "", mustParseSet(t, "BenchmarkParseA 100 2500 ns/op 16 B/op 2 allocs/op\nBenchmarkOther 100 5000 ns/op"))
+	c.Update("foo", "", mustParseSet(t, "BenchmarkParseB 100 1000 ns/op 50 MB/s"))
+	c.Update("bar", "go1.14", mustParseSet(t, "BenchmarkParseA 100 1000 ns/op 200 MB/s"))
+
+	want := `
+# HELP gobench_budget Limit of the benchmark measurement in the given unit according to the performance budget, a floor for units where higher is better and a ceiling otherwise
+# TYPE gobench_budget gauge
+gobench_budget{benchmark="BenchmarkParseA",target="bar",unit="MB/s",variant="go1.14"} 100
+gobench_budget{benchmark="BenchmarkParseA",target="bar",unit="ns/op",variant="go1.14"} 2000
+gobench_budget{benchmark="BenchmarkParseA",target="foo",unit="allocs/op",variant=""} 3
+gobench_budget{benchmark="BenchmarkParseA",target="foo",unit="ns/op",variant=""} 2000
+gobench_budget{benchmark="BenchmarkParseB",target="foo",unit="MB/s",variant=""} 100
+gobench_budget{benchmark="BenchmarkParseB",target="foo",unit="ns/op",variant=""} 2000
+# HELP gobench_budget_violation Whether the median of the most recent benchmark results violates the performance budget
+# TYPE gobench_budget_violation gauge
+gobench_budget_violation{benchmark="BenchmarkParseA",target="bar",unit="MB/s",variant="go1.14"} 0
+gobench_budget_violation{benchmark="BenchmarkParseA",target="bar",unit="ns/op",variant="go1.14"} 0
+gobench_budget_violation{benchmark="BenchmarkParseA",target="foo",unit="allocs/op",variant=""} 0
+gobench_budget_violation{benchmark="BenchmarkParseA",target="foo",unit="ns/op",variant=""} 1
+gobench_budget_violation{benchmark="BenchmarkParseB",target="foo",unit="MB/s",variant=""} 1
+gobench_budget_violation{benchmark="BenchmarkParseB",target="foo",unit="ns/op",variant=""} 0
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tklauser/gobench_exporter/changepoint"
+)
+
+// ChangePointCollector exports the most recent change point detected in the history of each
+// benchmark and unit of each target variant.
+type ChangePointCollector struct {
+	mu           sync.Mutex
+	changePoints map[string][]changepoint.ChangePoint // keyed by target
+
+	detectedDesc *prometheus.Desc
+}
+
+// NewChangePointCollector returns a collector without any change points.
+func NewChangePointCollector() *ChangePointCollector {
+	return &ChangePointCollector{
+		changePoints: make(map[string][]changepoint.ChangePoint),
+		detectedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "changepoint_detected"),
+			"Most recent change point in the benchmark history, labeled with the first run and commit after the change",
+			[]string{"target", "variant", "benchmark", "unit", "kind", "run", "commit"},
+			nil,
+		),
+	}
+}
+
+// Set replaces the change points of target, which must be sorted as returned by
+// changepoint.Analyze.
+func (c *ChangePointCollector) Set(target string, cps []changepoint.ChangePoint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(cps) == 0 {
+		delete(c.changePoints, target)
+	} else {
+		c.changePoints[target] = cps
+	}
+}
+
+// ChangePoints returns all change points, sorted by target, variant, benchmark, unit and time.
+func (c *ChangePointCollector) ChangePoints() []changepoint.ChangePoint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	targets := make([]string, 0, len(c.changePoints))
+	for t := range c.changePoints {
+		targets = append(targets, t)
+	}
+	sort.Strings(targets)
+	var res []changepoint.ChangePoint
+	for _, t := range targets {
+		res = append(res, c.changePoints[t]...)
+	}
+	return res
+}
+
+// Describe implements prometheus.Collector.
+func (c *ChangePointCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.detectedDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *ChangePointCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cps := range c.changePoints {
+		for i, cp := range cps {
+			if i+1 < len(cps) && cps[i+1].Variant == cp.Variant && cps[i+1].Benchmark == cp.Benchmark && cps[i+1].Unit == cp.Unit {
+				continue // not the most recent
+			}
+			ch <- prometheus.MustNewConstMetric(c.detectedDesc, prometheus.GaugeValue, 1,
+				cp.Target, cp.Variant, cp.Benchmark, cp.Unit, string(cp.Kind), cp.RunID, cp.Commit)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tklauser/gobench_exporter/changepoint"
+)
+
+func TestChangePointCollector(t *testing.T) {
+	c := NewChangePointCollector()
+	c.Set("foo", []changepoint.ChangePoint{
+		{Target: "foo", Benchmark: "BenchmarkA", Unit: "ns/op", RunID: "r1", Commit: "c1", Kind: changepoint.Step},
+		{Target: "foo", Benchmark: "BenchmarkA", Unit: "ns/op", RunID: "r5", Commit: "c5", Kind: changepoint.Drift},
+		{Target: "foo", Benchmark: "BenchmarkB", Unit: "B/op", RunID: "r3", Commit: "c3", Kind: changepoint.Step},
+		{Target: "foo", Variant: "go1.22", Benchmark: "BenchmarkB", Unit: "B/op", RunID: "r4", Commit: "c4", Kind: changepoint.Step},
+	})
+	c.Set("bar", []changepoint.ChangePoint{
+		{Target: "bar", Benchmark: "BenchmarkA", Unit: "ns/op", RunID: "r2", Kind: changepoint.Step},
+	})
+	c.Set("bar", nil)
+
+	want := `
+# HELP gobench_changepoint_detected Most recent change point in the benchmark history, labeled with the first run and commit after the change
+# TYPE gobench_changepoint_detected gauge
+gobench_changepoint_detected{benchmark="BenchmarkA",commit="c5",kind="drift",run="r5",target="foo",unit="ns/op",variant=""} 1
+gobench_changepoint_detected{benchmark="BenchmarkB",commit="c3",kind="step",run="r3",target="foo",unit="B/op",variant=""} 1
+gobench_changepoint_detected{benchmark="BenchmarkB",commit="c4",kind="step",run="r4",target="foo",unit="B/op",variant="go1.22"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+	if n := len(c.ChangePoints()); n != 4 {
+		t.Errorf("ChangePoints() returned %d change points, want 4", n)
+	}
+}
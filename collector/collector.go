@@ -16,7 +16,8 @@ package collector
 
 import (
 	"io"
-	"strings"
+	"sort"
+	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tklauser/gobench_exporter/bench"
@@ -27,12 +28,96 @@ const namespace = "gobench"
 
 // GoBenchCollector implements the prometheus.GoBenchCollector interface.
 type GoBenchCollector struct {
-	benchmarks         bench.Set
-	benchmarkNamesDesc *prometheus.Desc
-	benchmarkDescs     map[string]*prometheus.Desc
+	opts Options
+
+	mu sync.Mutex
+	// benchmarks holds the exported benchmarks keyed by name.
+	benchmarks map[string]*benchmarkEntry
+	// generation is incremented on every update and used to find the least-recently-updated
+	// benchmarks.
+	generation uint64
+	// units maps fully-qualified metric names to their OpenMetrics unit.
+	units map[string]string
+	// renames lists the benchmark names rewritten to form valid metric names.
+	renames []Rename
+
+	seriesDroppedDesc *prometheus.Desc
+	seriesDropped     uint64
+}
+
+// benchmarkEntry holds the results of a single benchmark.
+type benchmarkEntry struct {
+	name       string            // benchmark name after relabeling
+	labels     prometheus.Labels // labels attached to all metrics of the benchmark
+	samples    []*bench.Benchmark
+	generation uint64
+
+	namesDesc *prometheus.Desc
+	descs     map[string]*prometheus.Desc // keyed by measurement key
+}
+
+// latest returns the most recent sample of the benchmark, which is the one exported.
+func (be *benchmarkEntry) latest() *bench.Benchmark {
+	return be.samples[len(be.samples)-1]
+}
+
+// series returns the number of time series exported for the benchmark.
+func (be *benchmarkEntry) series() int {
+	return len(measurements(be.latest())) + 1
 }
 
-var qtys = []string{"N", "ns/op", "B/op", "allocs/op", "MB/s"}
+// Options configures a GoBenchCollector.
+type Options struct {
+	// NameEscaping selects how benchmark names are converted into metric names.
+	NameEscaping NameEscaping
+	// Filter selects the benchmarks exported from all sources.
+	Filter Filter
+	// SeriesLimit is the maximum number of time series exported. If exceeded, the
+	// least-recently-updated benchmarks are dropped. Zero means no limit.
+	SeriesLimit int
+	// RelabelConfigs are applied to the benchmark name, package, sub-benchmark parameters and
+	// configuration keys of each benchmark that passed the filters.
+	RelabelConfigs []*RelabelConfig
+}
+
+// measurement is a single value of a benchmark, normalized to Prometheus base units.
+type measurement struct {
+	key   string // Go benchmark unit, or "N" for the number of iterations
+	unit  unit
+	value float64
+}
+
+// measurements returns all values recorded for b, normalized to Prometheus base units.
+func measurements(b *bench.Benchmark) []measurement {
+	ms := []measurement{
+		{key: "N", unit: unit{suffix: iterationsSuffix, scale: 1}, value: float64(b.N)},
+	}
+	add := func(key string, value float64) {
+		u := parseUnit(key)
+		ms = append(ms, measurement{key: key, unit: u, value: value * u.scale})
+	}
+	if b.Measured&bench.NsPerOp != 0 {
+		add("ns/op", b.NsPerOp)
+	}
+	if b.Measured&bench.AllocedBytesPerOp != 0 {
+		add("B/op", float64(b.AllocedBytesPerOp))
+	}
+	if b.Measured&bench.AllocsPerOp != 0 {
+		add("allocs/op", float64(b.AllocsPerOp))
+	}
+	if b.Measured&bench.MBPerS != 0 {
+		add("MB/s", b.MBPerS)
+	}
+	keys := make([]string, 0, len(b.Extra))
+	for key := range b.Extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		add(key, b.Extra[key])
+	}
+	return ms
+}
 
 func validPrometheusMetricName(r rune) rune {
 	// see https://github.com/prometheus/common/blob/546f1fd8d7df61d94633b254641f9f8f48248ada/model/metric.go#L92
@@ -47,55 +132,226 @@ func validPrometheusMetricName(r rune) rune {
 	}
 }
 
-// NewGoBenchCollector
+// NewGoBenchCollector returns a collector for the benchmarks read from r using default options.
 func NewGoBenchCollector(r io.Reader) *GoBenchCollector {
-	c := &GoBenchCollector{}
-	bs, err := bench.ParseSet(r)
-	if err == nil {
-		c.benchmarks = bs
-		c.benchmarkNamesDesc = prometheus.NewDesc(
+	c := NewGoBenchCollectorWithOptions(Options{})
+	if bs, err := bench.ParseSet(r); err == nil {
+		c.Update(bs, Source{})
+	}
+	return c
+}
+
+// NewGoBenchCollectorWithOptions returns a collector without any benchmarks. Use Update to add
+// benchmark results.
+func NewGoBenchCollectorWithOptions(opts Options) *GoBenchCollector {
+	return &GoBenchCollector{
+		opts:       opts,
+		benchmarks: make(map[string]*benchmarkEntry),
+		seriesDroppedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "series_dropped_total"),
+			"Number of time series dropped because the series limit was exceeded",
+			nil,
+			nil,
+		),
+	}
+}
+
+// Source describes where benchmark results passed to Update originate from, e.g. stdin or a
+// configured target.
+type Source struct {
+	// Filter selects the benchmarks exported from the source.
+	Filter Filter
+	// Labels are attached to all benchmarks of the source. They are subject to relabeling.
+	Labels map[string]string
+}
+
+// Update adds the benchmarks in bs to the collector, replacing earlier results of benchmarks with
+// the same name and labels after relabeling. Only benchmarks matching both the collector's filter
+// and the filter of src are added.
+func (e *GoBenchCollector) Update(bs bench.Set, src Source) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.generation++
+	updated := make(map[string]*benchmarkEntry)
+	for name, bb := range bs {
+		if len(bb) == 0 || !e.opts.Filter.Match(bb[0].Pkg, name) || !src.Filter.Match(bb[0].Pkg, name) {
+			continue
+		}
+		labels := benchmarkLabels(bb[len(bb)-1])
+		for k, v := range src.Labels {
+			labels[k] = v
+		}
+		labels = relabel(labels, e.opts.RelabelConfigs)
+		if labels == nil || labels[BenchmarkNameLabel] == "" {
+			continue
+		}
+		constLabels, id := exportedLabels(labels)
+		key := labels[BenchmarkNameLabel] + "{" + id + "}"
+		be, ok := updated[key]
+		if !ok {
+			be = &benchmarkEntry{
+				name:       labels[BenchmarkNameLabel],
+				labels:     constLabels,
+				generation: e.generation,
+			}
+			updated[key] = be
+		}
+		// Benchmarks renamed by relabeling may end up in the same entry.
+		be.samples = append(be.samples, bb...)
+	}
+	for key, be := range updated {
+		sort.SliceStable(be.samples, func(i, j int) bool {
+			return be.samples[i].Ord < be.samples[j].Ord
+		})
+		e.benchmarks[key] = be
+	}
+	e.enforceSeriesLimit()
+	e.buildDescs()
+}
+
+// SetOptions replaces the options of the collector, e.g. after reloading the configuration.
+// Filters and relabeling rules apply to subsequent updates only.
+func (e *GoBenchCollector) SetOptions(opts Options) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.opts = opts
+	e.enforceSeriesLimit()
+	e.buildDescs()
+}
+
+// enforceSeriesLimit drops the least-recently-updated benchmarks until the number of exported
+// time series is within the limit.
+func (e *GoBenchCollector) enforceSeriesLimit() {
+	if e.opts.SeriesLimit <= 0 {
+		return
+	}
+	total := 0
+	names := make([]string, 0, len(e.benchmarks))
+	for name, be := range e.benchmarks {
+		total += be.series()
+		names = append(names, name)
+	}
+	if total <= e.opts.SeriesLimit {
+		return
+	}
+	sort.Slice(names, func(i, j int) bool {
+		gi, gj := e.benchmarks[names[i]].generation, e.benchmarks[names[j]].generation
+		if gi != gj {
+			return gi < gj
+		}
+		return names[i] > names[j]
+	})
+	for _, name := range names {
+		if total <= e.opts.SeriesLimit {
+			break
+		}
+		n := e.benchmarks[name].series()
+		total -= n
+		e.seriesDropped += uint64(n)
+		delete(e.benchmarks, name)
+	}
+}
+
+// buildDescs (re)builds the descriptors of all exported benchmarks. It must be called with e.mu
+// held.
+func (e *GoBenchCollector) buildDescs() {
+	e.units = make(map[string]string)
+
+	// Benchmarks with the same name (but different labels) must use the same metric names, so the
+	// unit suffixes are assigned for all their units at once.
+	units := make(map[string][]measurement, len(e.benchmarks))
+	for _, be := range e.benchmarks {
+		units[be.name] = append(units[be.name], measurements(be.latest())...)
+	}
+	suffixes := make(map[string]map[string]string, len(units))
+	disambiguated := make(map[string][]string)
+	benchmarkSuffixes := make(map[string][]string, len(units))
+	for bn, ms := range units {
+		suffixes[bn], disambiguated[bn] = unitSuffixes(ms)
+		for _, suffix := range suffixes[bn] {
+			benchmarkSuffixes[bn] = append(benchmarkSuffixes[bn], suffix)
+		}
+	}
+
+	var names map[string]string
+	names, e.renames = assignMetricNames(e.opts.NameEscaping, benchmarkSuffixes)
+	for bn, keys := range disambiguated {
+		for _, key := range keys {
+			e.renames = append(e.renames, Rename{
+				Benchmark:  bn,
+				MetricName: names[bn] + "_" + suffixes[bn][key],
+				Collision:  true,
+				Unit:       key,
+			})
+		}
+	}
+	sort.Slice(e.renames, func(i, j int) bool {
+		if e.renames[i].Benchmark != e.renames[j].Benchmark {
+			return e.renames[i].Benchmark < e.renames[j].Benchmark
+		}
+		return e.renames[i].Unit < e.renames[j].Unit
+	})
+
+	for _, be := range e.benchmarks {
+		name := names[be.name]
+		be.namesDesc = prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "benchmarks"),
 			"The set of Go benchmarks",
 			[]string{"name"},
-			nil,
+			be.labels,
 		)
-		c.benchmarkDescs = make(map[string]*prometheus.Desc, len(bs))
-		for _, bb := range bs {
-			for _, b := range bb {
-				name := strings.Map(validPrometheusMetricName, b.Name)
-				for _, qty := range qtys {
-					key := b.Name + qty
-					if _, ok := c.benchmarkDescs[key]; !ok {
-						c.benchmarkDescs[key] = prometheus.NewDesc(
-							prometheus.BuildFQName(namespace, "", name+strings.ReplaceAll(qty, "/", "_per_")),
-							b.Name+" "+qty,
-							nil,
-							nil,
-						)
-					}
-				}
+		be.descs = make(map[string]*prometheus.Desc)
+		for _, m := range measurements(be.latest()) {
+			fqName := prometheus.BuildFQName(namespace, "", name+"_"+suffixes[be.name][m.key])
+			be.descs[m.key] = prometheus.NewDesc(
+				fqName,
+				be.name+" "+m.key,
+				nil,
+				be.labels,
+			)
+			if m.unit.base != "" {
+				e.units[fqName] = m.unit.base
 			}
 		}
 	}
-	return c
 }
 
-// Describe implements prometheus.Collector interface.
+// Renames returns the benchmark names which were rewritten to form valid metric names, sorted by
+// benchmark name.
+func (e *GoBenchCollector) Renames() []Rename {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.renames
+}
+
+// Unit returns the OpenMetrics unit of the metric with the given fully-qualified name, or an
+// empty string if the metric is dimensionless or not exported by the collector.
+func (e *GoBenchCollector) Unit(fqName string) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.units[fqName]
+}
+
+// Describe implements prometheus.Collector interface. As the exported metrics depend on the
+// benchmark results, only the static descriptors are sent.
 func (e *GoBenchCollector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- e.benchmarkNamesDesc
+	ch <- e.seriesDroppedDesc
 }
 
-// Collect implements prometheus.Collector interface and sends all metrics.
+// Collect implements prometheus.Collector interface and sends all metrics. If a benchmark was run
+// several times, the most recent result is exported.
 func (e *GoBenchCollector) Collect(ch chan<- prometheus.Metric) {
-	for _, bb := range e.benchmarks {
-		for _, b := range bb {
-			ch <- prometheus.MustNewConstMetric(e.benchmarkNamesDesc, prometheus.GaugeValue, 1, b.Name)
-
-			ch <- prometheus.MustNewConstMetric(e.benchmarkDescs[b.Name+qtys[0]], prometheus.GaugeValue, float64(b.N))
-			ch <- prometheus.MustNewConstMetric(e.benchmarkDescs[b.Name+qtys[1]], prometheus.GaugeValue, b.NsPerOp)
-			ch <- prometheus.MustNewConstMetric(e.benchmarkDescs[b.Name+qtys[2]], prometheus.GaugeValue, float64(b.AllocedBytesPerOp))
-			ch <- prometheus.MustNewConstMetric(e.benchmarkDescs[b.Name+qtys[3]], prometheus.GaugeValue, float64(b.AllocsPerOp))
-			ch <- prometheus.MustNewConstMetric(e.benchmarkDescs[b.Name+qtys[4]], prometheus.GaugeValue, b.MBPerS)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(e.seriesDroppedDesc, prometheus.CounterValue, float64(e.seriesDropped))
+	for _, be := range e.benchmarks {
+		ch <- prometheus.MustNewConstMetric(be.namesDesc, prometheus.GaugeValue, 1, be.name)
+
+		for _, m := range measurements(be.latest()) {
+			ch <- prometheus.MustNewConstMetric(be.descs[m.key], prometheus.GaugeValue, m.value)
 		}
 	}
 }
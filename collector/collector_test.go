@@ -0,0 +1,104 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tklauser/gobench_exporter/bench"
+)
+
+func mustParseSet(t *testing.T, in string) bench.Set {
+	t.Helper()
+	bs, err := bench.ParseSet(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseSet: %v", err)
+	}
+	return bs
+}
+
+// gather returns the exported metric names and the number of dropped series.
+func gather(t *testing.T, c *GoBenchCollector) ([]string, float64) {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	var names []string
+	var dropped float64
+	for _, mf := range mfs {
+		switch mf.GetName() {
+		case "gobench_series_dropped_total":
+			dropped = mf.GetMetric()[0].GetCounter().GetValue()
+		case "gobench_benchmarks":
+		default:
+			names = append(names, mf.GetName())
+		}
+	}
+	sort.Strings(names)
+	return names, dropped
+}
+
+func TestUpdateFilter(t *testing.T) {
+	in := `
+		pkg: example.com/foo
+		BenchmarkA-8   	   17461	     69022 ns/op
+		BenchmarkA-8   	   17461	     42000 ns/op
+		BenchmarkB-8   	   17461	     69022 ns/op
+		pkg: example.com/bar
+		BenchmarkC-8   	   17461	     69022 ns/op
+	`
+
+	c := NewGoBenchCollectorWithOptions(Options{
+		Filter: Filter{ExcludePackages: regexp.MustCompile(`/bar$`)},
+	})
+	c.Update(mustParseSet(t, in), Source{Filter: Filter{IncludeNames: regexp.MustCompile(`^BenchmarkA`)}})
+
+	names, _ := gather(t, c)
+	want := []string{"gobench_BenchmarkA_8_iterations", "gobench_BenchmarkA_8_seconds_per_op"}
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Errorf("exported metrics [-want +got]:\n%s", diff)
+	}
+}
+
+func TestUpdateSeriesLimit(t *testing.T) {
+	c := NewGoBenchCollectorWithOptions(Options{SeriesLimit: 6})
+	c.Update(mustParseSet(t, "BenchmarkA 1 1 ns/op\nBenchmarkB 1 1 ns/op"), Source{})
+	c.Update(mustParseSet(t, "BenchmarkC 1 1 ns/op"), Source{})
+	c.Update(mustParseSet(t, "BenchmarkA 1 1 ns/op"), Source{})
+
+	// Each benchmark results in three series: name, iterations and ns/op. BenchmarkB is the
+	// least-recently-updated one and thus dropped.
+	names, dropped := gather(t, c)
+	want := []string{
+		"gobench_BenchmarkA_iterations",
+		"gobench_BenchmarkA_seconds_per_op",
+		"gobench_BenchmarkC_iterations",
+		"gobench_BenchmarkC_seconds_per_op",
+	}
+	if diff := cmp.Diff(want, names); diff != "" {
+		t.Errorf("exported metrics [-want +got]:\n%s", diff)
+	}
+	if dropped != 3 {
+		t.Errorf("gobench_series_dropped_total = %v, want 3", dropped)
+	}
+}
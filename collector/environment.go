@@ -0,0 +1,104 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tklauser/gobench_exporter/sysenv"
+)
+
+// EnvironmentCollector exports the state of the machine taken before the most recent run of each
+// target.
+type EnvironmentCollector struct {
+	mu       sync.Mutex
+	readings map[string]*sysenv.Reading // keyed by target
+
+	load1Desc      *prometheus.Desc
+	load5Desc      *prometheus.Desc
+	load15Desc     *prometheus.Desc
+	swapInDesc     *prometheus.Desc
+	swapOutDesc    *prometheus.Desc
+	busyDesc       *prometheus.Desc
+	governorDesc   *prometheus.Desc
+	violationsDesc *prometheus.Desc
+	delayDesc      *prometheus.Desc
+}
+
+// NewEnvironmentCollector returns a collector without any readings.
+func NewEnvironmentCollector() *EnvironmentCollector {
+	desc := func(name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "env", name),
+			help,
+			append([]string{"target"}, labels...), nil,
+		)
+	}
+	return &EnvironmentCollector{
+		readings:       make(map[string]*sysenv.Reading),
+		load1Desc:      desc("load1", "1 minute load average before the most recent run"),
+		load5Desc:      desc("load5", "5 minute load average before the most recent run"),
+		load15Desc:     desc("load15", "15 minute load average before the most recent run"),
+		swapInDesc:     desc("swap_in_pages_per_second", "Pages swapped in per second before the most recent run"),
+		swapOutDesc:    desc("swap_out_pages_per_second", "Pages swapped out per second before the most recent run"),
+		busyDesc:       desc("busy_processes", "Number of other processes using CPU before the most recent run"),
+		governorDesc:   desc("cpu_governor_info", "CPU frequency governor before the most recent run", "governor"),
+		violationsDesc: desc("preflight_violations", "Number of failed pre-run checks of the most recent run"),
+		delayDesc:      desc("preflight_delay_seconds", "Time the most recent run was delayed waiting for a quiet machine"),
+	}
+}
+
+// Set replaces the reading of target.
+func (c *EnvironmentCollector) Set(target string, r *sysenv.Reading) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readings[target] = r
+}
+
+// Describe implements prometheus.Collector.
+func (c *EnvironmentCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.load1Desc
+	ch <- c.load5Desc
+	ch <- c.load15Desc
+	ch <- c.swapInDesc
+	ch <- c.swapOutDesc
+	ch <- c.busyDesc
+	ch <- c.governorDesc
+	ch <- c.violationsDesc
+	ch <- c.delayDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *EnvironmentCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for target, r := range c.readings {
+		gauge := func(desc *prometheus.Desc, v float64, labels ...string) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, append([]string{target}, labels...)...)
+		}
+		gauge(c.load1Desc, r.Load1)
+		gauge(c.load5Desc, r.Load5)
+		gauge(c.load15Desc, r.Load15)
+		gauge(c.swapInDesc, r.SwapIn)
+		gauge(c.swapOutDesc, r.SwapOut)
+		gauge(c.busyDesc, float64(len(r.BusyProcesses)))
+		if r.Governor != "" {
+			gauge(c.governorDesc, 1, r.Governor)
+		}
+		gauge(c.violationsDesc, float64(len(r.Violations)))
+		gauge(c.delayDesc, r.Delay.Seconds())
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tklauser/gobench_exporter/sysenv"
+)
+
+func TestEnvironmentCollector(t *testing.T) {
+	c := NewEnvironmentCollector()
+	c.Set("foo", &sysenv.Reading{
+		Load1:         1.5,
+		Governor:      "powersave",
+		BusyProcesses: []sysenv.Process{{PID: 7, Command: "make", CPU: 0.9}},
+		Violations:    []string{"governor"},
+		Delay:         30 * time.Second,
+	})
+	c.Set("bar", &sysenv.Reading{Load1: 0.5})
+
+	want := `
+# HELP gobench_env_busy_processes Number of other processes using CPU before the most recent run
+# TYPE gobench_env_busy_processes gauge
+gobench_env_busy_processes{target="bar"} 0
+gobench_env_busy_processes{target="foo"} 1
+# HELP gobench_env_cpu_governor_info CPU frequency governor before the most recent run
+# TYPE gobench_env_cpu_governor_info gauge
+gobench_env_cpu_governor_info{governor="powersave",target="foo"} 1
+# HELP gobench_env_load1 1 minute load average before the most recent run
+# TYPE gobench_env_load1 gauge
+gobench_env_load1{target="bar"} 0.5
+gobench_env_load1{target="foo"} 1.5
+# HELP gobench_env_preflight_delay_seconds Time the most recent run was delayed waiting for a quiet machine
+# TYPE gobench_env_preflight_delay_seconds gauge
+gobench_env_preflight_delay_seconds{target="bar"} 0
+gobench_env_preflight_delay_seconds{target="foo"} 30
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"gobench_env_busy_processes", "gobench_env_cpu_governor_info", "gobench_env_load1", "gobench_env_preflight_delay_seconds"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"regexp"
+)
+
+// Filter selects benchmarks by name and package. A nil regular expression matches everything
+// for includes and nothing for excludes. Benchmarks with an unknown package are matched against
+// the empty string.
+type Filter struct {
+	IncludeNames    *regexp.Regexp
+	ExcludeNames    *regexp.Regexp
+	IncludePackages *regexp.Regexp
+	ExcludePackages *regexp.Regexp
+}
+
+// Match reports whether the benchmark with the given package and name passes the filter.
+func (f Filter) Match(pkg, name string) bool {
+	if f.IncludeNames != nil && !f.IncludeNames.MatchString(name) {
+		return false
+	}
+	if f.ExcludeNames != nil && f.ExcludeNames.MatchString(name) {
+		return false
+	}
+	if f.IncludePackages != nil && !f.IncludePackages.MatchString(pkg) {
+		return false
+	}
+	if f.ExcludePackages != nil && f.ExcludePackages.MatchString(pkg) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,216 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// NameEscaping selects how benchmark names are converted into metric names.
+type NameEscaping int
+
+const (
+	// NameSanitize replaces every rune not valid in a metric name with an underscore. This is
+	// lossy, i.e. several benchmark names may map to the same metric name.
+	NameSanitize NameEscaping = iota
+	// NameEscape escapes benchmark names reversibly (see UnescapeName), using the same scheme as
+	// Prometheus' value encoding escaping: names which are already valid are kept, all others
+	// are prefixed with "U__", underscores are doubled and invalid runes are replaced by their
+	// hexadecimal code point enclosed in underscores.
+	NameEscape
+)
+
+// ParseNameEscaping parses the name of a NameEscaping as used in command line flags.
+func ParseNameEscaping(s string) (NameEscaping, error) {
+	switch s {
+	case "sanitize":
+		return NameSanitize, nil
+	case "escape":
+		return NameEscape, nil
+	}
+	return 0, fmt.Errorf("invalid name escaping %q", s)
+}
+
+// String implements fmt.Stringer.
+func (e NameEscaping) String() string {
+	switch e {
+	case NameSanitize:
+		return "sanitize"
+	case NameEscape:
+		return "escape"
+	}
+	return "NameEscaping(" + strconv.Itoa(int(e)) + ")"
+}
+
+// escapedPrefix marks names escaped using NameEscape.
+const escapedPrefix = "U__"
+
+func isValidMetricName(s string) bool {
+	for _, r := range s {
+		if validPrometheusMetricName(r) != r {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// escapeName escapes a benchmark name reversibly, see NameEscape.
+func escapeName(s string) string {
+	if isValidMetricName(s) {
+		return s
+	}
+	var b strings.Builder
+	b.WriteString(escapedPrefix)
+	for _, r := range s {
+		switch {
+		case r == '_':
+			b.WriteString("__")
+		case validPrometheusMetricName(r) == r:
+			b.WriteRune(r)
+		default:
+			fmt.Fprintf(&b, "_%x_", r)
+		}
+	}
+	return b.String()
+}
+
+// UnescapeName reverses the escaping applied to benchmark names with NameEscape. Names without
+// the escaping prefix are returned unchanged.
+func UnescapeName(s string) (string, error) {
+	if !strings.HasPrefix(s, escapedPrefix) {
+		return s, nil
+	}
+	escaped := s[len(escapedPrefix):]
+	var b strings.Builder
+	for i := 0; i < len(escaped); i++ {
+		if escaped[i] != '_' {
+			b.WriteByte(escaped[i])
+			continue
+		}
+		if i+1 < len(escaped) && escaped[i+1] == '_' {
+			b.WriteByte('_')
+			i++
+			continue
+		}
+		end := strings.IndexByte(escaped[i+1:], '_')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated escape sequence in %q", s)
+		}
+		cp, err := strconv.ParseUint(escaped[i+1:i+1+end], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(cp)) {
+			return "", fmt.Errorf("invalid escape sequence in %q", s)
+		}
+		b.WriteRune(rune(cp))
+		i += end + 1
+	}
+	return b.String(), nil
+}
+
+// Rename records a benchmark name which was rewritten to form a valid metric name.
+type Rename struct {
+	Benchmark  string // original benchmark name
+	MetricName string // metric name component used for the benchmark (and unit, if set)
+	Collision  bool   // whether the name was disambiguated due to a collision
+	// Unit is the unit whose metric name was disambiguated because another unit of the benchmark
+	// maps to the same metric name, or empty if the benchmark name was rewritten.
+	Unit string
+}
+
+// nameHash returns a short, deterministic hash of a benchmark name used to disambiguate
+// colliding metric names.
+func nameHash(s string) string {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// assignMetricNames converts benchmark names into the metric name components used for them.
+// benchmarks maps the benchmark names to the metric name suffixes of their units.
+//
+// If several benchmark names map to the same metric name, the benchmark name which was not
+// rewritten (if any) keeps it and all others get a hash of their original name appended. The same
+// applies to benchmarks whose full metric names collide once the unit suffixes are appended, e.g.
+// BenchmarkX with unit hits/op and BenchmarkX_hits with unit per_op. If none of the colliding
+// names was rewritten, the lexically first one is kept. This keeps the assignment independent of
+// the order in which benchmarks are seen.
+func assignMetricNames(escaping NameEscaping, benchmarks map[string][]string) (map[string]string, []Rename) {
+	candidates := make(map[string][]string, len(benchmarks))
+	for b := range benchmarks {
+		var name string
+		switch escaping {
+		case NameEscape:
+			name = escapeName(b)
+		default:
+			name = strings.Map(validPrometheusMetricName, b)
+		}
+		candidates[name] = append(candidates[name], b)
+	}
+
+	names := make(map[string]string, len(benchmarks))
+	collisions := make(map[string]bool)
+	disambiguate := func(bs []string) {
+		sort.Strings(bs)
+		keep := bs[0]
+		for _, b := range bs {
+			if names[b] == b {
+				keep = b
+				break
+			}
+		}
+		for _, b := range bs {
+			if b != keep && !collisions[b] {
+				names[b] += "_" + nameHash(b)
+				collisions[b] = true
+			}
+		}
+	}
+	for name, bs := range candidates {
+		for _, b := range bs {
+			names[b] = name
+		}
+		if len(bs) > 1 {
+			disambiguate(bs)
+		}
+	}
+
+	owners := make(map[string][]string)
+	for b, suffixes := range benchmarks {
+		for _, suffix := range suffixes {
+			full := names[b] + "_" + suffix
+			owners[full] = append(owners[full], b)
+		}
+	}
+	for _, bs := range owners {
+		if len(bs) > 1 {
+			disambiguate(bs)
+		}
+	}
+
+	var renames []Rename
+	for b, name := range names {
+		if b != name {
+			renames = append(renames, Rename{Benchmark: b, MetricName: name, Collision: collisions[b]})
+		}
+	}
+	sort.Slice(renames, func(i, j int) bool {
+		return renames[i].Benchmark < renames[j].Benchmark
+	})
+	return names, renames
+}
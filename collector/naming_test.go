@@ -0,0 +1,122 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestAssignMetricNames(t *testing.T) {
+	benchmarks := map[string][]string{
+		"BenchmarkFoo/a-b": {"seconds_per_op"},
+		"BenchmarkFoo/a_b": {"seconds_per_op"},
+		"BenchmarkFoo_a_b": {"seconds_per_op"},
+		"BenchmarkBar-8":   {"seconds_per_op"},
+		// The full metric names collide once the unit suffixes are appended.
+		"BenchmarkX":      {"seconds_per_op", "hits_per_op"},
+		"BenchmarkX_hits": {"per_op"},
+		"BenchmarkY":      {"hits_per_op"},
+		"BenchmarkY/hits": {"per_op"},
+	}
+
+	names, renames := assignMetricNames(NameSanitize, benchmarks)
+	wantNames := map[string]string{
+		"BenchmarkFoo/a-b": "BenchmarkFoo_a_b_" + nameHash("BenchmarkFoo/a-b"),
+		"BenchmarkFoo/a_b": "BenchmarkFoo_a_b_" + nameHash("BenchmarkFoo/a_b"),
+		"BenchmarkFoo_a_b": "BenchmarkFoo_a_b",
+		"BenchmarkBar-8":   "BenchmarkBar_8",
+		"BenchmarkX":       "BenchmarkX",
+		"BenchmarkX_hits":  "BenchmarkX_hits_" + nameHash("BenchmarkX_hits"),
+		"BenchmarkY":       "BenchmarkY",
+		"BenchmarkY/hits":  "BenchmarkY_hits_" + nameHash("BenchmarkY/hits"),
+	}
+	if diff := cmp.Diff(wantNames, names); diff != "" {
+		t.Errorf("assignMetricNames names [-want +got]:\n%s", diff)
+	}
+	wantRenames := []Rename{
+		{Benchmark: "BenchmarkBar-8", MetricName: "BenchmarkBar_8"},
+		{Benchmark: "BenchmarkFoo/a-b", MetricName: wantNames["BenchmarkFoo/a-b"], Collision: true},
+		{Benchmark: "BenchmarkFoo/a_b", MetricName: wantNames["BenchmarkFoo/a_b"], Collision: true},
+		{Benchmark: "BenchmarkX_hits", MetricName: wantNames["BenchmarkX_hits"], Collision: true},
+		{Benchmark: "BenchmarkY/hits", MetricName: wantNames["BenchmarkY/hits"], Collision: true},
+	}
+	if diff := cmp.Diff(wantRenames, renames); diff != "" {
+		t.Errorf("assignMetricNames renames [-want +got]:\n%s", diff)
+	}
+}
+
+func TestEscapeName(t *testing.T) {
+	names := []struct {
+		in   string
+		want string
+	}{
+		{"BenchmarkFoo", "BenchmarkFoo"},
+		{"BenchmarkFoo/a-b", "U__BenchmarkFoo_2f_a_2d_b"},
+		{"BenchmarkFoo/a_b", "U__BenchmarkFoo_2f_a__b"},
+		{"BenchmarkFoo/größe=1", "U__BenchmarkFoo_2f_gr_f6__df_e_3d_1"},
+	}
+
+	for _, n := range names {
+		got := escapeName(n.in)
+		if got != n.want {
+			t.Errorf("escapeName(%q) = %q, want %q", n.in, got, n.want)
+		}
+		orig, err := UnescapeName(got)
+		if err != nil {
+			t.Errorf("UnescapeName(%q): %v", got, err)
+		} else if orig != n.in {
+			t.Errorf("UnescapeName(%q) = %q, want %q", got, orig, n.in)
+		}
+	}
+
+	if _, err := UnescapeName("U__Foo_2f"); err == nil {
+		t.Errorf("UnescapeName: want an error for unterminated escape sequence, got nil")
+	}
+}
+
+func TestCollectCollidingNames(t *testing.T) {
+	in := `
+		BenchmarkFoo/a-b-8   	   17461	     69022 ns/op
+		BenchmarkFoo/a_b-8   	   17461	     42000 ns/op
+	`
+
+	c := NewGoBenchCollector(strings.NewReader(in))
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	if _, err := reg.Gather(); err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	if got := len(c.Renames()); got != 2 {
+		t.Errorf("Renames: got %d renames, want 2", got)
+	}
+}
+
+func TestCollectCollidingMetricNames(t *testing.T) {
+	in := `
+		BenchmarkX        	   17461	     69022 ns/op	  3 hits/op
+		BenchmarkX_hits   	   17461	     42000 ns/op	  4 per_op
+	`
+
+	c := NewGoBenchCollector(strings.NewReader(in))
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	if _, err := reg.Gather(); err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+}
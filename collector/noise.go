@@ -0,0 +1,106 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tklauser/gobench_exporter/bench"
+	"github.com/tklauser/gobench_exporter/regression"
+)
+
+// NoiseCollector exports the variation of the samples of benchmarks in the most recent run of
+// each target and variant.
+type NoiseCollector struct {
+	opts regression.NoiseOptions
+
+	mu    sync.Mutex
+	noise map[measurementKey]regression.Noise
+
+	cvDesc         *prometheus.Desc
+	rangeRatioDesc *prometheus.Desc
+	trendDesc      *prometheus.Desc
+	unreliableDesc *prometheus.Desc
+}
+
+// NewNoiseCollector returns a collector marking benchmarks exceeding the thresholds in opts as
+// unreliable.
+func NewNoiseCollector(opts regression.NoiseOptions) *NoiseCollector {
+	labels := []string{"target", "variant", "benchmark", "unit"}
+	return &NoiseCollector{
+		opts:  opts,
+		noise: make(map[measurementKey]regression.Noise),
+		cvDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "noise", "cv"),
+			"Coefficient of variation of the benchmark samples in the most recent run",
+			labels, nil,
+		),
+		rangeRatioDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "noise", "range_ratio"),
+			"Range of the benchmark samples in the most recent run divided by their median",
+			labels, nil,
+		),
+		trendDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "noise", "cv_trend"),
+			"Change of the coefficient of variation per run over the recent runs",
+			labels, nil,
+		),
+		unreliableDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "noise", "unreliable"),
+			"Whether the benchmark samples are too noisy for regression checks",
+			labels, nil,
+		),
+	}
+}
+
+// Update analyzes the noise of the benchmarks in bs of the variant (empty for targets without a
+// build matrix) of target, replacing earlier results of the same benchmarks of the variant.
+// recent holds earlier results of the same benchmarks in chronological order.
+func (c *NoiseCollector) Update(target, variant string, bs bench.Set, recent []bench.Set) {
+	noise := regression.AnalyzeNoise(bs, recent, c.opts)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, n := range noise {
+		c.noise[measurementKey{runKey{target, variant}, n.Name, n.Unit}] = n
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *NoiseCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.cvDesc
+	ch <- c.rangeRatioDesc
+	ch <- c.trendDesc
+	ch <- c.unreliableDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *NoiseCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, n := range c.noise {
+		unreliable := 0.0
+		if n.Unreliable {
+			unreliable = 1
+		}
+		gauge := func(desc *prometheus.Desc, v float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, k.target, k.variant, n.Name, n.Unit)
+		}
+		gauge(c.cvDesc, n.CV)
+		gauge(c.rangeRatioDesc, n.RangeRatio)
+		gauge(c.trendDesc, n.Trend)
+		gauge(c.unreliableDesc, unreliable)
+	}
+}
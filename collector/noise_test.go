@@ -0,0 +1,51 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tklauser/gobench_exporter/regression"
+)
+
+func TestNoiseCollector(t *testing.T) {
+	c := NewNoiseCollector(regression.DefaultNoiseOptions)
+	c.Update("foo", "", mustParseSet(t, `
+BenchmarkA 100 100 ns/op
+BenchmarkA 100 120 ns/op
+BenchmarkA 100 140 ns/op
+BenchmarkB 100 100 ns/op
+`), nil)
+	c.Update("foo", "goamd64=v3", mustParseSet(t, `
+BenchmarkA 100 100 ns/op
+BenchmarkA 100 100 ns/op
+`), nil)
+
+	want := `
+# HELP gobench_noise_cv Coefficient of variation of the benchmark samples in the most recent run
+# TYPE gobench_noise_cv gauge
+gobench_noise_cv{benchmark="BenchmarkA",target="foo",unit="ns/op",variant=""} 0.16666666666666666
+gobench_noise_cv{benchmark="BenchmarkA",target="foo",unit="ns/op",variant="goamd64=v3"} 0
+# HELP gobench_noise_unreliable Whether the benchmark samples are too noisy for regression checks
+# TYPE gobench_noise_unreliable gauge
+gobench_noise_unreliable{benchmark="BenchmarkA",target="foo",unit="ns/op",variant=""} 1
+gobench_noise_unreliable{benchmark="BenchmarkA",target="foo",unit="ns/op",variant="goamd64=v3"} 0
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "gobench_noise_cv", "gobench_noise_unreliable"); err != nil {
+		t.Error(err)
+	}
+}
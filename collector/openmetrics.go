@@ -0,0 +1,85 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Handler returns an http.Handler for the metrics gathered from g. Unlike promhttp.HandlerFor, it
+// adds `# UNIT` metadata for metrics with a unit as reported by unitOf if the scraper negotiates
+// the OpenMetrics exposition format.
+func Handler(g prometheus.Gatherer, unitOf func(fqName string) string) http.Handler {
+	h := promhttp.HandlerFor(g, promhttp.HandlerOpts{})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if expfmt.NegotiateIncludingOpenMetrics(r.Header) != expfmt.FmtOpenMetrics {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		mfs, err := g.Gather()
+		if err != nil {
+			http.Error(w, "An error has occurred while gathering metrics:\n\n"+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// Encode into a buffer first, so that an encoding error can still be reported in the
+		// status.
+		var buf bytes.Buffer
+		if err := writeOpenMetrics(&buf, mfs, unitOf); err != nil {
+			http.Error(w, "An error has occurred while encoding metrics:\n\n"+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", string(expfmt.FmtOpenMetrics))
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			log.Printf("Failed to write OpenMetrics: %v", err)
+		}
+	})
+}
+
+// writeOpenMetrics writes mfs to w in the OpenMetrics text format, inserting a `# UNIT` line after
+// the `# TYPE` line of each metric family with a unit.
+func writeOpenMetrics(w io.Writer, mfs []*dto.MetricFamily, unitOf func(fqName string) string) error {
+	var buf bytes.Buffer
+	for _, mf := range mfs {
+		buf.Reset()
+		if _, err := expfmt.MetricFamilyToOpenMetrics(&buf, mf); err != nil {
+			return err
+		}
+		out := buf.Bytes()
+		if u := unitOf(mf.GetName()); u != "" {
+			typeLine := []byte("# TYPE " + mf.GetName() + " ")
+			if i := bytes.Index(out, typeLine); i >= 0 {
+				if j := bytes.IndexByte(out[i:], '\n'); j >= 0 {
+					j += i + 1
+					unitLine := "# UNIT " + mf.GetName() + " " + u + "\n"
+					out = append(out[:j:j], append([]byte(unitLine), out[j:]...)...)
+				}
+			}
+		}
+		if _, err := w.Write(out); err != nil {
+			return err
+		}
+	}
+	_, err := expfmt.FinalizeOpenMetrics(w)
+	return err
+}
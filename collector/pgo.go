@@ -0,0 +1,80 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tklauser/gobench_exporter/regression"
+)
+
+// PGOCollector exports the change of the benchmark results of the most recent run of each target
+// and variant when built with a PGO profile generated from the run's CPU profiles.
+type PGOCollector struct {
+	mu      sync.Mutex
+	results map[runKey][]regression.Result
+
+	changeDesc *prometheus.Desc
+	pValueDesc *prometheus.Desc
+}
+
+// NewPGOCollector returns a collector without any results.
+func NewPGOCollector() *PGOCollector {
+	labels := []string{"target", "variant", "benchmark", "unit"}
+	return &PGOCollector{
+		results: make(map[runKey][]regression.Result),
+		changeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "pgo", "change_ratio"),
+			"Relative change of the benchmark median when built with profile-guided optimization",
+			labels, nil,
+		),
+		pValueDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "pgo", "p_value"),
+			"p-value of the Mann-Whitney U test comparing the samples without and with profile-guided optimization",
+			labels, nil,
+		),
+	}
+}
+
+// Set replaces the comparison of the results without (old) and with (new) PGO of the variant
+// (empty for targets without a build matrix) of target.
+func (c *PGOCollector) Set(target, variant string, results []regression.Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results[runKey{target, variant}] = results
+}
+
+// Describe implements prometheus.Collector.
+func (c *PGOCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.changeDesc
+	ch <- c.pValueDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *PGOCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, results := range c.results {
+		for _, r := range results {
+			if r.Old.Median == 0 {
+				continue
+			}
+			change := (r.New.Median - r.Old.Median) / r.Old.Median
+			ch <- prometheus.MustNewConstMetric(c.changeDesc, prometheus.GaugeValue, change, k.target, k.variant, r.Name, r.Unit)
+			ch <- prometheus.MustNewConstMetric(c.pValueDesc, prometheus.GaugeValue, r.P, k.target, k.variant, r.Name, r.Unit)
+		}
+	}
+}
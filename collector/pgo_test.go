@@ -0,0 +1,42 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tklauser/gobench_exporter/regression"
+)
+
+func TestPGOCollector(t *testing.T) {
+	base := mustParseSet(t, "BenchmarkA 100 100 ns/op\nBenchmarkA 100 102 ns/op\nBenchmarkA 100 98 ns/op")
+	pgo := mustParseSet(t, "BenchmarkA 100 80 ns/op\nBenchmarkA 100 82 ns/op\nBenchmarkA 100 78 ns/op")
+	th := regression.DefaultThresholds()
+	c := NewPGOCollector()
+	c.Set("foo", "", regression.Check(base, pgo, th))
+	c.Set("bar", "go1.22", regression.Check(base, base, th))
+
+	want := `
+# HELP gobench_pgo_change_ratio Relative change of the benchmark median when built with profile-guided optimization
+# TYPE gobench_pgo_change_ratio gauge
+gobench_pgo_change_ratio{benchmark="BenchmarkA",target="bar",unit="ns/op",variant="go1.22"} 0
+gobench_pgo_change_ratio{benchmark="BenchmarkA",target="foo",unit="ns/op",variant=""} -0.2
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "gobench_pgo_change_ratio"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tklauser/gobench_exporter/profiles"
+)
+
+// ProfileTop holds the functions with the most flat CPU time in the CPU profile of a package or
+// benchmark.
+type ProfileTop struct {
+	Pkg       string
+	Benchmark string // empty if the profile covers all benchmarks of the package
+	Functions []profiles.Function
+}
+
+// ProfileCollector exports the functions with the most flat CPU time in the CPU profiles of the
+// most recent run of each target and variant.
+type ProfileCollector struct {
+	mu   sync.Mutex
+	tops map[runKey][]ProfileTop
+
+	flatDesc *prometheus.Desc
+}
+
+// NewProfileCollector returns a collector without any profiles.
+func NewProfileCollector() *ProfileCollector {
+	return &ProfileCollector{
+		tops: make(map[runKey][]ProfileTop),
+		flatDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "profile", "cpu_flat_seconds"),
+			"CPU time spent in the function itself in the CPU profile of the most recent run, for the functions with the most flat CPU time",
+			[]string{"target", "variant", "package", "benchmark", "function"}, nil,
+		),
+	}
+}
+
+// Set replaces the top functions of the CPU profiles of the variant (empty for targets without a
+// build matrix) of target. The flat samples of the functions are in nanoseconds.
+func (c *ProfileCollector) Set(target, variant string, tops []ProfileTop) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tops[runKey{target, variant}] = tops
+}
+
+// Describe implements prometheus.Collector.
+func (c *ProfileCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.flatDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *ProfileCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, tops := range c.tops {
+		for _, top := range tops {
+			for _, f := range top.Functions {
+				ch <- prometheus.MustNewConstMetric(c.flatDesc, prometheus.GaugeValue, f.Flat/1e9,
+					k.target, k.variant, top.Pkg, top.Benchmark, f.Name)
+			}
+		}
+	}
+}
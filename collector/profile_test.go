@@ -0,0 +1,42 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tklauser/gobench_exporter/profiles"
+)
+
+func TestProfileCollector(t *testing.T) {
+	c := NewProfileCollector()
+	c.Set("foo", "", []ProfileTop{
+		{Pkg: "example.com/a", Functions: []profiles.Function{{Name: "a.f", Flat: 2e9}, {Name: "a.g", Flat: 5e8}}},
+		{Pkg: "example.com/a", Benchmark: "BenchmarkF", Functions: []profiles.Function{{Name: "a.f", Flat: 1e9}}},
+	})
+
+	want := `
+# HELP gobench_profile_cpu_flat_seconds CPU time spent in the function itself in the CPU profile of the most recent run, for the functions with the most flat CPU time
+# TYPE gobench_profile_cpu_flat_seconds gauge
+gobench_profile_cpu_flat_seconds{benchmark="",function="a.f",package="example.com/a",target="foo",variant=""} 2
+gobench_profile_cpu_flat_seconds{benchmark="",function="a.g",package="example.com/a",target="foo",variant=""} 0.5
+gobench_profile_cpu_flat_seconds{benchmark="BenchmarkF",function="a.f",package="example.com/a",target="foo",variant=""} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tklauser/gobench_exporter/bench"
+	"gopkg.in/yaml.v2"
+)
+
+// Labels available to relabeling rules. Labels starting with "__" are removed after relabeling,
+// all others are attached to the exported metrics.
+const (
+	// BenchmarkNameLabel holds the benchmark name, including sub-benchmarks and GOMAXPROCS
+	// suffix.
+	BenchmarkNameLabel = "__name__"
+	// PackageLabel holds the import path of the benchmarked package.
+	PackageLabel = "__package__"
+	// ParamLabelPrefix is the prefix of labels holding sub-benchmark parameters, e.g.
+	// "__param_size" for "BenchmarkFoo/size=10".
+	ParamLabelPrefix = "__param_"
+	// ConfigLabelPrefix is the prefix of labels holding configuration keys preceding the
+	// benchmark in the output, e.g. "__config_goos".
+	ConfigLabelPrefix = "__config_"
+)
+
+// RelabelAction is the action performed by a relabeling rule.
+type RelabelAction string
+
+// Relabeling actions, see
+// https://prometheus.io/docs/prometheus/latest/configuration/configuration/#relabel_config
+const (
+	RelabelReplace  RelabelAction = "replace"
+	RelabelKeep     RelabelAction = "keep"
+	RelabelDrop     RelabelAction = "drop"
+	RelabelLabelMap RelabelAction = "labelmap"
+)
+
+// Regexp is a regular expression anchored at both ends, as used in Prometheus relabeling rules.
+type Regexp struct {
+	*regexp.Regexp
+	original string
+}
+
+// NewRegexp compiles an anchored regular expression.
+func NewRegexp(s string) (Regexp, error) {
+	re, err := regexp.Compile("^(?:" + s + ")$")
+	return Regexp{Regexp: re, original: s}, err
+}
+
+// MustNewRegexp is like NewRegexp but panics if the expression cannot be compiled.
+func MustNewRegexp(s string) Regexp {
+	re, err := NewRegexp(s)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// String returns the original, unanchored regular expression.
+func (re Regexp) String() string {
+	return re.original
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (re *Regexp) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	r, err := NewRegexp(s)
+	if err != nil {
+		return err
+	}
+	*re = r
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (re Regexp) MarshalYAML() (interface{}, error) {
+	return re.original, nil
+}
+
+// RelabelConfig is a Prometheus-style relabeling rule applied to benchmarks before they are
+// exported.
+type RelabelConfig struct {
+	SourceLabels []string      `yaml:"source_labels,flow,omitempty"`
+	Separator    string        `yaml:"separator,omitempty"`
+	Regex        Regexp        `yaml:"regex,omitempty"`
+	TargetLabel  string        `yaml:"target_label,omitempty"`
+	Replacement  string        `yaml:"replacement,omitempty"`
+	Action       RelabelAction `yaml:"action,omitempty"`
+}
+
+// DefaultRelabelConfig is the default relabeling rule.
+var DefaultRelabelConfig = RelabelConfig{
+	Separator:   ";",
+	Regex:       MustNewRegexp("(.*)"),
+	Replacement: "$1",
+	Action:      RelabelReplace,
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (c *RelabelConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*c = DefaultRelabelConfig
+	type plain RelabelConfig
+	if err := unmarshal((*plain)(c)); err != nil {
+		return err
+	}
+	return c.Validate()
+}
+
+// Validate checks the relabeling rule for consistency.
+func (c *RelabelConfig) Validate() error {
+	if c.Regex.Regexp == nil {
+		c.Regex = DefaultRelabelConfig.Regex
+	}
+	switch c.Action {
+	case RelabelReplace:
+		if c.TargetLabel == "" {
+			return fmt.Errorf("relabel action %q requires target_label", c.Action)
+		}
+	case RelabelKeep, RelabelDrop, RelabelLabelMap:
+	default:
+		return fmt.Errorf("unknown relabel action %q", c.Action)
+	}
+	return nil
+}
+
+// LoadRelabelConfigs reads a list of relabeling rules from a YAML file.
+func LoadRelabelConfigs(filename string) ([]*RelabelConfig, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var cfgs []*RelabelConfig
+	if err := yaml.UnmarshalStrict(content, &cfgs); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", filename, err)
+	}
+	return cfgs, nil
+}
+
+// benchmarkLabels returns the labels describing b for relabeling.
+func benchmarkLabels(b *bench.Benchmark) map[string]string {
+	labels := map[string]string{
+		BenchmarkNameLabel: b.Name,
+	}
+	if b.Pkg != "" {
+		labels[PackageLabel] = b.Pkg
+	}
+	_, params, _ := bench.ParseName(b.Name)
+	for k, v := range params {
+		labels[ParamLabelPrefix+sanitizeLabelName(k)] = v
+	}
+	for k, v := range b.Config {
+		labels[ConfigLabelPrefix+sanitizeLabelName(k)] = v
+	}
+	return labels
+}
+
+func sanitizeLabelName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ':' {
+			return '_'
+		}
+		return validPrometheusMetricName(r)
+	}, s)
+}
+
+// relabel applies cfgs to labels in order. It returns nil if the benchmark is to be dropped.
+func relabel(labels map[string]string, cfgs []*RelabelConfig) map[string]string {
+	for _, cfg := range cfgs {
+		values := make([]string, 0, len(cfg.SourceLabels))
+		for _, ln := range cfg.SourceLabels {
+			values = append(values, labels[ln])
+		}
+		val := strings.Join(values, cfg.Separator)
+
+		switch cfg.Action {
+		case RelabelKeep:
+			if !cfg.Regex.MatchString(val) {
+				return nil
+			}
+		case RelabelDrop:
+			if cfg.Regex.MatchString(val) {
+				return nil
+			}
+		case RelabelReplace:
+			indexes := cfg.Regex.FindStringSubmatchIndex(val)
+			if indexes == nil {
+				break
+			}
+			target := string(cfg.Regex.ExpandString(nil, cfg.TargetLabel, val, indexes))
+			res := string(cfg.Regex.ExpandString(nil, cfg.Replacement, val, indexes))
+			if res == "" {
+				delete(labels, target)
+			} else {
+				labels[target] = res
+			}
+		case RelabelLabelMap:
+			mapped := make(map[string]string)
+			for ln, lv := range labels {
+				if cfg.Regex.MatchString(ln) {
+					mapped[cfg.Regex.ReplaceAllString(ln, cfg.Replacement)] = lv
+				}
+			}
+			for ln, lv := range mapped {
+				labels[ln] = lv
+			}
+		}
+	}
+	return labels
+}
+
+// exportedLabels returns the labels attached to exported metrics, i.e. all labels with a valid
+// name not starting with "__" and a non-empty value, along with a string uniquely identifying
+// them. The "name" label is reserved for the benchmark name in gobench_benchmarks.
+func exportedLabels(labels map[string]string) (prometheus.Labels, string) {
+	var names []string
+	for ln, lv := range labels {
+		if ln != "" && ln != "name" && !strings.HasPrefix(ln, "__") && sanitizeLabelName(ln) == ln && lv != "" {
+			names = append(names, ln)
+		}
+	}
+	sort.Strings(names)
+	res := make(prometheus.Labels, len(names))
+	var id strings.Builder
+	for _, ln := range names {
+		res[ln] = labels[ln]
+		fmt.Fprintf(&id, "%s=%q,", ln, labels[ln])
+	}
+	return res, id.String()
+}
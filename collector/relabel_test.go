@@ -0,0 +1,109 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v2"
+)
+
+const relabelConfigYAML = `
+# Stitch a benchmark renamed during a refactoring to its old name.
+- source_labels: [__name__]
+  regex: BenchmarkParseV2(.*)
+  target_label: __name__
+  replacement: BenchmarkParse$1
+# Move sub-benchmark parameters and the GOOS into labels.
+- source_labels: [__name__]
+  regex: ([^/]*)/.*
+  target_label: __name__
+- regex: __param_(.+)
+  action: labelmap
+- source_labels: [__config_goos]
+  target_label: goos
+- source_labels: [__package__]
+  regex: .*/internal/.*
+  action: drop
+`
+
+func TestRelabel(t *testing.T) {
+	var cfgs []*RelabelConfig
+	if err := yaml.UnmarshalStrict([]byte(relabelConfigYAML), &cfgs); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	in := `
+		goos: linux
+		pkg: example.com/foo
+		BenchmarkParseV2/size=10-8   	   17461	     69022 ns/op
+		BenchmarkParse/size=20-8   	   17461	     42000 ns/op
+		pkg: example.com/foo/internal/bar
+		BenchmarkBar-8   	   17461	     69022 ns/op
+	`
+	c := NewGoBenchCollectorWithOptions(Options{RelabelConfigs: cfgs})
+	c.Update(mustParseSet(t, in), Source{})
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	got := make(map[string][]map[string]string)
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			labels := make(map[string]string)
+			for _, lp := range m.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			got[mf.GetName()] = append(got[mf.GetName()], labels)
+		}
+	}
+
+	want := map[string][]map[string]string{
+		"gobench_series_dropped_total": {{}},
+		"gobench_benchmarks": {
+			{"name": "BenchmarkParse", "goos": "linux", "size": "10"},
+			{"name": "BenchmarkParse", "goos": "linux", "size": "20"},
+		},
+		"gobench_BenchmarkParse_iterations": {
+			{"goos": "linux", "size": "10"},
+			{"goos": "linux", "size": "20"},
+		},
+		"gobench_BenchmarkParse_seconds_per_op": {
+			{"goos": "linux", "size": "10"},
+			{"goos": "linux", "size": "20"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("exported metrics [-want +got]:\n%s", diff)
+	}
+}
+
+func TestRelabelConfigValidate(t *testing.T) {
+	for _, in := range []string{
+		"- action: replace",
+		"- action: hashmod\n  target_label: foo",
+		"- regex: '('\n  action: keep",
+	} {
+		var cfgs []*RelabelConfig
+		if err := yaml.UnmarshalStrict([]byte(in), &cfgs); err == nil {
+			t.Errorf("Unmarshal(%q): want an error, got nil", in)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tklauser/gobench_exporter/traces"
+)
+
+// TraceCollector exports the summaries of the execution traces of the most recent run of each
+// target and variant per package.
+type TraceCollector struct {
+	mu     sync.Mutex
+	traces map[runKey][]traces.Package
+
+	durationDesc        *prometheus.Desc
+	gcCyclesDesc        *prometheus.Desc
+	gcDesc              *prometheus.Desc
+	gcPauseDesc         *prometheus.Desc
+	stwDesc             *prometheus.Desc
+	goroutinesDesc      *prometheus.Desc
+	maxGoroutinesDesc   *prometheus.Desc
+	syscallDesc         *prometheus.Desc
+	schedLatencyDesc    *prometheus.Desc
+	schedWaitsDesc      *prometheus.Desc
+	maxSchedLatencyDesc *prometheus.Desc
+}
+
+// NewTraceCollector returns a collector without any trace summaries.
+func NewTraceCollector() *TraceCollector {
+	labels := []string{"target", "variant", "package"}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "trace", name), help, labels, nil)
+	}
+	return &TraceCollector{
+		traces:              make(map[runKey][]traces.Package),
+		durationDesc:        desc("duration_seconds", "Duration of the execution traces of the package in the most recent run"),
+		gcCyclesDesc:        desc("gc_cycles", "Number of garbage collection cycles in the execution traces of the package in the most recent run"),
+		gcDesc:              desc("gc_seconds", "Duration of the garbage collection cycles in the execution traces of the package in the most recent run"),
+		gcPauseDesc:         desc("gc_pause_seconds", "Time the world was stopped for garbage collection in the execution traces of the package in the most recent run"),
+		stwDesc:             desc("stw_seconds", "Time the world was stopped for any reason in the execution traces of the package in the most recent run"),
+		goroutinesDesc:      desc("goroutines_created", "Number of goroutines created in the execution traces of the package in the most recent run"),
+		maxGoroutinesDesc:   desc("max_goroutines", "Maximum number of goroutines existing at the same time in the execution traces of the package in the most recent run"),
+		syscallDesc:         desc("syscall_seconds", "Time goroutines spent in system calls in the execution traces of the package in the most recent run"),
+		schedLatencyDesc:    desc("sched_latency_seconds", "Time goroutines spent runnable before being scheduled in the execution traces of the package in the most recent run"),
+		schedWaitsDesc:      desc("sched_waits", "Number of times goroutines became runnable and were scheduled in the execution traces of the package in the most recent run"),
+		maxSchedLatencyDesc: desc("max_sched_latency_seconds", "Longest time a goroutine spent runnable before being scheduled in the execution traces of the package in the most recent run"),
+	}
+}
+
+// Set replaces the trace summaries of the variant (empty for targets without a build matrix) of
+// target.
+func (c *TraceCollector) Set(target, variant string, ts []traces.Package) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.traces[runKey{target, variant}] = ts
+}
+
+// Describe implements prometheus.Collector.
+func (c *TraceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.durationDesc
+	ch <- c.gcCyclesDesc
+	ch <- c.gcDesc
+	ch <- c.gcPauseDesc
+	ch <- c.stwDesc
+	ch <- c.goroutinesDesc
+	ch <- c.maxGoroutinesDesc
+	ch <- c.syscallDesc
+	ch <- c.schedLatencyDesc
+	ch <- c.schedWaitsDesc
+	ch <- c.maxSchedLatencyDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *TraceCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, ts := range c.traces {
+		for _, t := range ts {
+			gauge := func(desc *prometheus.Desc, v float64) {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, k.target, k.variant, t.Pkg)
+			}
+			gauge(c.durationDesc, t.Duration.Seconds())
+			gauge(c.gcCyclesDesc, float64(t.GCCycles))
+			gauge(c.gcDesc, t.GCTime.Seconds())
+			gauge(c.gcPauseDesc, t.GCPause.Seconds())
+			gauge(c.stwDesc, t.STW.Seconds())
+			gauge(c.goroutinesDesc, float64(t.Goroutines))
+			gauge(c.maxGoroutinesDesc, float64(t.MaxGoroutines))
+			gauge(c.syscallDesc, t.SyscallTime.Seconds())
+			gauge(c.schedLatencyDesc, t.SchedLatency.Seconds())
+			gauge(c.schedWaitsDesc, float64(t.SchedWaits))
+			gauge(c.maxSchedLatencyDesc, t.MaxSchedLatency.Seconds())
+		}
+	}
+}
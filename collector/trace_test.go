@@ -0,0 +1,53 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tklauser/gobench_exporter/traces"
+)
+
+func TestTraceCollector(t *testing.T) {
+	c := NewTraceCollector()
+	c.Set("foo", "", []traces.Package{
+		{Pkg: "example.com/a", Summary: traces.Summary{GCCycles: 9, GCPause: 650 * time.Microsecond, MaxGoroutines: 12}},
+	})
+	c.Set("foo", "goamd64=v3", []traces.Package{
+		{Pkg: "example.com/a", Summary: traces.Summary{GCCycles: 3, GCPause: 200 * time.Microsecond, MaxGoroutines: 4}},
+	})
+
+	want := `
+# HELP gobench_trace_gc_cycles Number of garbage collection cycles in the execution traces of the package in the most recent run
+# TYPE gobench_trace_gc_cycles gauge
+gobench_trace_gc_cycles{package="example.com/a",target="foo",variant=""} 9
+gobench_trace_gc_cycles{package="example.com/a",target="foo",variant="goamd64=v3"} 3
+# HELP gobench_trace_gc_pause_seconds Time the world was stopped for garbage collection in the execution traces of the package in the most recent run
+# TYPE gobench_trace_gc_pause_seconds gauge
+gobench_trace_gc_pause_seconds{package="example.com/a",target="foo",variant=""} 0.00065
+gobench_trace_gc_pause_seconds{package="example.com/a",target="foo",variant="goamd64=v3"} 0.0002
+# HELP gobench_trace_max_goroutines Maximum number of goroutines existing at the same time in the execution traces of the package in the most recent run
+# TYPE gobench_trace_max_goroutines gauge
+gobench_trace_max_goroutines{package="example.com/a",target="foo",variant=""} 12
+gobench_trace_max_goroutines{package="example.com/a",target="foo",variant="goamd64=v3"} 4
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"gobench_trace_gc_cycles", "gobench_trace_gc_pause_seconds", "gobench_trace_max_goroutines"); err != nil {
+		t.Error(err)
+	}
+}
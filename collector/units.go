@@ -0,0 +1,174 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/tklauser/gobench_exporter/bench"
+)
+
+// unit describes how a measurement reported in a Go benchmark unit (e.g. "ns/op") is exported.
+// All measurements are exported as gauges, so the suffix never ends in "_total".
+type unit struct {
+	suffix string  // metric name suffix, e.g. "seconds_per_op"
+	base   string  // OpenMetrics unit, empty for dimensionless measurements
+	scale  float64 // factor to convert the reported value to the exported unit
+}
+
+// siPrefixes maps SI and IEC binary prefixes to their scale factor. Two-letter prefixes are listed
+// first so they take precedence when matching.
+var siPrefixes = []struct {
+	prefix string
+	scale  float64
+}{
+	{"Ki", 1 << 10},
+	{"Mi", 1 << 20},
+	{"Gi", 1 << 30},
+	{"Ti", 1 << 40},
+	{"n", 1e-9},
+	{"u", 1e-6},
+	{"µ", 1e-6},
+	{"m", 1e-3},
+	{"k", 1e3},
+	{"K", 1e3},
+	{"M", 1e6},
+	{"G", 1e9},
+	{"T", 1e12},
+}
+
+// baseUnits maps unit symbols as used in Go benchmark output to Prometheus base units.
+var baseUnits = map[string]struct {
+	name  string
+	scale float64
+}{
+	"s": {"seconds", 1},
+	"B": {"bytes", 1},
+	"b": {"bytes", 1.0 / 8},
+}
+
+// iterationsSuffix is the metric name suffix used to export the number of iterations of a
+// benchmark.
+const iterationsSuffix = "iterations"
+
+// parseSymbol resolves an (optionally SI-prefixed) unit symbol to a Prometheus base unit. If the
+// symbol is not a known unit, ok is false.
+func parseSymbol(sym string) (name string, scale float64, ok bool) {
+	if b, ok := baseUnits[sym]; ok {
+		return b.name, b.scale, true
+	}
+	for _, p := range siPrefixes {
+		if !strings.HasPrefix(sym, p.prefix) {
+			continue
+		}
+		if b, ok := baseUnits[strings.TrimPrefix(sym, p.prefix)]; ok {
+			return b.name, p.scale * b.scale, true
+		}
+	}
+	return "", 0, false
+}
+
+// sanitizeUnit converts an unknown unit symbol into a metric name component.
+func sanitizeUnit(sym string) string {
+	return strings.ToLower(strings.Map(validPrometheusMetricName, sym))
+}
+
+// parseUnit normalizes a Go benchmark unit of the form "<numerator>/<denominator>" (e.g. "ns/op",
+// "MB/s" or custom units reported using testing.B.ReportMetric) to Prometheus base units.
+func parseUnit(u string) unit {
+	num, denom := u, ""
+	if i := strings.LastIndex(u, "/"); i >= 0 {
+		num, denom = u[:i], u[i+1:]
+	}
+
+	res := unit{scale: 1}
+	numName, scale, known := parseSymbol(num)
+	if known {
+		res.scale = scale
+	} else {
+		numName = sanitizeUnit(num)
+	}
+
+	var denomName string
+	switch denom {
+	case "":
+	case "op":
+		denomName = "op"
+	default:
+		if name, scale, ok := parseSymbol(denom); ok && name == "seconds" {
+			denomName = "second"
+			res.scale /= scale
+		} else {
+			denomName = sanitizeUnit(denom)
+		}
+	}
+
+	res.suffix = numName
+	if denomName != "" {
+		res.suffix += "_per_" + denomName
+	}
+	res.suffix = strings.TrimSuffix(res.suffix, "_total")
+	if known {
+		res.base = res.suffix
+	}
+	return res
+}
+
+// unitRank orders the measurement keys of a benchmark: iterations first, followed by the standard
+// units in the order printed by the testing package and then all other units.
+func unitRank(key string) int {
+	if key == "N" {
+		return 0
+	}
+	for i, u := range bench.StandardUnits {
+		if key == u {
+			return i + 1
+		}
+	}
+	return len(bench.StandardUnits) + 1
+}
+
+// unitSuffixes returns the metric name suffixes of the measurements ms of a benchmark, keyed by
+// unit. If several units map to the same suffix, e.g. MB/s and GB/s, the first one in the order
+// of unitRank (lexically for other units) keeps it and the others get a hash of their unit
+// inserted, so that the metric name still ends in the base unit. The disambiguated units are
+// returned as well.
+func unitSuffixes(ms []measurement) (map[string]string, []string) {
+	sorted := append([]measurement(nil), ms...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, rj := unitRank(sorted[i].key), unitRank(sorted[j].key)
+		if ri != rj {
+			return ri < rj
+		}
+		return sorted[i].key < sorted[j].key
+	})
+	suffixes := make(map[string]string, len(sorted))
+	taken := make(map[string]bool, len(sorted))
+	var disambiguated []string
+	for _, m := range sorted {
+		if _, ok := suffixes[m.key]; ok {
+			continue
+		}
+		suffix := m.unit.suffix
+		if taken[suffix] {
+			suffix = nameHash(m.key) + "_" + suffix
+			disambiguated = append(disambiguated, m.key)
+		}
+		taken[suffix] = true
+		suffixes[m.key] = suffix
+	}
+	return suffixes, disambiguated
+}
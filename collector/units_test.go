@@ -0,0 +1,152 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/tklauser/gobench_exporter/bench"
+)
+
+func TestParseUnit(t *testing.T) {
+	units := []struct {
+		in   string
+		want unit
+	}{
+		{"ns/op", unit{suffix: "seconds_per_op", base: "seconds_per_op", scale: 1e-9}},
+		{"B/op", unit{suffix: "bytes_per_op", base: "bytes_per_op", scale: 1}},
+		{"allocs/op", unit{suffix: "allocs_per_op", scale: 1}},
+		{"MB/s", unit{suffix: "bytes_per_second", base: "bytes_per_second", scale: 1e6}},
+		{"µs/op", unit{suffix: "seconds_per_op", base: "seconds_per_op", scale: 1e-6}},
+		{"KiB/ms", unit{suffix: "bytes_per_second", base: "bytes_per_second", scale: 1024 * 1e3}},
+		{"Mb/s", unit{suffix: "bytes_per_second", base: "bytes_per_second", scale: 1e6 / 8}},
+		{"pkts/s", unit{suffix: "pkts_per_second", scale: 1}},
+		{"ms/frame", unit{suffix: "seconds_per_frame", base: "seconds_per_frame", scale: 1e-3}},
+		{"Hits-Total", unit{suffix: "hits", scale: 1}},
+	}
+
+	for _, u := range units {
+		got := parseUnit(u.in)
+		if got.suffix != u.want.suffix || got.base != u.want.base || math.Abs(got.scale-u.want.scale) > 1e-9*u.want.scale {
+			t.Errorf("parseUnit(%q) = %+v, want %+v", u.in, got, u.want)
+		}
+	}
+}
+
+func TestOpenMetricsUnits(t *testing.T) {
+	in := `BenchmarkSortSlice-8   	   16818	     68854 ns/op	  14.87 MB/s	      64 B/op	       2 allocs/op`
+
+	c := NewGoBenchCollector(strings.NewReader(in))
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeOpenMetrics(&buf, mfs, c.Unit); err != nil {
+		t.Fatalf("writeOpenMetrics: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE gobench_BenchmarkSortSlice_8_seconds_per_op gauge\n# UNIT gobench_BenchmarkSortSlice_8_seconds_per_op seconds_per_op\n",
+		"# UNIT gobench_BenchmarkSortSlice_8_bytes_per_op bytes_per_op\n",
+		"# UNIT gobench_BenchmarkSortSlice_8_bytes_per_second bytes_per_second\n",
+		"gobench_BenchmarkSortSlice_8_bytes_per_second 1.487e+07\n",
+		"gobench_BenchmarkSortSlice_8_allocs_per_op 2.0\n",
+		"# EOF\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("OpenMetrics output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "# UNIT gobench_BenchmarkSortSlice_8_allocs_per_op") {
+		t.Errorf("OpenMetrics output contains unit for dimensionless metric:\n%s", out)
+	}
+}
+
+func TestCollectCollidingUnits(t *testing.T) {
+	in := `BenchmarkA 100 5 ns/op 3 MB/s 4 GB/s`
+	c := NewGoBenchCollector(strings.NewReader(in))
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(c)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	help := make(map[string]string)
+	for _, mf := range mfs {
+		help[mf.GetName()] = mf.GetHelp()
+	}
+	gbName := "gobench_BenchmarkA_" + nameHash("GB/s") + "_bytes_per_second"
+	for name, want := range map[string]string{
+		"gobench_BenchmarkA_bytes_per_second": "BenchmarkA MB/s",
+		gbName:                                "BenchmarkA GB/s",
+	} {
+		if help[name] != want {
+			t.Errorf("help of %s = %q, want %q", name, help[name], want)
+		}
+	}
+	if got := c.Unit(gbName); got != "bytes_per_second" {
+		t.Errorf("Unit(%q) = %q, want %q", gbName, got, "bytes_per_second")
+	}
+	want := []Rename{{Benchmark: "BenchmarkA", MetricName: "BenchmarkA_" + nameHash("GB/s") + "_bytes_per_second", Collision: true, Unit: "GB/s"}}
+	if diff := cmp.Diff(want, c.Renames()); diff != "" {
+		t.Errorf("Renames [-want +got]:\n%s", diff)
+	}
+
+	// The results of the same benchmark from another source must use the same metric names.
+	gb, err := bench.ParseSet(strings.NewReader("BenchmarkA 100 5 ns/op 4 GB/s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Update(gb, Source{Labels: map[string]string{"target": "other"}})
+	if _, err := reg.Gather(); err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+}
+
+func TestHandlerEncodingError(t *testing.T) {
+	gauge := dto.MetricType_GAUGE
+	name := func(s string) *string { return &s }
+	value := 1.0
+	g := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return []*dto.MetricFamily{
+			{Name: name("gobench_a"), Type: &gauge, Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: &value}}}},
+			// A gauge without value fails to encode after the first family.
+			{Name: name("gobench_b"), Type: &gauge, Metric: []*dto.Metric{{}}},
+		}, nil
+	})
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", string(expfmt.FmtOpenMetrics))
+	rec := httptest.NewRecorder()
+	Handler(g, func(string) string { return "" }).ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if strings.Contains(rec.Body.String(), "gobench_a") {
+		t.Errorf("body contains metrics despite the error:\n%s", rec.Body)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tklauser/gobench_exporter/runner"
+)
+
+// runKey identifies the most recent run of a variant of a target.
+type runKey struct {
+	target, variant string
+}
+
+// measurementKey identifies a benchmark measured in a unit in the most recent run of a variant of
+// a target.
+type measurementKey struct {
+	runKey
+	benchmark, unit string
+}
+
+// UsageCollector exports the resource usage of the test binaries of the most recent run of each
+// target and variant per package, including the summary of their garbage collections if traced.
+type UsageCollector struct {
+	mu     sync.Mutex
+	usages map[runKey][]runner.Usage
+
+	runsDesc        *prometheus.Desc
+	wallDesc        *prometheus.Desc
+	userDesc        *prometheus.Desc
+	systemDesc      *prometheus.Desc
+	maxRSSDesc      *prometheus.Desc
+	avgRSSDesc      *prometheus.Desc
+	maxThreadsDesc  *prometheus.Desc
+	voluntaryDesc   *prometheus.Desc
+	involuntaryDesc *prometheus.Desc
+
+	gcRunsDesc      *prometheus.Desc
+	gcCyclesDesc    *prometheus.Desc
+	gcForcedDesc    *prometheus.Desc
+	gcPauseDesc     *prometheus.Desc
+	gcMaxPauseDesc  *prometheus.Desc
+	gcMarkDesc      *prometheus.Desc
+	gcCPUDesc       *prometheus.Desc
+	gcCPURatioDesc  *prometheus.Desc
+	gcHeapStartDesc *prometheus.Desc
+	gcHeapEndDesc   *prometheus.Desc
+	gcHeapLiveDesc  *prometheus.Desc
+	gcMaxHeapDesc   *prometheus.Desc
+}
+
+// NewUsageCollector returns a collector without any resource usage.
+func NewUsageCollector() *UsageCollector {
+	labels := []string{"target", "variant", "package"}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "run", name), help, labels, nil)
+	}
+	return &UsageCollector{
+		usages:          make(map[runKey][]runner.Usage),
+		runsDesc:        desc("test_binary_runs", "Number of test binary runs of the package in the most recent run"),
+		wallDesc:        desc("wall_seconds", "Elapsed real time of the test binary runs of the package in the most recent run"),
+		userDesc:        desc("user_cpu_seconds", "User CPU time of the test binary runs of the package in the most recent run"),
+		systemDesc:      desc("system_cpu_seconds", "System CPU time of the test binary runs of the package in the most recent run"),
+		maxRSSDesc:      desc("max_rss_bytes", "Maximum resident set size of the test binary of the package in the most recent run"),
+		avgRSSDesc:      desc("avg_rss_bytes", "Average resident set size of the test binary of the package in the most recent run, sampled from /proc"),
+		maxThreadsDesc:  desc("max_threads", "Maximum number of threads of the test binary of the package in the most recent run, sampled from /proc"),
+		voluntaryDesc:   desc("voluntary_context_switches", "Voluntary context switches of the test binary runs of the package in the most recent run"),
+		involuntaryDesc: desc("involuntary_context_switches", "Involuntary context switches of the test binary runs of the package in the most recent run"),
+
+		gcRunsDesc:      desc("gc_traced_runs", "Number of test binary runs of the package with gctrace in the most recent run"),
+		gcCyclesDesc:    desc("gc_cycles", "Number of GC cycles of the test binary runs of the package in the most recent run"),
+		gcForcedDesc:    desc("gc_forced_cycles", "Number of forced GC cycles of the test binary runs of the package in the most recent run"),
+		gcPauseDesc:     desc("gc_pause_seconds", "Stop-the-world time of the GC cycles of the package in the most recent run"),
+		gcMaxPauseDesc:  desc("gc_max_pause_seconds", "Maximum stop-the-world time of a GC cycle of the package in the most recent run"),
+		gcMarkDesc:      desc("gc_mark_seconds", "Wall-clock time of the concurrent mark phases of the GC cycles of the package in the most recent run"),
+		gcCPUDesc:       desc("gc_cpu_seconds", "CPU time used by the GC in the test binary runs of the package in the most recent run"),
+		gcCPURatioDesc:  desc("gc_cpu_ratio", "Maximum fraction of the CPU time used by the GC in a test binary run of the package in the most recent run"),
+		gcHeapStartDesc: desc("gc_heap_start_bytes", "Average heap size at the start of the GC cycles of the package in the most recent run"),
+		gcHeapEndDesc:   desc("gc_heap_end_bytes", "Average heap size at the end of the GC cycles of the package in the most recent run"),
+		gcHeapLiveDesc:  desc("gc_heap_live_bytes", "Average live heap marked by the GC cycles of the package in the most recent run"),
+		gcMaxHeapDesc:   desc("gc_max_heap_bytes", "Maximum heap size at the end of a GC cycle of the package in the most recent run"),
+	}
+}
+
+// Set replaces the resource usage of the variant (empty for targets without a build matrix) of
+// target.
+func (c *UsageCollector) Set(target, variant string, us []runner.Usage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.usages[runKey{target, variant}] = us
+}
+
+// Describe implements prometheus.Collector.
+func (c *UsageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.runsDesc
+	ch <- c.wallDesc
+	ch <- c.userDesc
+	ch <- c.systemDesc
+	ch <- c.maxRSSDesc
+	ch <- c.avgRSSDesc
+	ch <- c.maxThreadsDesc
+	ch <- c.voluntaryDesc
+	ch <- c.involuntaryDesc
+	ch <- c.gcRunsDesc
+	ch <- c.gcCyclesDesc
+	ch <- c.gcForcedDesc
+	ch <- c.gcPauseDesc
+	ch <- c.gcMaxPauseDesc
+	ch <- c.gcMarkDesc
+	ch <- c.gcCPUDesc
+	ch <- c.gcCPURatioDesc
+	ch <- c.gcHeapStartDesc
+	ch <- c.gcHeapEndDesc
+	ch <- c.gcHeapLiveDesc
+	ch <- c.gcMaxHeapDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *UsageCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, us := range c.usages {
+		for _, u := range us {
+			gauge := func(desc *prometheus.Desc, v float64) {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, k.target, k.variant, u.Pkg)
+			}
+			gauge(c.runsDesc, float64(u.Runs))
+			gauge(c.wallDesc, u.Wall.Seconds())
+			gauge(c.userDesc, u.User.Seconds())
+			gauge(c.systemDesc, u.System.Seconds())
+			gauge(c.maxRSSDesc, float64(u.MaxRSS))
+			if u.AvgRSS > 0 {
+				gauge(c.avgRSSDesc, float64(u.AvgRSS))
+				gauge(c.maxThreadsDesc, float64(u.MaxThreads))
+			}
+			gauge(c.voluntaryDesc, float64(u.VoluntaryCtxSwitches))
+			gauge(c.involuntaryDesc, float64(u.InvoluntaryCtxSwitches))
+			if gc := u.GC; gc != nil {
+				gauge(c.gcRunsDesc, float64(gc.Runs))
+				gauge(c.gcCyclesDesc, float64(gc.Cycles))
+				gauge(c.gcForcedDesc, float64(gc.Forced))
+				gauge(c.gcPauseDesc, gc.Pause.Seconds())
+				gauge(c.gcMaxPauseDesc, gc.MaxPause.Seconds())
+				gauge(c.gcMarkDesc, gc.Mark.Seconds())
+				gauge(c.gcCPUDesc, gc.CPU.Seconds())
+				gauge(c.gcCPURatioDesc, gc.CPUPercent/100)
+				gauge(c.gcHeapStartDesc, float64(gc.AvgHeapStart))
+				gauge(c.gcHeapEndDesc, float64(gc.AvgHeapEnd))
+				gauge(c.gcHeapLiveDesc, float64(gc.AvgHeapLive))
+				gauge(c.gcMaxHeapDesc, float64(gc.MaxHeap))
+			}
+		}
+	}
+}
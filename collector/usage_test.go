@@ -0,0 +1,70 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tklauser/gobench_exporter/bench"
+	"github.com/tklauser/gobench_exporter/runner"
+)
+
+func TestUsageCollector(t *testing.T) {
+	c := NewUsageCollector()
+	c.Set("foo", "", []runner.Usage{
+		{
+			Pkg: "example.com/a", Runs: 2, Wall: 3 * time.Second, User: 2500 * time.Millisecond, MaxRSS: 1 << 20, InvoluntaryCtxSwitches: 42,
+			GC: &bench.GCSummary{Runs: 2, Cycles: 12, Pause: 3 * time.Millisecond, CPUPercent: 4, MaxHeap: 8 << 20},
+		},
+	})
+	c.Set("foo", "goamd64=v3", []runner.Usage{
+		{Pkg: "example.com/a", Runs: 1, Wall: time.Second, InvoluntaryCtxSwitches: 7},
+	})
+
+	want := `
+# HELP gobench_run_gc_cpu_ratio Maximum fraction of the CPU time used by the GC in a test binary run of the package in the most recent run
+# TYPE gobench_run_gc_cpu_ratio gauge
+gobench_run_gc_cpu_ratio{package="example.com/a",target="foo",variant=""} 0.04
+# HELP gobench_run_gc_cycles Number of GC cycles of the test binary runs of the package in the most recent run
+# TYPE gobench_run_gc_cycles gauge
+gobench_run_gc_cycles{package="example.com/a",target="foo",variant=""} 12
+# HELP gobench_run_gc_max_heap_bytes Maximum heap size at the end of a GC cycle of the package in the most recent run
+# TYPE gobench_run_gc_max_heap_bytes gauge
+gobench_run_gc_max_heap_bytes{package="example.com/a",target="foo",variant=""} 8.388608e+06
+# HELP gobench_run_gc_pause_seconds Stop-the-world time of the GC cycles of the package in the most recent run
+# TYPE gobench_run_gc_pause_seconds gauge
+gobench_run_gc_pause_seconds{package="example.com/a",target="foo",variant=""} 0.003
+# HELP gobench_run_involuntary_context_switches Involuntary context switches of the test binary runs of the package in the most recent run
+# TYPE gobench_run_involuntary_context_switches gauge
+gobench_run_involuntary_context_switches{package="example.com/a",target="foo",variant=""} 42
+gobench_run_involuntary_context_switches{package="example.com/a",target="foo",variant="goamd64=v3"} 7
+# HELP gobench_run_max_rss_bytes Maximum resident set size of the test binary of the package in the most recent run
+# TYPE gobench_run_max_rss_bytes gauge
+gobench_run_max_rss_bytes{package="example.com/a",target="foo",variant=""} 1.048576e+06
+gobench_run_max_rss_bytes{package="example.com/a",target="foo",variant="goamd64=v3"} 0
+# HELP gobench_run_wall_seconds Elapsed real time of the test binary runs of the package in the most recent run
+# TYPE gobench_run_wall_seconds gauge
+gobench_run_wall_seconds{package="example.com/a",target="foo",variant=""} 3
+gobench_run_wall_seconds{package="example.com/a",target="foo",variant="goamd64=v3"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"gobench_run_gc_cpu_ratio", "gobench_run_gc_cycles", "gobench_run_gc_max_heap_bytes", "gobench_run_gc_pause_seconds",
+		"gobench_run_involuntary_context_switches", "gobench_run_max_rss_bytes", "gobench_run_wall_seconds"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tklauser/gobench_exporter/regression"
+)
+
+// VariantComparison is the comparison of the benchmarks of two variants of a target's build
+// matrix, e.g. two Go toolchains.
+type VariantComparison struct {
+	Base, Head string
+	Results    []regression.Result
+}
+
+// VariantCollector exports the most recent cross-variant comparisons of each target as delta
+// gauges.
+type VariantCollector struct {
+	mu          sync.Mutex
+	comparisons map[string][]VariantComparison // keyed by target
+
+	changeDesc *prometheus.Desc
+	pValueDesc *prometheus.Desc
+}
+
+// NewVariantCollector returns a collector without any comparisons.
+func NewVariantCollector() *VariantCollector {
+	labels := []string{"target", "benchmark", "unit", "base", "head"}
+	return &VariantCollector{
+		comparisons: make(map[string][]VariantComparison),
+		changeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "variant", "change_ratio"),
+			"Relative change of the benchmark median from the base to the head variant of the build matrix",
+			labels, nil,
+		),
+		pValueDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "variant", "p_value"),
+			"p-value of the Mann-Whitney U test comparing the base and head variant samples",
+			labels, nil,
+		),
+	}
+}
+
+// Set replaces the comparisons of target.
+func (c *VariantCollector) Set(target string, comparisons []VariantComparison) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(comparisons) == 0 {
+		delete(c.comparisons, target)
+	} else {
+		c.comparisons[target] = comparisons
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *VariantCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.changeDesc
+	ch <- c.pValueDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *VariantCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for target, cmps := range c.comparisons {
+		for _, cmp := range cmps {
+			for _, r := range cmp.Results {
+				if r.Old.Median == 0 {
+					continue
+				}
+				change := (r.New.Median - r.Old.Median) / r.Old.Median
+				ch <- prometheus.MustNewConstMetric(c.changeDesc, prometheus.GaugeValue, change, target, r.Name, r.Unit, cmp.Base, cmp.Head)
+				ch <- prometheus.MustNewConstMetric(c.pValueDesc, prometheus.GaugeValue, r.P, target, r.Name, r.Unit, cmp.Base, cmp.Head)
+			}
+		}
+	}
+}
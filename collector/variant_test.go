@@ -0,0 +1,46 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tklauser/gobench_exporter/regression"
+)
+
+func TestVariantCollector(t *testing.T) {
+	base := mustParseSet(t, "BenchmarkA 100 100 ns/op\nBenchmarkA 100 102 ns/op\nBenchmarkA 100 98 ns/op")
+	head := mustParseSet(t, "BenchmarkA 100 90 ns/op\nBenchmarkA 100 92 ns/op\nBenchmarkA 100 88 ns/op")
+	th := regression.DefaultThresholds()
+	c := NewVariantCollector()
+	c.Set("foo", []VariantComparison{
+		{Base: "go1.21", Head: "go1.22", Results: regression.Check(base, head, th)},
+		{Base: "go1.21", Head: "go1.23", Results: regression.Check(base, base, th)},
+	})
+	c.Set("bar", []VariantComparison{{Base: "go1.21", Head: "go1.22", Results: regression.Check(base, head, th)}})
+	c.Set("bar", nil)
+
+	want := `
+# HELP gobench_variant_change_ratio Relative change of the benchmark median from the base to the head variant of the build matrix
+# TYPE gobench_variant_change_ratio gauge
+gobench_variant_change_ratio{base="go1.21",benchmark="BenchmarkA",head="go1.22",target="foo",unit="ns/op"} -0.1
+gobench_variant_change_ratio{base="go1.21",benchmark="BenchmarkA",head="go1.23",target="foo",unit="ns/op"} 0
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "gobench_variant_change_ratio"); err != nil {
+		t.Error(err)
+	}
+}
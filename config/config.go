@@ -0,0 +1,354 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config implements the YAML configuration file of gobench_exporter.
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/tklauser/gobench_exporter/collector"
+	"github.com/tklauser/gobench_exporter/runner"
+	"github.com/tklauser/gobench_exporter/sysenv"
+	"gopkg.in/yaml.v2"
+)
+
+// Config is the configuration of gobench_exporter.
+type Config struct {
+	Global   GlobalConfig        `yaml:"global,omitempty"`
+	Profiles map[string]*Profile `yaml:"profiles,omitempty"`
+	Targets  []*Target           `yaml:"targets,omitempty"`
+}
+
+// GlobalConfig configures the benchmarks exported from all targets.
+type GlobalConfig struct {
+	Filter         FilterConfig               `yaml:"filter,omitempty"`
+	SeriesLimit    int                        `yaml:"series_limit,omitempty"`
+	RelabelConfigs []*collector.RelabelConfig `yaml:"relabel_configs,omitempty"`
+	// BinaryCache is the default directory in which the compiled test binaries of targets are
+	// cached.
+	BinaryCache string `yaml:"binary_cache,omitempty"`
+	// ToolchainDir is a directory containing Go toolchains as <name>/bin/go, used to look up
+	// the toolchains of targets by name.
+	ToolchainDir string `yaml:"toolchain_dir,omitempty"`
+	// Preflight configures the checks whether the machine is quiet enough before running the
+	// benchmarks of a target.
+	Preflight *sysenv.Options `yaml:"preflight,omitempty"`
+	// Environment makes the exporter read the state of the machine before running the
+	// benchmarks of a target to record and export it, also without preflight checks.
+	Environment bool `yaml:"environment,omitempty"`
+	// Isolation is the default environment control of targets.
+	Isolation *runner.Isolation `yaml:"isolation,omitempty"`
+}
+
+// Profile is a named set of go test arguments, e.g. to distinguish quick from full runs.
+type Profile struct {
+	Bench  string            `yaml:"bench,omitempty"`   // regular expression selecting the benchmarks to run
+	GoArgs []string          `yaml:"go_args,omitempty"` // appended to the go test arguments of the target
+	Env    map[string]string `yaml:"env,omitempty"`     // added to the environment of the target
+	// Adaptive enables repeating each benchmark until its results are stable. Unset options
+	// take their default values.
+	Adaptive *runner.AdaptiveOptions `yaml:"adaptive,omitempty"`
+	// Profiling enables recording pprof profiles and execution traces of the benchmarks.
+	Profiling *ProfilingConfig `yaml:"profiling,omitempty"`
+	// GCTrace enables summarizing the garbage collections of the test binaries from their
+	// GODEBUG=gctrace=1 output.
+	GCTrace bool `yaml:"gctrace,omitempty"`
+}
+
+// DefaultProfilingTop is the default number of functions exported per CPU profile.
+const DefaultProfilingTop = 10
+
+// ProfilingConfig configures the recording of pprof profiles and execution traces.
+type ProfilingConfig struct {
+	runner.ProfilingOptions `yaml:",inline"`
+	// Top is the number of functions with the most flat CPU time exported per CPU profile.
+	Top int `yaml:"top,omitempty"`
+	// PGO enables generating profile-guided optimization profiles from the CPU profiles.
+	PGO *PGOConfig `yaml:"pgo,omitempty"`
+}
+
+// PGOConfig configures generating profile-guided optimization profiles from the CPU profiles
+// recorded while benchmarking and measuring their effect by running the benchmarks again.
+type PGOConfig struct {
+	// OutputDir is the directory the PGO profile of each main package of a target is written to,
+	// as <target>[/<variant>]/<import path>/default.pgo. If empty, the profiles are not kept.
+	OutputDir string `yaml:"output_dir,omitempty"`
+}
+
+// Target is a Go module or package directory to benchmark.
+type Target struct {
+	Name     string            `yaml:"name"`
+	RepoPath string            `yaml:"repo_path"`
+	Packages []string          `yaml:"packages,omitempty"`
+	GoArgs   []string          `yaml:"go_args,omitempty"`
+	Env      map[string]string `yaml:"env,omitempty"`
+	// Schedule is the interval in which the benchmarks are run. Zero disables scheduled runs.
+	Schedule time.Duration     `yaml:"schedule,omitempty"`
+	Profile  string            `yaml:"profile,omitempty"` // profile used for scheduled runs
+	Filter   FilterConfig      `yaml:"filter,omitempty"`
+	Labels   map[string]string `yaml:"labels,omitempty"` // attached to all exported benchmarks
+	// BinaryCache is the directory in which compiled test binaries are cached, defaults to the
+	// global binary_cache.
+	BinaryCache string `yaml:"binary_cache,omitempty"`
+	// Toolchains are the Go toolchains to run the benchmarks with, each given as the path of a
+	// go binary or a toolchain name (e.g. "go1.22.0"). Empty means the go command in $PATH.
+	Toolchains []string `yaml:"toolchains,omitempty"`
+	// Matrix lists further build configurations to run the benchmarks with.
+	Matrix *BuildMatrix `yaml:"matrix,omitempty"`
+	// Isolation controls the environment the benchmarks run in, defaults to the global
+	// isolation.
+	Isolation *runner.Isolation `yaml:"isolation,omitempty"`
+}
+
+// FilterConfig selects benchmarks by unanchored regular expressions on names and packages.
+type FilterConfig struct {
+	IncludeBenchmarks string `yaml:"include_benchmarks,omitempty"`
+	ExcludeBenchmarks string `yaml:"exclude_benchmarks,omitempty"`
+	IncludePackages   string `yaml:"include_packages,omitempty"`
+	ExcludePackages   string `yaml:"exclude_packages,omitempty"`
+}
+
+// Filter compiles the filter configuration.
+func (f FilterConfig) Filter() (collector.Filter, error) {
+	var res collector.Filter
+	for _, re := range []struct {
+		expr   string
+		target **regexp.Regexp
+	}{
+		{f.IncludeBenchmarks, &res.IncludeNames},
+		{f.ExcludeBenchmarks, &res.ExcludeNames},
+		{f.IncludePackages, &res.IncludePackages},
+		{f.ExcludePackages, &res.ExcludePackages},
+	} {
+		if re.expr == "" {
+			continue
+		}
+		compiled, err := regexp.Compile(re.expr)
+		if err != nil {
+			return collector.Filter{}, err
+		}
+		*re.target = compiled
+	}
+	return res, nil
+}
+
+// envList converts an environment map into a sorted list of "key=value" pairs.
+func envList(env map[string]string) []string {
+	var res []string
+	for k, v := range env {
+		res = append(res, k+"="+v)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// RunnerTarget returns the target to pass to the runner when running the benchmarks with profile
+// p, which may be nil. It also returns the regular expression selecting the benchmarks to run.
+func (t *Target) RunnerTarget(p *Profile) (runner.Target, string) {
+	rt := runner.Target{
+		Name:      t.Name,
+		RepoPath:  t.RepoPath,
+		Packages:  t.Packages,
+		GoArgs:    append([]string(nil), t.GoArgs...),
+		Env:       envList(t.Env),
+		CacheDir:  t.BinaryCache,
+		Isolation: t.Isolation,
+	}
+	if p == nil {
+		return rt, ""
+	}
+	rt.GoArgs = append(rt.GoArgs, p.GoArgs...)
+	rt.Env = append(rt.Env, envList(p.Env)...)
+	rt.Adaptive = p.Adaptive
+	rt.GCTrace = p.GCTrace
+	if p.Profiling != nil {
+		opts := p.Profiling.ProfilingOptions
+		rt.Profiling = &opts
+	}
+	return rt, p.Bench
+}
+
+// Source returns the collector source for the benchmarks of the target.
+func (t *Target) Source() collector.Source {
+	// The filter was validated when loading the configuration.
+	f, _ := t.Filter.Filter()
+	return collector.Source{Filter: f, Labels: t.Labels}
+}
+
+// Target returns the target with the given name, or nil if there is none.
+func (c *Config) Target(name string) *Target {
+	for _, t := range c.Targets {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// Profile returns the profile with the given name. The empty name denotes the default profile,
+// for which nil is returned.
+func (c *Config) Profile(name string) (*Profile, error) {
+	if name == "" {
+		return nil, nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q", name)
+	}
+	return p, nil
+}
+
+// CollectorOptions returns the collector options as configured in the global section.
+func (c *Config) CollectorOptions(escaping collector.NameEscaping) collector.Options {
+	// The filter was validated when loading the configuration.
+	f, _ := c.Global.Filter.Filter()
+	return collector.Options{
+		NameEscaping:   escaping,
+		Filter:         f,
+		SeriesLimit:    c.Global.SeriesLimit,
+		RelabelConfigs: c.Global.RelabelConfigs,
+	}
+}
+
+// Validate checks the configuration for consistency.
+func (c *Config) Validate() error {
+	if _, err := c.Global.Filter.Filter(); err != nil {
+		return fmt.Errorf("invalid global filter: %v", err)
+	}
+	if c.Global.SeriesLimit < 0 {
+		return fmt.Errorf("series_limit must not be negative")
+	}
+	if c.Global.Preflight != nil {
+		if err := c.Global.Preflight.Validate(); err != nil {
+			return fmt.Errorf("invalid preflight options: %v", err)
+		}
+	}
+	if err := validateIsolation(c.Global.Isolation); err != nil {
+		return fmt.Errorf("invalid global isolation: %v", err)
+	}
+	for name, p := range c.Profiles {
+		if p == nil {
+			return fmt.Errorf("profile %q is empty", name)
+		}
+		if _, err := regexp.Compile(p.Bench); err != nil {
+			return fmt.Errorf("invalid bench expression in profile %q: %v", name, err)
+		}
+		if a := p.Adaptive; a != nil {
+			if a.MinRuns == 0 {
+				a.MinRuns = runner.DefaultAdaptiveOptions.MinRuns
+			}
+			if a.MaxRuns == 0 {
+				a.MaxRuns = runner.DefaultAdaptiveOptions.MaxRuns
+			}
+			if a.TargetCI == 0 {
+				a.TargetCI = runner.DefaultAdaptiveOptions.TargetCI
+			}
+			if a.MinRuns < 1 || a.MaxRuns < a.MinRuns || a.TargetCI < 0 || a.MaxTime < 0 {
+				return fmt.Errorf("invalid adaptive options in profile %q", name)
+			}
+		}
+		if pc := p.Profiling; pc != nil {
+			if pc.Top == 0 {
+				pc.Top = DefaultProfilingTop
+			}
+			if !pc.CPU && !pc.Mem && !pc.Trace || pc.Top < 0 {
+				return fmt.Errorf("invalid profiling options in profile %q: enable cpu or mem profiles or traces", name)
+			}
+			if pc.PGO != nil && !pc.CPU {
+				return fmt.Errorf("invalid profiling options in profile %q: pgo requires cpu profiles", name)
+			}
+		}
+	}
+	seen := make(map[string]bool, len(c.Targets))
+	for i, t := range c.Targets {
+		if t == nil || t.Name == "" {
+			return fmt.Errorf("target %d has no name", i)
+		}
+		if seen[t.Name] {
+			return fmt.Errorf("duplicate target %q", t.Name)
+		}
+		seen[t.Name] = true
+		if t.RepoPath == "" {
+			return fmt.Errorf("target %q has no repo_path", t.Name)
+		}
+		if t.Schedule < 0 {
+			return fmt.Errorf("target %q has a negative schedule", t.Name)
+		}
+		if _, err := c.Profile(t.Profile); err != nil {
+			return fmt.Errorf("target %q: %v", t.Name, err)
+		}
+		if _, err := t.Filter.Filter(); err != nil {
+			return fmt.Errorf("invalid filter in target %q: %v", t.Name, err)
+		}
+		if err := validateMatrix(t); err != nil {
+			return err
+		}
+		if t.Isolation == nil {
+			t.Isolation = c.Global.Isolation
+		} else if err := validateIsolation(t.Isolation); err != nil {
+			return fmt.Errorf("invalid isolation in target %q: %v", t.Name, err)
+		}
+		if t.BinaryCache == "" {
+			t.BinaryCache = c.Global.BinaryCache
+		}
+	}
+	return nil
+}
+
+// Parse parses and validates a YAML configuration.
+func Parse(content []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(content, cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Load reads, parses and validates the configuration file with the given name.
+func Load(filename string) (*Config, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", filename, err)
+	}
+	return cfg, nil
+}
+
+// validateIsolation checks the environment control options i, which may be nil.
+func validateIsolation(i *runner.Isolation) error {
+	switch {
+	case i == nil:
+		return nil
+	case i.Nice < -20 || i.Nice > 19:
+		return fmt.Errorf("nice must be between -20 and 19")
+	case i.IONiceClass < 0 || i.IONiceClass > 3:
+		return fmt.Errorf("ionice_class must be between 0 and 3 (0 keeps the default)")
+	case i.IONiceLevel < 0 || i.IONiceLevel > 7:
+		return fmt.Errorf("ionice_level must be between 0 and 7")
+	case i.GOMAXPROCS < 0:
+		return fmt.Errorf("gomaxprocs must not be negative")
+	}
+	return nil
+}
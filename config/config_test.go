@@ -0,0 +1,232 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tklauser/gobench_exporter/config"
+	"github.com/tklauser/gobench_exporter/runner"
+)
+
+const exampleConfig = `
+global:
+  series_limit: 10000
+  binary_cache: /var/cache/gobench
+  preflight:
+    max_load: 2
+    governor: performance
+  isolation:
+    cpus: 2-3
+    gomaxprocs: 2
+  filter:
+    exclude_packages: /internal/
+profiles:
+  quick:
+    bench: Parse
+    go_args: [-benchtime=100ms]
+    adaptive:
+      target_ci: 0.05
+      max_time: 1m
+  full:
+    go_args: [-count=10]
+    env:
+      GOGC: "off"
+    profiling:
+      cpu: true
+      per_benchmark: true
+    gctrace: true
+targets:
+  - name: foo
+    repo_path: /src/foo
+    packages: [./...]
+    env:
+      GOMAXPROCS: "4"
+    schedule: 1h
+    profile: quick
+    labels:
+      team: network
+`
+
+func TestParse(t *testing.T) {
+	cfg, err := config.Parse([]byte(exampleConfig))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	foo := cfg.Target("foo")
+	if foo == nil {
+		t.Fatalf("Target(%q) = nil", "foo")
+	}
+	if foo.Schedule != time.Hour {
+		t.Errorf("Schedule = %v, want %v", foo.Schedule, time.Hour)
+	}
+	p, err := cfg.Profile("full")
+	if err != nil {
+		t.Fatalf("Profile: %v", err)
+	}
+	got, benchRegex := foo.RunnerTarget(p)
+	want := runner.Target{
+		Name:      "foo",
+		RepoPath:  "/src/foo",
+		Packages:  []string{"./..."},
+		GoArgs:    []string{"-count=10"},
+		Env:       []string{"GOMAXPROCS=4", "GOGC=off"},
+		CacheDir:  "/var/cache/gobench",
+		Isolation: &runner.Isolation{CPUs: "2-3", GOMAXPROCS: 2},
+		Profiling: &runner.ProfilingOptions{CPU: true, PerBenchmark: true},
+		GCTrace:   true,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("RunnerTarget [-want +got]:\n%s", diff)
+	}
+	if benchRegex != "" {
+		t.Errorf("RunnerTarget bench = %q, want empty", benchRegex)
+	}
+	quick, err := cfg.Profile("quick")
+	if err != nil {
+		t.Fatalf("Profile: %v", err)
+	}
+	wantAdaptive := &runner.AdaptiveOptions{MinRuns: 3, MaxRuns: 20, TargetCI: 0.05, MaxTime: time.Minute}
+	if diff := cmp.Diff(wantAdaptive, quick.Adaptive); diff != "" {
+		t.Errorf("Adaptive [-want +got]:\n%s", diff)
+	}
+	if top := p.Profiling.Top; top != config.DefaultProfilingTop {
+		t.Errorf("Profiling top = %d, want %d", top, config.DefaultProfilingTop)
+	}
+	if pf := cfg.Global.Preflight; pf.MaxLoad != 2 || pf.Governor != "performance" || pf.Action != "delay" {
+		t.Errorf("Preflight = %+v, want max_load 2, governor performance and default action delay", pf)
+	}
+	if src := foo.Source(); src.Labels["team"] != "network" {
+		t.Errorf("Source labels = %v, want team=network", src.Labels)
+	}
+	if opts := cfg.CollectorOptions(0); opts.SeriesLimit != 10000 || opts.Filter.Match("example.com/internal/foo", "BenchmarkFoo") {
+		t.Errorf("CollectorOptions = %+v", opts)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, in := range []string{
+		"targets: [{repo_path: /src/foo}]",
+		"targets: [{name: foo}]",
+		"targets: [{name: foo, repo_path: /a}, {name: foo, repo_path: /b}]",
+		"targets: [{name: foo, repo_path: /a, profile: quick}]",
+		"targets: [{name: foo, repo_path: /a, filter: {include_benchmarks: '('}}]",
+		"global: {series_limit: -1}",
+		"profiles: {quick: {bench: '('}}",
+		"profiles: {quick: {adaptive: {min_runs: 5, max_runs: 2}}}",
+		"profiles: {quick: {profiling: {per_benchmark: true}}}",
+		"profiles: {quick: {profiling: {mem: true, pgo: {}}}}",
+		"targets: [{name: foo, repo_path: /a, toolchains: [go1.22.0, go1.22.0]}]",
+		"targets: [{name: foo, repo_path: /a, matrix: {goamd64: [v5]}}]",
+		"targets: [{name: foo, repo_path: /a, matrix: {cgo_enabled: ['1', '1']}}]",
+		"global: {preflight: {action: retry}}",
+		"targets: [{name: foo, repo_path: /a, isolation: {ionice_class: 4}}]",
+		"unknown_field: 1",
+	} {
+		if _, err := config.Parse([]byte(in)); err == nil {
+			t.Errorf("Parse(%q): want an error, got nil", in)
+		}
+	}
+}
+
+func TestVariants(t *testing.T) {
+	dir, err := ioutil.TempDir("", "toolchains")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	goBinary := filepath.Join(dir, "go1.99.0", "bin", "go")
+	if err := os.MkdirAll(filepath.Dir(goBinary), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(goBinary, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.Parse([]byte(`
+global:
+  toolchain_dir: ` + dir + `
+targets:
+  - name: foo
+    repo_path: /src/foo
+    env:
+      GOGC: "off"
+    toolchains: [go1.99.0, /opt/go/bin/go, go1.22.0]
+  - name: bar
+    repo_path: /src/bar
+  - name: baz
+    repo_path: /src/baz
+    go_args: [-benchmem]
+    toolchains: [/opt/go/bin/go]
+    matrix:
+      tags: ["", purego]
+      goamd64: [v1, v3]
+`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	variants, _ := cfg.Variants(cfg.Target("foo"), nil)
+	want := []config.Variant{
+		{Name: "go1.99.0", Target: runner.Target{Name: "foo", RepoPath: "/src/foo", Env: []string{"GOGC=off"}, GoBinary: goBinary}},
+		{Name: "/opt/go/bin/go", Target: runner.Target{Name: "foo", RepoPath: "/src/foo", Env: []string{"GOGC=off"}, GoBinary: "/opt/go/bin/go"}},
+		{Name: "go1.22.0", Target: runner.Target{Name: "foo", RepoPath: "/src/foo", Env: []string{"GOGC=off", "GOTOOLCHAIN=go1.22.0", "GOPROXY=off"}}},
+	}
+	if diff := cmp.Diff(want, variants); diff != "" {
+		t.Errorf("Variants(foo) [-want +got]:\n%s", diff)
+	}
+
+	variants, _ = cfg.Variants(cfg.Target("bar"), nil)
+	want = []config.Variant{{Target: runner.Target{Name: "bar", RepoPath: "/src/bar"}}}
+	if diff := cmp.Diff(want, variants); diff != "" {
+		t.Errorf("Variants(bar) [-want +got]:\n%s", diff)
+	}
+
+	variants, _ = cfg.Variants(cfg.Target("baz"), nil)
+	baz := func(args, env []string) runner.Target {
+		return runner.Target{Name: "baz", RepoPath: "/src/baz", GoArgs: args, Env: env, GoBinary: "/opt/go/bin/go"}
+	}
+	want = []config.Variant{
+		{
+			Name:   "/opt/go/bin/go,tags=,goamd64=v1",
+			Labels: map[string]string{"tags": "", "goamd64": "v1"},
+			Target: baz([]string{"-benchmem"}, []string{"GOAMD64=v1"}),
+		},
+		{
+			Name:   "/opt/go/bin/go,tags=,goamd64=v3",
+			Labels: map[string]string{"tags": "", "goamd64": "v3"},
+			Target: baz([]string{"-benchmem"}, []string{"GOAMD64=v3"}),
+		},
+		{
+			Name:   "/opt/go/bin/go,tags=purego,goamd64=v1",
+			Labels: map[string]string{"tags": "purego", "goamd64": "v1"},
+			Target: baz([]string{"-benchmem", "-tags=purego"}, []string{"GOAMD64=v1"}),
+		},
+		{
+			Name:   "/opt/go/bin/go,tags=purego,goamd64=v3",
+			Labels: map[string]string{"tags": "purego", "goamd64": "v3"},
+			Target: baz([]string{"-benchmem", "-tags=purego"}, []string{"GOAMD64=v3"}),
+		},
+	}
+	if diff := cmp.Diff(want, variants); diff != "" {
+		t.Errorf("Variants(baz) [-want +got]:\n%s", diff)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/tklauser/gobench_exporter/runner"
+)
+
+// BuildMatrix lists the values of each build configuration dimension a target is benchmarked
+// with. The benchmarks are run once per combination of the values of all non-empty dimensions.
+type BuildMatrix struct {
+	// Tags are comma-separated lists of build tags (go test -tags), e.g. "" and "purego".
+	Tags []string `yaml:"tags,omitempty"`
+	// GOAMD64 are microarchitecture levels, e.g. v1 and v3.
+	GOAMD64 []string `yaml:"goamd64,omitempty"`
+	// CGOEnabled are values of CGO_ENABLED, i.e. "0" or "1".
+	CGOEnabled []string `yaml:"cgo_enabled,omitempty"`
+	// GCFlags are arguments passed to the compiler (go test -gcflags), e.g. "-B".
+	GCFlags []string `yaml:"gcflags,omitempty"`
+}
+
+// dimension is a dimension of a build matrix.
+type dimension struct {
+	label  string // label of the exported series and key in variant names
+	values []string
+	apply  func(rt *runner.Target, value string)
+}
+
+// dimensions returns the non-empty dimensions of the build matrix.
+func (m *BuildMatrix) dimensions() []dimension {
+	if m == nil {
+		return nil
+	}
+	all := []dimension{
+		{"tags", m.Tags, func(rt *runner.Target, v string) {
+			if v != "" {
+				rt.GoArgs = append(rt.GoArgs, "-tags="+v)
+			}
+		}},
+		{"goamd64", m.GOAMD64, func(rt *runner.Target, v string) {
+			rt.Env = append(rt.Env, "GOAMD64="+v)
+		}},
+		{"cgo_enabled", m.CGOEnabled, func(rt *runner.Target, v string) {
+			rt.Env = append(rt.Env, "CGO_ENABLED="+v)
+		}},
+		{"gcflags", m.GCFlags, func(rt *runner.Target, v string) {
+			if v != "" {
+				rt.GoArgs = append(rt.GoArgs, "-gcflags="+v)
+			}
+		}},
+	}
+	var dims []dimension
+	for _, d := range all {
+		if len(d.values) > 0 {
+			dims = append(dims, d)
+		}
+	}
+	return dims
+}
+
+var (
+	goamd64Regexp    = regexp.MustCompile(`^v[1-4]$`)
+	cgoEnabledRegexp = regexp.MustCompile(`^[01]$`)
+)
+
+// validate checks the values of the build matrix.
+func (m *BuildMatrix) validate() error {
+	for _, d := range m.dimensions() {
+		seen := make(map[string]bool, len(d.values))
+		for _, v := range d.values {
+			if seen[v] {
+				return fmt.Errorf("duplicate %s value %q", d.label, v)
+			}
+			seen[v] = true
+			switch {
+			case d.label == "goamd64" && !goamd64Regexp.MatchString(v):
+				return fmt.Errorf("invalid goamd64 value %q, want v1 to v4", v)
+			case d.label == "cgo_enabled" && !cgoEnabledRegexp.MatchString(v):
+				return fmt.Errorf("invalid cgo_enabled value %q, want 0 or 1", v)
+			}
+		}
+	}
+	return nil
+}
+
+// Variant is one combination of the build matrix of a target.
+type Variant struct {
+	// Name identifies the variant in comparisons, e.g. "go1.22.0,goamd64=v3". It is empty for
+	// targets without a build matrix.
+	Name string
+	// Labels are the values of the build matrix dimensions of the variant, keyed by dimension.
+	// The Go version of toolchain variants is only known at run time and not included.
+	Labels map[string]string
+	Target runner.Target
+}
+
+// toolchainGoBinary returns the go command of the toolchain tc, which is either the path of a go
+// binary or the name of a toolchain. Named toolchains are looked up in toolchainDir (as
+// <toolchainDir>/<name>/bin/go). It returns an empty string if the toolchain is not found there.
+func toolchainGoBinary(tc, toolchainDir string) string {
+	if strings.ContainsRune(tc, filepath.Separator) {
+		return tc
+	}
+	if toolchainDir == "" {
+		return ""
+	}
+	goBinary := filepath.Join(toolchainDir, tc, "bin", "go")
+	if _, err := os.Stat(goBinary); err != nil {
+		return ""
+	}
+	return goBinary
+}
+
+// toolchainVariants returns the variants of rt for the toolchains of target t.
+func (c *Config) toolchainVariants(t *Target, rt runner.Target) []Variant {
+	if len(t.Toolchains) == 0 {
+		return []Variant{{Target: rt}}
+	}
+	variants := make([]Variant, 0, len(t.Toolchains))
+	for _, tc := range t.Toolchains {
+		v := Variant{Name: tc, Target: rt}
+		v.Target.Env = append([]string(nil), rt.Env...)
+		if goBinary := toolchainGoBinary(tc, c.Global.ToolchainDir); goBinary != "" {
+			v.Target.GoBinary = goBinary
+		} else {
+			// Select the toolchain by name, without downloading it.
+			v.Target.Env = append(v.Target.Env, "GOTOOLCHAIN="+tc, "GOPROXY=off")
+		}
+		variants = append(variants, v)
+	}
+	return variants
+}
+
+// Variants returns the variants of the build matrix of target t when running the benchmarks
+// with profile p, which may be nil, i.e. all combinations of its toolchains and build
+// configuration dimensions. It also returns the regular expression selecting the benchmarks to
+// run. A target without a build matrix has a single, unnamed variant.
+func (c *Config) Variants(t *Target, p *Profile) ([]Variant, string) {
+	rt, benchRegex := t.RunnerTarget(p)
+	variants := c.toolchainVariants(t, rt)
+	for _, d := range t.Matrix.dimensions() {
+		next := make([]Variant, 0, len(variants)*len(d.values))
+		for _, v := range variants {
+			for _, value := range d.values {
+				nv := Variant{
+					Name:   d.label + "=" + value,
+					Labels: map[string]string{d.label: value},
+					Target: v.Target,
+				}
+				if v.Name != "" {
+					nv.Name = v.Name + "," + nv.Name
+				}
+				for k, l := range v.Labels {
+					nv.Labels[k] = l
+				}
+				nv.Target.GoArgs = append([]string(nil), v.Target.GoArgs...)
+				nv.Target.Env = append([]string(nil), v.Target.Env...)
+				d.apply(&nv.Target, value)
+				next = append(next, nv)
+			}
+		}
+		variants = next
+	}
+	return variants, benchRegex
+}
+
+// validateMatrix checks the toolchains and build matrix of target t.
+func validateMatrix(t *Target) error {
+	seen := make(map[string]bool, len(t.Toolchains))
+	for _, tc := range t.Toolchains {
+		if tc == "" {
+			return fmt.Errorf("target %q has an empty toolchain", t.Name)
+		}
+		if seen[tc] {
+			return fmt.Errorf("target %q has duplicate toolchain %q", t.Name, tc)
+		}
+		seen[tc] = true
+	}
+	if err := t.Matrix.validate(); err != nil {
+		return fmt.Errorf("invalid matrix in target %q: %v", t.Name, err)
+	}
+	return nil
+}
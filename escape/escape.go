@@ -0,0 +1,150 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package escape compares the escape analysis and inlining decisions the Go compiler prints with
+// -gcflags=-m, e.g. to explain an increase of the allocations of a benchmark.
+package escape
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Decision is an escape analysis or inlining decision of the compiler, e.g.
+// "make([]byte, n) escapes to heap" or "inlining call to foo".
+type Decision struct {
+	File    string // absolute path of the source file
+	Line    int
+	Func    string // enclosing function, set by Package.Annotate
+	Message string
+}
+
+// diagnosticLine matches compiler diagnostics of the form "file:line:col: message".
+var diagnosticLine = regexp.MustCompile(`^(.+?\.go):(\d+):\d+: (.*)$`)
+
+// Parse parses the diagnostics printed by the compiler with -gcflags=-m or -m=2. Relative file
+// names are resolved against dir. The explanations of escaping data flows printed with -m=2 are
+// skipped, as are diagnostics of generated files, and the function bodies following the cost of
+// inlinable functions are cut off.
+func Parse(r io.Reader, dir string) ([]Decision, error) {
+	var ds []Decision
+	scan := bufio.NewScanner(r)
+	scan.Buffer(nil, 1024*1024)
+	for scan.Scan() {
+		m := diagnosticLine.FindStringSubmatch(scan.Text())
+		if m == nil {
+			continue
+		}
+		msg := m[3]
+		if strings.HasPrefix(msg, " ") || strings.HasSuffix(msg, ":") {
+			// Data flow explanation of -m=2.
+			continue
+		}
+		if i := strings.Index(msg, " as: "); i >= 0 && strings.HasPrefix(msg, "can inline ") {
+			msg = msg[:i]
+		}
+		line, err := strconv.Atoi(m[2])
+		if err != nil {
+			return nil, err
+		}
+		file := m[1]
+		if strings.HasPrefix(filepath.Base(file), "_testmain") {
+			continue
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		ds = append(ds, Decision{File: file, Line: line, Message: msg})
+	}
+	return ds, scan.Err()
+}
+
+// Change is a decision taken only at the base or the head commit.
+type Change struct {
+	Func    string
+	Message string
+	Added   bool // whether the decision was taken at the head but not at the base commit
+}
+
+// key identifies decisions independent of their position, which changes between commits.
+type key struct {
+	fn, msg string
+}
+
+// count counts the decisions per function and message in functions for which keep returns true.
+func count(ds []Decision, keep func(fn string) bool) map[key]int {
+	n := make(map[key]int)
+	for _, d := range ds {
+		if d.Func != "" && keep(d.Func) {
+			n[key{d.Func, d.Message}]++
+		}
+	}
+	return n
+}
+
+// Diff returns the decisions taken only at the base or the head commit in functions for which
+// keep returns true, sorted by function and message. Decisions taken several times in a function
+// (e.g. inlining the same call twice) are matched up one by one.
+func Diff(base, head []Decision, keep func(fn string) bool) []Change {
+	bn, hn := count(base, keep), count(head, keep)
+	var changes []Change
+	add := func(k key, n int, added bool) {
+		for i := 0; i < n; i++ {
+			changes = append(changes, Change{Func: k.fn, Message: k.msg, Added: added})
+		}
+	}
+	for k, n := range bn {
+		add(k, n-hn[k], false)
+	}
+	for k, n := range hn {
+		add(k, n-bn[k], true)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		ci, cj := changes[i], changes[j]
+		if ci.Func != cj.Func {
+			return ci.Func < cj.Func
+		}
+		if ci.Message != cj.Message {
+			return ci.Message < cj.Message
+		}
+		return !ci.Added && cj.Added
+	})
+	return changes
+}
+
+// WriteDiff writes changes grouped by function to w, with decisions taken only at the base
+// commit prefixed by "-" and decisions taken only at the head commit by "+".
+func WriteDiff(w io.Writer, changes []Change) error {
+	for i, c := range changes {
+		if i == 0 || c.Func != changes[i-1].Func {
+			if _, err := fmt.Fprintf(w, "  %s:\n", c.Func); err != nil {
+				return err
+			}
+		}
+		sign := "-"
+		if c.Added {
+			sign = "+"
+		}
+		if _, err := fmt.Fprintf(w, "    %s %s\n", sign, c.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
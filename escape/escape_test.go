@@ -0,0 +1,184 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package escape
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testSource = `package foo
+
+type T struct{ b []byte }
+
+func (t *T) Grow(n int) *T {
+	x := make([]byte, n)
+	t.b = append(t.b, x...)
+	return &T{b: helper(x)}
+}
+
+func helper(b []byte) []byte { return b }
+
+func unrelated(p *int) *int { return p }
+`
+
+const testBenchSource = `package foo
+
+import "testing"
+
+func BenchmarkGrow(b *testing.B) {
+	t := &T{}
+	for i := 0; i < b.N; i++ {
+		t.Grow(10)
+	}
+}
+`
+
+// baseOutput and headOutput are compiler diagnostics with -m=2 of the test sources, where at the
+// head commit the result of Grow escapes and unrelated is no longer inlined.
+const baseOutput = `# example.com/foo [example.com/foo.test]
+./foo.go:11:6: can inline helper with cost 2 as: func([]byte) []byte { return b }
+./foo.go:13:6: can inline unrelated with cost 2 as: func(*int) *int { return p }
+./foo.go:8:21: inlining call to helper
+./foo.go:6:11: make([]byte, n) escapes to heap in (*T).Grow:
+./foo.go:6:11:   flow: x ← &{storage for make([]byte, n)}:
+./foo.go:6:11:     from make([]byte, n) (spill) at ./foo.go:6:11
+./foo.go:6:11: make([]byte, n) escapes to heap
+./foo.go:8:9: &T{...} does not escape
+foo_test.go:8:9: inlining call to (*T).Grow
+# example.com/foo.test
+_testmain.go:45:6: cannot inline main: function too complex: cost 187 exceeds budget 80
+`
+
+const headOutput = `# example.com/foo [example.com/foo.test]
+./foo.go:11:6: can inline helper with cost 2 as: func([]byte) []byte { return b }
+./foo.go:13:6: cannot inline unrelated: marked go:noinline
+./foo.go:8:21: inlining call to helper
+./foo.go:6:11: make([]byte, n) escapes to heap
+./foo.go:8:9: &T{...} escapes to heap
+foo_test.go:8:9: inlining call to (*T).Grow
+`
+
+const testSuiteSource = `package foo
+
+import "gopkg.in/check.v1"
+
+type S struct{}
+
+func (s *S) BenchmarkUnrelated(c *check.C) {
+	for i := 0; i < c.N; i++ {
+		unrelated(nil)
+	}
+}
+`
+
+func TestReachable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "escape")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, src := range map[string]string{"foo.go": testSource, "foo_test.go": testBenchSource, "suite_test.go": testSuiteSource} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := LoadPackage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want map[string]bool
+	}{
+		{"BenchmarkGrow/size=10", map[string]bool{"BenchmarkGrow": true, "(*T).Grow": true, "helper": true}},
+		{"S.BenchmarkUnrelated", map[string]bool{"(*S).BenchmarkUnrelated": true, "unrelated": true}},
+	}
+	for _, tt := range tests {
+		if diff := cmp.Diff(tt.want, p.Reachable(tt.name)); diff != "" {
+			t.Errorf("Reachable(%q) mismatch (-want +got):\n%s", tt.name, diff)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "escape")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, src := range map[string]string{"foo.go": testSource, "foo_test.go": testBenchSource} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := LoadPackage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reachable := p.Reachable("BenchmarkGrow")
+	wantReachable := map[string]bool{"BenchmarkGrow": true, "(*T).Grow": true, "helper": true}
+	if diff := cmp.Diff(wantReachable, reachable); diff != "" {
+		t.Errorf("Reachable() mismatch (-want +got):\n%s", diff)
+	}
+
+	base, err := Parse(strings.NewReader(baseOutput), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := Parse(strings.NewReader(headOutput), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Annotate(base)
+	p.Annotate(head)
+	wantBase := []Decision{
+		{File: filepath.Join(dir, "foo.go"), Line: 11, Func: "helper", Message: "can inline helper with cost 2"},
+		{File: filepath.Join(dir, "foo.go"), Line: 13, Func: "unrelated", Message: "can inline unrelated with cost 2"},
+		{File: filepath.Join(dir, "foo.go"), Line: 8, Func: "(*T).Grow", Message: "inlining call to helper"},
+		{File: filepath.Join(dir, "foo.go"), Line: 6, Func: "(*T).Grow", Message: "make([]byte, n) escapes to heap"},
+		{File: filepath.Join(dir, "foo.go"), Line: 8, Func: "(*T).Grow", Message: "&T{...} does not escape"},
+		{File: filepath.Join(dir, "foo_test.go"), Line: 8, Func: "BenchmarkGrow", Message: "inlining call to (*T).Grow"},
+	}
+	if diff := cmp.Diff(wantBase, base); diff != "" {
+		t.Errorf("Parse() mismatch (-want +got):\n%s", diff)
+	}
+
+	changes := Diff(base, head, func(fn string) bool { return reachable[fn] })
+	wantChanges := []Change{
+		{Func: "(*T).Grow", Message: "&T{...} does not escape"},
+		{Func: "(*T).Grow", Message: "&T{...} escapes to heap", Added: true},
+	}
+	if diff := cmp.Diff(wantChanges, changes); diff != "" {
+		t.Errorf("Diff() mismatch (-want +got):\n%s", diff)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteDiff(&buf, changes); err != nil {
+		t.Fatal(err)
+	}
+	want := "  (*T).Grow:\n    - &T{...} does not escape\n    + &T{...} escapes to heap\n"
+	if got := buf.String(); got != want {
+		t.Errorf("WriteDiff() = %q, want %q", got, want)
+	}
+}
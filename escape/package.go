@@ -0,0 +1,174 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package escape
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// funcRange is the range of lines of a function declaration.
+type funcRange struct {
+	name        string
+	first, last int
+}
+
+// Package holds the functions declared in the source files of a package and which functions
+// they may call.
+type Package struct {
+	funcs map[string][]funcRange // per file
+	// calls maps each function to the functions whose name it refers to. As calls are resolved
+	// by name only, this over-approximates the call graph.
+	calls map[string]map[string]bool
+}
+
+// funcName returns the name of the function declared by d the way the compiler prints it, e.g.
+// "foo", "T.foo" or "(*T).foo".
+func funcName(d *ast.FuncDecl) string {
+	if d.Recv == nil || len(d.Recv.List) == 0 {
+		return d.Name.Name
+	}
+	typ := d.Recv.List[0].Type
+	ptr := false
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ, ptr = star.X, true
+	}
+	// The receiver type is the first identifier, followed by any type parameters.
+	recv := "?"
+	ast.Inspect(typ, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && recv == "?" {
+			recv = id.Name
+		}
+		return recv == "?"
+	})
+	if ptr {
+		return "(*" + recv + ")." + d.Name.Name
+	}
+	return recv + "." + d.Name.Name
+}
+
+// shortName returns the name of a function without receiver.
+func shortName(fn string) string {
+	return fn[strings.LastIndexByte(fn, '.')+1:]
+}
+
+// LoadPackage parses the Go source files, including test files, in dir. Files excluded by build
+// constraints are parsed as well.
+func LoadPackage(dir string) (*Package, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	p := &Package{
+		funcs: make(map[string][]funcRange),
+		calls: make(map[string]map[string]bool),
+	}
+	byShortName := make(map[string][]string)
+	refs := make(map[string]map[string]bool)
+	fset := token.NewFileSet()
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parser.ParseFile(fset, file, src, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range f.Decls {
+			d, ok := decl.(*ast.FuncDecl)
+			if !ok || d.Body == nil {
+				continue
+			}
+			name := funcName(d)
+			p.funcs[file] = append(p.funcs[file], funcRange{
+				name:  name,
+				first: fset.Position(d.Pos()).Line,
+				last:  fset.Position(d.End()).Line,
+			})
+			byShortName[d.Name.Name] = append(byShortName[d.Name.Name], name)
+			if refs[name] == nil {
+				refs[name] = make(map[string]bool)
+			}
+			ast.Inspect(d.Body, func(n ast.Node) bool {
+				if id, ok := n.(*ast.Ident); ok {
+					refs[name][id.Name] = true
+				}
+				return true
+			})
+		}
+	}
+	for fn, ids := range refs {
+		p.calls[fn] = make(map[string]bool)
+		for id := range ids {
+			for _, callee := range byShortName[id] {
+				p.calls[fn][callee] = true
+			}
+		}
+	}
+	return p, nil
+}
+
+// Annotate sets the enclosing function of the decisions in ds.
+func (p *Package) Annotate(ds []Decision) {
+	for i := range ds {
+		for _, r := range p.funcs[ds[i].File] {
+			if ds[i].Line >= r.first && ds[i].Line <= r.last {
+				ds[i].Func = r.name
+				break
+			}
+		}
+	}
+}
+
+// Reachable returns the functions which may be called, directly or indirectly, by the function
+// with the given name, including the function itself. The name may omit the receiver. It may also
+// be the name of a benchmark: sub-benchmarks (e.g. "BenchmarkFoo/size=10") are attributed to the
+// top-level benchmark function and gocheck benchmarks (e.g. "Suite.BenchmarkFoo") to the method
+// of the suite, which may have a pointer receiver.
+func (p *Package) Reachable(name string) map[string]bool {
+	if i := strings.IndexByte(name, '/'); i >= 0 {
+		name = name[:i]
+	}
+	names := map[string]bool{name: true}
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		names["(*"+name[:i]+")"+name[i:]] = true
+	}
+	seen := make(map[string]bool)
+	var queue []string
+	for fn := range p.calls {
+		if names[fn] || shortName(fn) == name {
+			seen[fn] = true
+			queue = append(queue, fn)
+		}
+	}
+	sort.Strings(queue)
+	for len(queue) > 0 {
+		fn := queue[0]
+		queue = queue[1:]
+		for callee := range p.calls[fn] {
+			if !seen[callee] {
+				seen[callee] = true
+				queue = append(queue, callee)
+			}
+		}
+	}
+	return seen
+}
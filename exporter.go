@@ -0,0 +1,706 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tklauser/gobench_exporter/bench"
+	"github.com/tklauser/gobench_exporter/changepoint"
+	"github.com/tklauser/gobench_exporter/collector"
+	"github.com/tklauser/gobench_exporter/config"
+	"github.com/tklauser/gobench_exporter/history"
+	"github.com/tklauser/gobench_exporter/regression"
+	"github.com/tklauser/gobench_exporter/runner"
+)
+
+// exporter holds the current configuration and runs the benchmarks of the configured targets,
+// either on request or as scheduled.
+type exporter struct {
+	configFile string
+	escaping   collector.NameEscaping
+	collector  *collector.GoBenchCollector
+	history    *history.Store             // records all runs if non-nil
+	budget     *collector.BudgetCollector // evaluates all runs if non-nil
+	noise      *collector.NoiseCollector
+	ab         *collector.ABCollector
+	variants   *collector.VariantCollector
+	env        *collector.EnvironmentCollector
+	usage      *collector.UsageCollector
+	profiles   *collector.ProfileCollector
+	pgo        *collector.PGOCollector
+	traces     *collector.TraceCollector
+	available  *collector.AvailableCollector
+	// changePoints holds the change points detected in the history, nil without history store.
+	changePoints *collector.ChangePointCollector
+
+	// listAvailable makes every run list the available benchmarks of the target. Otherwise,
+	// they are only listed on request.
+	listAvailable bool
+
+	// running holds a token while benchmarks run, so that runs on this machine do not overlap
+	// and disturb each other's timings.
+	running chan struct{}
+
+	mu            sync.Mutex
+	cfg           *config.Config
+	stopScheduler context.CancelFunc
+}
+
+func newExporter(configFile string, escaping collector.NameEscaping, cfg *config.Config, store *history.Store, budget *collector.BudgetCollector) *exporter {
+	e := &exporter{
+		configFile: configFile,
+		escaping:   escaping,
+		collector:  collector.NewGoBenchCollectorWithOptions(cfg.CollectorOptions(escaping)),
+		history:    store,
+		budget:     budget,
+		noise:      collector.NewNoiseCollector(regression.DefaultNoiseOptions),
+		ab:         collector.NewABCollector(),
+		variants:   collector.NewVariantCollector(),
+		env:        collector.NewEnvironmentCollector(),
+		usage:      collector.NewUsageCollector(),
+		profiles:   collector.NewProfileCollector(),
+		pgo:        collector.NewPGOCollector(),
+		traces:     collector.NewTraceCollector(),
+		available:  collector.NewAvailableCollector(),
+		running:    make(chan struct{}, 1),
+	}
+	if store != nil {
+		e.changePoints = collector.NewChangePointCollector()
+	}
+	e.applyConfig(cfg)
+	return e
+}
+
+// config returns the current configuration.
+func (e *exporter) config() *config.Config {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.cfg
+}
+
+// applyConfig makes cfg the current configuration and restarts the schedules of the targets.
+// Scheduled runs already executing finish using the previous configuration.
+func (e *exporter) applyConfig(cfg *config.Config) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.stopScheduler != nil {
+		e.stopScheduler()
+	}
+	e.cfg = cfg
+	e.collector.SetOptions(cfg.CollectorOptions(e.escaping))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e.stopScheduler = cancel
+	for _, t := range cfg.Targets {
+		if t.Schedule > 0 {
+			go e.schedule(ctx, cfg, t)
+		}
+	}
+}
+
+// reload reloads the configuration file. If the new configuration is invalid, the current one is
+// kept.
+func (e *exporter) reload() error {
+	if e.configFile == "" {
+		return fmt.Errorf("no configuration file specified")
+	}
+	cfg, err := config.Load(e.configFile)
+	if err != nil {
+		return err
+	}
+	e.applyConfig(cfg)
+	log.Printf("Reloaded configuration file %s", e.configFile)
+	return nil
+}
+
+// acquireRun waits until no other benchmarks run and returns a function allowing other runs
+// again. It fails if ctx is done before.
+func (e *exporter) acquireRun(ctx context.Context) (func(), error) {
+	select {
+	case e.running <- struct{}{}:
+		return func() { <-e.running }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for running benchmarks: %v", ctx.Err())
+	}
+}
+
+// schedule periodically runs the benchmarks of target t until ctx is cancelled. Cancelling ctx
+// does not interrupt a run in progress.
+func (e *exporter) schedule(ctx context.Context, cfg *config.Config, t *config.Target) {
+	p, _ := cfg.Profile(t.Profile)
+	ticker := time.NewTicker(t.Schedule)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// The run gets a context of its own, so that a reload stopping the schedule does not
+			// kill the test binaries and lose the results.
+			if _, err := e.runTarget(context.Background(), t, t.Profile, p, ""); err != nil {
+				log.Printf("Scheduled run of target %q failed: %v", t.Name, err)
+			}
+		}
+	}
+}
+
+// update exports the benchmark results bs of the variant of target (both empty for results read
+// from stdin) from src, analyzes their noise and evaluates them against the budget. recent holds
+// the results of earlier runs of the same benchmarks in chronological order.
+func (e *exporter) update(target, variant string, bs bench.Set, src collector.Source, recent []bench.Set) {
+	e.collector.Update(bs, src)
+	e.noise.Update(target, variant, bs, recent)
+	if e.budget == nil {
+		return
+	}
+	for _, r := range e.budget.Update(target, variant, bs) {
+		switch {
+		case r.Violation && r.Floor:
+			log.Printf("Benchmark %s falls short of budget: %g %s < %g %s", r.Name, r.Value, r.Unit, r.Limit, r.Unit)
+		case r.Violation:
+			log.Printf("Benchmark %s exceeds budget: %g %s > %g %s", r.Name, r.Value, r.Unit, r.Limit, r.Unit)
+		}
+	}
+}
+
+// changePointRuns is the number of most recent runs of a target analyzed for change points.
+const changePointRuns = 100
+
+// targetRuns returns the most recent runs of target recorded in the history store which are
+// analyzed for change points, in chronological order, or nil without history store.
+func (e *exporter) targetRuns(target string) []*history.Run {
+	if e.history == nil {
+		return nil
+	}
+	runs, err := e.history.Runs(target, changePointRuns)
+	if err != nil {
+		log.Printf("Failed to read history of target %q: %v", target, err)
+		return nil
+	}
+	return runs
+}
+
+// detectChangePoints analyzes the most recent of the runs of target, recorded in the history
+// store in chronological order, for change points.
+func (e *exporter) detectChangePoints(target string, runs []*history.Run) {
+	if len(runs) > changePointRuns {
+		runs = runs[len(runs)-changePointRuns:]
+	}
+	e.changePoints.Set(target, changepoint.Analyze(runs, changepoint.DefaultOptions))
+}
+
+// changePointsHandler serves the detected change points as JSON, optionally restricted to the
+// target and benchmark given in the respective parameters.
+func (e *exporter) changePointsHandler(w http.ResponseWriter, r *http.Request) {
+	if e.changePoints == nil {
+		http.Error(w, "change point detection requires a history store", http.StatusNotFound)
+		return
+	}
+	params := r.URL.Query()
+	res := []changepoint.ChangePoint{}
+	for _, cp := range e.changePoints.ChangePoints() {
+		if t := params.Get("target"); t != "" && cp.Target != t {
+			continue
+		}
+		if b := params.Get("benchmark"); b != "" && cp.Benchmark != b {
+			continue
+		}
+		res = append(res, cp)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		log.Printf("Failed to encode change points: %v", err)
+	}
+}
+
+// noiseTrendRuns is the number of most recent runs of a target used for the noise trend.
+const noiseTrendRuns = 10
+
+// recentResults returns the results of the most recent of the runs of a target, in chronological
+// order, which are of the given variant.
+func recentResults(runs []*history.Run, variant string) []bench.Set {
+	var res []bench.Set
+	for _, r := range runs {
+		if r.Variant == variant {
+			res = append(res, r.Results)
+		}
+	}
+	if len(res) > noiseTrendRuns {
+		res = res[len(res)-noiseTrendRuns:]
+	}
+	return res
+}
+
+// runTarget runs the benchmarks of all variants of target t using the profile p named profile
+// (nil for the default profile), exports the results and records them in the history store.
+// Variants are compared with the first one. If benchRegex is not empty, it selects the benchmarks
+// to run instead of the profile. If other benchmarks are running, it waits for them to finish.
+func (e *exporter) runTarget(ctx context.Context, t *config.Target, profile string, p *config.Profile, benchRegex string) ([]variantRun, error) {
+	override := func(rt *runner.Target, re string) string {
+		rt.ListBenchmarks = e.listAvailable
+		if benchRegex != "" {
+			return benchRegex
+		}
+		return re
+	}
+	release, err := e.acquireRun(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	runs, env, err := runVariants(ctx, e.config(), t, p, override)
+	defer cleanupRuns(runs)
+	if env != nil {
+		e.env.Set(t.Name, env)
+	}
+	// Read the history once per run. The runs recorded below are appended for change point
+	// detection.
+	past := e.targetRuns(t.Name)
+	var recorded []*history.Run
+	for i := range runs {
+		r := &runs[i]
+		e.usage.Set(t.Name, r.variant.Name, r.usage)
+		if p != nil && p.Profiling != nil {
+			e.profiles.Set(t.Name, r.variant.Name, topProfiles(*r, p.Profiling.Top))
+			if p.Profiling.Trace {
+				e.traces.Set(t.Name, r.variant.Name, r.traces)
+			}
+		}
+		if r.pgoResults != nil {
+			e.pgo.Set(t.Name, r.variant.Name, regression.Check(r.results, r.pgoResults, regression.DefaultThresholds()))
+		}
+		e.update(t.Name, r.variant.Name, r.results, r.source(t), recentResults(past, r.variant.Name))
+		if hr, herr := recordRun(ctx, e.history, t, profile, r); herr != nil {
+			log.Printf("Failed to record run of target %q: %v", t.Name, herr)
+		} else if hr != nil {
+			recorded = append(recorded, hr)
+		}
+	}
+	if len(recorded) > 0 {
+		e.detectChangePoints(t.Name, append(past, recorded...))
+	}
+	if av := mergeAvailable(runs); av != nil {
+		e.available.Set(t.Name, av)
+	} else if known, ok := e.available.Available(t.Name); ok {
+		// Keep the benchmarks listed on request, updating whether they had results.
+		e.available.Set(t.Name, markAvailable(known, runs))
+	}
+	e.variants.Set(t.Name, compareVariants(runs, regression.DefaultThresholds()))
+	return runs, err
+}
+
+// defaultABRounds is the default number of rounds of interleaved A/B runs.
+const defaultABRounds = 5
+
+// serveAB runs the benchmarks of targets at the base and head refs interleaved for the given
+// number of rounds, writes the comparison to w and exports it as delta gauges.
+func (e *exporter) serveAB(w http.ResponseWriter, r *http.Request, targets []*config.Target, p *config.Profile, base, head string, rounds int) {
+	for _, t := range targets {
+		if !e.serveABTarget(w, r, t, p, base, head, rounds) {
+			return
+		}
+	}
+}
+
+// serveABTarget runs the A/B benchmarks of target t for serveAB, waiting for other benchmarks to
+// finish first. It reports whether the benchmarks ran successfully.
+func (e *exporter) serveABTarget(w http.ResponseWriter, r *http.Request, t *config.Target, p *config.Profile, base, head string, rounds int) bool {
+	release, err := e.acquireRun(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return false
+	}
+	// Building for the escape analysis diff would disturb other runs as well.
+	defer release()
+	rt, benchRegex := t.RunnerTarget(p)
+	baseSet, headSet, err := runner.RunAB(r.Context(), rt, base, head, rounds, benchRegex)
+	if err != nil {
+		log.Printf("Failed to run A/B benchmarks of target %q: %v", t.Name, err)
+		http.Error(w, fmt.Sprintf("failed to run A/B benchmarks of target %q: %v", t.Name, err), http.StatusInternalServerError)
+		return false
+	}
+	th := regression.DefaultThresholds()
+	results := regression.Check(baseSet, headSet, th)
+	e.ab.Set(t.Name, base, head, results)
+	fmt.Fprintf(w, "target %s: %s vs. %s\n", t.Name, base, head)
+	regression.WriteReport(w, results, th.Alpha)
+	if err := writeAllocDiffs(r.Context(), w, rt, base, head, results, headSet, baseSet); err != nil {
+		log.Printf("Failed to diff escape analysis and inlining decisions of target %q: %v", t.Name, err)
+	}
+	return true
+}
+
+// ServeHTTP implements http.Handler for the trigger endpoint. It runs the benchmarks of the target
+// given in the target parameter (all targets if omitted) using the profile given in the profile
+// parameter. The benchmark parameter, which may be repeated, selects benchmarks by their
+// top-level name instead of the profile. If the base and head parameters are given, the
+// benchmarks are run at both git refs interleaved for the number of rounds given in the rounds
+// parameter and compared instead. Requests arriving while benchmarks run wait for them to finish.
+func (e *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cfg := e.config()
+	params := r.URL.Query()
+	p, err := cfg.Profile(params.Get("profile"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	targets := cfg.Targets
+	if name := params.Get("target"); name != "" {
+		t := cfg.Target(name)
+		if t == nil {
+			http.Error(w, fmt.Sprintf("unknown target %q", name), http.StatusBadRequest)
+			return
+		}
+		targets = []*config.Target{t}
+	}
+	base, head := params.Get("base"), params.Get("head")
+	if base != "" || head != "" {
+		if base == "" || head == "" {
+			http.Error(w, "both base and head are required", http.StatusBadRequest)
+			return
+		}
+		rounds := defaultABRounds
+		if s := params.Get("rounds"); s != "" {
+			if rounds, err = strconv.Atoi(s); err != nil || rounds < 1 {
+				http.Error(w, fmt.Sprintf("invalid rounds %q", s), http.StatusBadRequest)
+				return
+			}
+		}
+		e.serveAB(w, r, targets, p, base, head, rounds)
+		return
+	}
+
+	benchRegex := benchmarksRegex(params["benchmark"])
+	// The status is only known after all targets ran, so the output is buffered.
+	var buf bytes.Buffer
+	status := http.StatusOK
+	for _, t := range targets {
+		runs, err := e.runTarget(r.Context(), t, params.Get("profile"), p, benchRegex)
+		for _, run := range runs {
+			if run.variant.Name != "" {
+				fmt.Fprintf(&buf, "variant: %s\n", run.variant.Name)
+			}
+			if run.runID != "" {
+				fmt.Fprintf(&buf, "run: %s\n", run.runID)
+			}
+			log.Print(run.results)
+			fmt.Fprintf(&buf, "%v\n", run.results)
+		}
+		if err != nil {
+			log.Printf("Failed to run benchmarks of target %q: %v", t.Name, err)
+			status = http.StatusInternalServerError
+		}
+	}
+	w.WriteHeader(status)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Printf("Failed to write trigger response: %v", err)
+	}
+}
+
+// benchmarksRegex returns the regular expression selecting the benchmarks with the given
+// top-level names, e.g. BenchmarkFoo or Suite.BenchmarkFoo, or an empty string if there are none.
+func benchmarksRegex(names []string) string {
+	var quoted []string
+	for _, name := range names {
+		if name != "" {
+			quoted = append(quoted, regexp.QuoteMeta(name))
+		}
+	}
+	if len(quoted) == 0 {
+		return ""
+	}
+	return "^(" + strings.Join(quoted, "|") + ")$"
+}
+
+// mergeAvailable returns the benchmarks available in any of the variants runs, sorted by package
+// and name, or nil if listing them failed for all variants. A benchmark has results if it has
+// results in any variant.
+func mergeAvailable(runs []variantRun) []runner.Available {
+	type key struct{ pkg, name string }
+	var (
+		res   []runner.Available
+		index = make(map[key]int)
+	)
+	for _, r := range runs {
+		for _, a := range r.available {
+			k := key{a.Pkg, a.Name}
+			if i, ok := index[k]; ok {
+				res[i].Results = res[i].Results || a.Results
+				continue
+			}
+			index[k] = len(res)
+			res = append(res, a)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Pkg != res[j].Pkg {
+			return res[i].Pkg < res[j].Pkg
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// markAvailable returns a copy of the available benchmarks av, marking those with results in any
+// of the variants runs.
+func markAvailable(av []runner.Available, runs []variantRun) []runner.Available {
+	bs := make(bench.Set)
+	for _, r := range runs {
+		for name, bb := range r.results {
+			bs[name] = append(bs[name], bb...)
+		}
+	}
+	res := append([]runner.Available(nil), av...)
+	runner.MarkResults(res, bs)
+	return res
+}
+
+// availableBenchmarks returns the benchmarks available in target t. They are listed from the
+// target's test binaries if not known from a previous run or if refresh is set, keeping whether
+// they had results in the most recent run.
+func (e *exporter) availableBenchmarks(ctx context.Context, t *config.Target, refresh bool) ([]runner.Available, error) {
+	known, ok := e.available.Available(t.Name)
+	if ok && !refresh {
+		return known, nil
+	}
+	rt, _ := t.RunnerTarget(nil)
+	av, err := runner.List(ctx, rt)
+	if err != nil {
+		return nil, err
+	}
+	for i := range av {
+		for _, k := range known {
+			if k.Pkg == av[i].Pkg && k.Name == av[i].Name {
+				av[i].Results = k.Results
+			}
+		}
+	}
+	e.available.Set(t.Name, av)
+	return av, nil
+}
+
+// targetBenchmarks are the benchmarks available in a target.
+type targetBenchmarks struct {
+	Target     string             `json:"target"`
+	Benchmarks []runner.Available `json:"benchmarks"`
+}
+
+// availableHandler serves the benchmarks available in the target given in the target parameter
+// (all targets if omitted) as JSON. The benchmarks of targets not run yet are listed from their
+// test binaries without running them; the refresh parameter forces listing them.
+func (e *exporter) availableHandler(w http.ResponseWriter, r *http.Request) {
+	res, err := e.targetBenchmarks(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		log.Printf("Failed to encode available benchmarks: %v", err)
+	}
+}
+
+// targetBenchmarks returns the available benchmarks of the targets selected by the target and
+// refresh parameters of r.
+func (e *exporter) targetBenchmarks(r *http.Request) ([]targetBenchmarks, error) {
+	cfg := e.config()
+	params := r.URL.Query()
+	targets := cfg.Targets
+	if name := params.Get("target"); name != "" {
+		t := cfg.Target(name)
+		if t == nil {
+			return nil, fmt.Errorf("unknown target %q", name)
+		}
+		targets = []*config.Target{t}
+	}
+	refresh, _ := strconv.ParseBool(params.Get("refresh"))
+	res := []targetBenchmarks{}
+	for _, t := range targets {
+		av, err := e.availableBenchmarks(r.Context(), t, refresh)
+		if err != nil {
+			log.Printf("Failed to list benchmarks of target %q: %v", t.Name, err)
+			return nil, fmt.Errorf("failed to list benchmarks of target %q: %v", t.Name, err)
+		}
+		if av == nil {
+			av = []runner.Available{}
+		}
+		res = append(res, targetBenchmarks{Target: t.Name, Benchmarks: av})
+	}
+	return res, nil
+}
+
+// availablePage is the page listing the available benchmarks of each target, from which a subset
+// can be selected to run.
+var availablePage = template.Must(template.New("available").Parse(`<html>
+<head><title>Available benchmarks</title></head>
+<body>
+<h1>Available benchmarks</h1>
+{{range .Targets}}
+<h2>{{.Target}}</h2>
+<form action="{{$.TriggerPath}}">
+<input type="hidden" name="target" value="{{.Target}}">
+<table>
+<tr><th></th><th>Package</th><th>Benchmark</th><th>Results in most recent run</th></tr>
+{{range .Benchmarks}}<tr><td><input type="checkbox" name="benchmark" value="{{.Name}}"></td><td>{{.Pkg}}</td><td>{{.Name}}</td><td>{{if .Results}}yes{{else}}no{{end}}</td></tr>
+{{end}}</table>
+<input type="submit" value="Run selected benchmarks">
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// availablePageHandler returns a handler serving the page listing the available benchmarks,
+// which runs the selected benchmarks using the trigger endpoint at triggerPath.
+func (e *exporter) availablePageHandler(triggerPath string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res, err := e.targetBenchmarks(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data := struct {
+			TriggerPath string
+			Targets     []targetBenchmarks
+		}{triggerPath, res}
+		if err := availablePage.Execute(w, data); err != nil {
+			log.Printf("Failed to render available benchmarks: %v", err)
+		}
+	}
+}
+
+// profileHandler serves the profiles stored with runs in the history store at
+// /runs/{id}/profiles/{benchmark}, in a format go tool pprof reads over HTTP. The kind parameter
+// selects the cpu (default) or mem profile, or the execution trace. If the benchmark was not
+// profiled on its own, the profile of its package is served.
+func (e *exporter) profileHandler(w http.ResponseWriter, r *http.Request) {
+	if e.history == nil {
+		http.Error(w, "profiles require a history store", http.StatusNotFound)
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/runs/"), "/", 3)
+	if len(parts) != 3 || parts[1] != "profiles" || parts[2] == "" {
+		http.NotFound(w, r)
+		return
+	}
+	run, err := e.history.Get(parts[0])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("unknown run %q", parts[0]), http.StatusNotFound)
+		return
+	}
+	kind := r.URL.Query().Get("kind")
+	if kind == "" {
+		kind = runner.CPUProfile
+	}
+	p := run.FindProfile(parts[2], kind)
+	if p == nil {
+		http.Error(w, fmt.Sprintf("no %s profile of benchmark %q in run %s", kind, parts[2], run.ID), http.StatusNotFound)
+		return
+	}
+	path, err := e.history.ProfilePath(run.ID, p.File)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", p.File))
+	http.ServeFile(w, r, path)
+}
+
+// profileDiffHandler serves the per-function change between the profiles of a benchmark in the
+// base and head runs at /api/profiles/diff?base=<run>&head=<run>&benchmark=<name>. The kind
+// parameter selects the cpu (default) or mem profiles, format selects json (default), text or
+// pprof, and top limits the number of functions (default 20, 0 for all).
+func (e *exporter) profileDiffHandler(w http.ResponseWriter, r *http.Request) {
+	if e.history == nil {
+		http.Error(w, "profile diffs require a history store", http.StatusNotFound)
+		return
+	}
+	params := r.URL.Query()
+	base, head, benchmark := params.Get("base"), params.Get("head"), params.Get("benchmark")
+	if base == "" || head == "" || benchmark == "" {
+		http.Error(w, "base, head and benchmark are required", http.StatusBadRequest)
+		return
+	}
+	kind := params.Get("kind")
+	if kind == "" {
+		kind = runner.CPUProfile
+	}
+	format := params.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	top := 20
+	if s := params.Get("top"); s != "" {
+		var err error
+		if top, err = strconv.Atoi(s); err != nil || top < 0 {
+			http.Error(w, fmt.Sprintf("invalid top %q", s), http.StatusBadRequest)
+			return
+		}
+	}
+	contentType, ok := map[string]string{
+		"json":  "application/json",
+		"text":  "text/plain; charset=utf-8",
+		"pprof": "application/octet-stream",
+	}[format]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+		return
+	}
+	bp, err := runProfile(e.history, base, benchmark, kind)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	hp, err := runProfile(e.history, head, benchmark, kind)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	var buf bytes.Buffer
+	if err := writeProfileDiff(&buf, bp, hp, format, top); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(buf.Bytes())
+}
+
+// reloadHandler reloads the configuration upon POST requests.
+func (e *exporter) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "This endpoint requires a POST request.", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := e.reload(); err != nil {
+		log.Printf("Failed to reload configuration: %v", err)
+		http.Error(w, fmt.Sprintf("failed to reload configuration: %v", err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tklauser/gobench_exporter/collector"
+)
+
+func TestBenchmarksRegex(t *testing.T) {
+	re := benchmarksRegex([]string{"BenchmarkFoo", "", "MySuite.BenchmarkBar"})
+	if want := `^(BenchmarkFoo|MySuite\.BenchmarkBar)$`; re != want {
+		t.Fatalf("benchmarksRegex = %q, want %q", re, want)
+	}
+	for name, want := range map[string]bool{
+		"BenchmarkFoo":         true,
+		"MySuite.BenchmarkBar": true,
+		"BenchmarkFooBar":      false,
+		"MySuiteXBenchmarkBar": false,
+	} {
+		if got := regexp.MustCompile(re).MatchString(name); got != want {
+			t.Errorf("%q matches %q: %v, want %v", re, name, got, want)
+		}
+	}
+	if re := benchmarksRegex(nil); re != "" {
+		t.Errorf("benchmarksRegex(nil) = %q, want empty", re)
+	}
+}
+
+func TestAcquireRun(t *testing.T) {
+	e := &exporter{running: make(chan struct{}, 1)}
+	release, err := e.acquireRun(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := e.acquireRun(ctx); err == nil {
+		t.Fatal("acquireRun succeeded during another run")
+	}
+	release()
+	release, err = e.acquireRun(context.Background())
+	if err != nil {
+		t.Fatalf("acquireRun after release: %v", err)
+	}
+	release()
+}
+
+func TestWriteTextfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobench-textfile-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "gobench.prom")
+	if err := writeTextfile(filename, prometheus.NewRegistry()); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The node exporter reading the file may run as another user.
+	if mode := fi.Mode().Perm(); mode != 0644 {
+		t.Errorf("mode of textfile = %v, want %v", mode, os.FileMode(0644))
+	}
+}
+
+func TestTriggerStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobench-trigger-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Building the test binaries of a directory without packages fails.
+	e := newExporter("", collector.NameSanitize, defaultConfig(dir), nil, nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/trigger", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
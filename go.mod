@@ -4,11 +4,14 @@ go 1.14
 
 require (
 	github.com/google/go-cmp v0.3.1
+	github.com/google/pprof v0.0.0-20210407192527-94a9f03dee38
 	github.com/kr/pretty v0.1.0 // indirect
 	github.com/prometheus/client_golang v1.3.0
+	github.com/prometheus/client_model v0.2.0
 	github.com/prometheus/common v0.10.0
 	github.com/stretchr/testify v1.4.0 // indirect
 	golang.org/x/tools v0.0.0-20200721223218-6123e77877b2
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,303 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package history stores the benchmark results of past runs.
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tklauser/gobench_exporter/bench"
+	"github.com/tklauser/gobench_exporter/runner"
+	"github.com/tklauser/gobench_exporter/sysenv"
+	"github.com/tklauser/gobench_exporter/traces"
+)
+
+// idFormat is the time format used to derive run IDs. IDs sort in chronological order.
+const idFormat = "20060102T150405.000000000Z"
+
+// Run is a single run of the benchmarks of a target.
+type Run struct {
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	Target  string    `json:"target"`
+	Profile string    `json:"profile,omitempty"`
+	// Variant is the build matrix variant of the target, empty for targets without a matrix.
+	Variant string `json:"variant,omitempty"`
+	// Labels are the labels identifying the variant, e.g. its Go version.
+	Labels map[string]string `json:"labels,omitempty"`
+	Commit string            `json:"commit,omitempty"` // git commit of the target, if known
+	// Environment is the state of the machine taken before the run, if known.
+	Environment *sysenv.Reading `json:"environment,omitempty"`
+	// Usage is the resource usage of the test binaries per package.
+	Usage []runner.Usage `json:"usage,omitempty"`
+	// Profiles are the pprof profiles and execution traces recorded during the run.
+	Profiles []ProfileFile `json:"profiles,omitempty"`
+	// Traces are the summaries of the execution traces per package.
+	Traces  []traces.Package `json:"traces,omitempty"`
+	Results bench.Set        `json:"results"`
+	// PGOResults are the results of the benchmarks built with a PGO profile merged from the CPU
+	// profiles of the run, if measured.
+	PGOResults bench.Set `json:"pgo_results,omitempty"`
+}
+
+// ProfileFile is a pprof profile or execution trace stored with a run.
+type ProfileFile struct {
+	Pkg string `json:"pkg"`
+	// Benchmark is the profiled benchmark (without GOMAXPROCS suffix), or empty if the profile
+	// covers all benchmarks of the package.
+	Benchmark string `json:"benchmark,omitempty"`
+	Kind      string `json:"kind"` // cpu, mem or trace
+	File      string `json:"file"` // name of the file in the profile directory of the run
+}
+
+// FindProfile returns the profile of the given kind of benchmark, which is given with or without
+// GOMAXPROCS suffix. If the benchmark was not profiled on its own, the profile of its package is
+// returned. It returns nil if there is no such profile.
+func (r *Run) FindProfile(benchmark, kind string) *ProfileFile {
+	base, _, _ := bench.ParseName(benchmark)
+	pkg, found := "", false
+	for name, bb := range r.Results {
+		if len(bb) == 0 {
+			continue
+		}
+		if n, _, _ := bench.ParseName(name); name == benchmark || n == base {
+			pkg, found = bb[0].Pkg, true
+			break
+		}
+	}
+	var pkgProfile *ProfileFile
+	for i := range r.Profiles {
+		p := &r.Profiles[i]
+		switch {
+		case p.Kind != kind:
+		case (p.Benchmark == base || p.Benchmark == benchmark) && (!found || p.Pkg == pkg):
+			return p
+		case found && p.Benchmark == "" && p.Pkg == pkg:
+			pkgProfile = p
+		}
+	}
+	return pkgProfile
+}
+
+// Store is a directory holding one JSON file per run.
+type Store struct {
+	dir string
+}
+
+// Open returns the store in dir, creating the directory if necessary.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+func (s *Store) filename(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// assign assigns the time and ID of r if unset.
+func (s *Store) assign(r *Run) {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	if r.ID == "" {
+		r.ID = r.Time.UTC().Format(idFormat)
+	}
+}
+
+// Add records r in the store. If unset, the time and ID of r are assigned.
+func (s *Store) Add(r *Run) error {
+	s.assign(r)
+	content, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(s.dir, r.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.filename(r.ID))
+}
+
+// validID reports whether id is a valid run ID, i.e. does not refer to a file outside the
+// store.
+func validID(id string) bool {
+	return id != "" && !strings.ContainsAny(id, `/\`) && !strings.HasPrefix(id, ".")
+}
+
+// profileDir returns the directory holding the profiles of run id.
+func (s *Store) profileDir(id string) string {
+	return filepath.Join(s.dir, id+".profiles")
+}
+
+// AddWithProfiles records r in the store like Add, along with the profiles in r.Profiles. srcs
+// are the paths of the profile files, in the order of r.Profiles.
+func (s *Store) AddWithProfiles(r *Run, srcs []string) error {
+	if len(srcs) != len(r.Profiles) {
+		return fmt.Errorf("%d profile files given for %d profiles", len(srcs), len(r.Profiles))
+	}
+	s.assign(r)
+	for i, p := range r.Profiles {
+		dst, err := s.ProfilePath(r.ID, p.File)
+		if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadFile(srcs[i])
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(dst, content, 0644); err != nil {
+			return err
+		}
+	}
+	return s.Add(r)
+}
+
+// ProfilePath returns the path of the profile file of the run with the given ID.
+func (s *Store) ProfilePath(id, file string) (string, error) {
+	if !validID(id) || !validID(file) {
+		return "", fmt.Errorf("invalid run ID %q or profile file %q", id, file)
+	}
+	return filepath.Join(s.profileDir(id), file), nil
+}
+
+// Get returns the run with the given ID.
+func (s *Store) Get(id string) (*Run, error) {
+	if !validID(id) {
+		return nil, fmt.Errorf("invalid run ID %q", id)
+	}
+	content, err := ioutil.ReadFile(s.filename(id))
+	if err != nil {
+		return nil, err
+	}
+	r := &Run{}
+	if err := json.Unmarshal(content, r); err != nil {
+		return nil, fmt.Errorf("parsing run %s: %v", id, err)
+	}
+	return r, nil
+}
+
+// ids returns the IDs of the runs in the store in chronological order.
+func (s *Store) ids() ([]string, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, fi := range files {
+		id := strings.TrimSuffix(fi.Name(), ".json")
+		if fi.IsDir() || id == fi.Name() {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// runHeader holds the fields identifying what was run, decoded without the rest of a run.
+type runHeader struct {
+	Target  string `json:"target"`
+	Profile string `json:"profile"`
+	Variant string `json:"variant"`
+}
+
+// walk calls fn for the runs in the store whose header is accepted by match, from the most recent
+// to the oldest, until fn returns false. Only accepted runs are decoded in full. Files that
+// cannot be read or parsed are logged and skipped, so that a single corrupt file does not hide
+// the rest of the history.
+func (s *Store) walk(match func(runHeader) bool, fn func(*Run) bool) error {
+	ids, err := s.ids()
+	if err != nil {
+		return err
+	}
+	for i := len(ids) - 1; i >= 0; i-- {
+		id := ids[i]
+		content, err := ioutil.ReadFile(s.filename(id))
+		if err != nil {
+			log.Printf("Skipping run %s in history store: %v", id, err)
+			continue
+		}
+		var h runHeader
+		if err := json.Unmarshal(content, &h); err != nil {
+			log.Printf("Skipping run %s in history store: %v", id, err)
+			continue
+		}
+		if !match(h) {
+			continue
+		}
+		r := &Run{}
+		if err := json.Unmarshal(content, r); err != nil {
+			log.Printf("Skipping run %s in history store: %v", id, err)
+			continue
+		}
+		if !fn(r) {
+			break
+		}
+	}
+	return nil
+}
+
+// Runs returns the most recent limit runs (all runs if limit is 0) of the given target (of all
+// targets if empty) in chronological order.
+func (s *Store) Runs(target string, limit int) ([]*Run, error) {
+	var runs []*Run
+	err := s.walk(func(h runHeader) bool {
+		return target == "" || h.Target == target
+	}, func(r *Run) bool {
+		runs = append(runs, r)
+		return limit <= 0 || len(runs) < limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(runs)-1; i < j; i, j = i+1, j-1 {
+		runs[i], runs[j] = runs[j], runs[i]
+	}
+	return runs, nil
+}
+
+// Latest returns the most recent run of the given target (of any target if empty), variant and
+// profile, or nil if there is none.
+func (s *Store) Latest(target, variant, profile string) (*Run, error) {
+	var latest *Run
+	err := s.walk(func(h runHeader) bool {
+		return (target == "" || h.Target == target) && h.Variant == variant && h.Profile == profile
+	}, func(r *Run) bool {
+		latest = r
+		return false
+	})
+	return latest, err
+}
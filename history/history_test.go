@@ -0,0 +1,179 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package history_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tklauser/gobench_exporter/bench"
+	"github.com/tklauser/gobench_exporter/history"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobench-history-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := history.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+	runs := []*history.Run{
+		{Time: t0.Add(2 * time.Hour), Target: "a", Commit: "c2"},
+		{Time: t0, Target: "a", Commit: "c1", Results: bench.Set{
+			"BenchmarkFoo": {{Name: "BenchmarkFoo", N: 10, NsPerOp: 100, Measured: bench.NsPerOp}},
+		}},
+		{Time: t0.Add(time.Hour), Target: "b"},
+		{Time: t0.Add(3 * time.Hour), Target: "a", Variant: "go1.14", Commit: "c3"},
+		{Time: t0.Add(4 * time.Hour), Target: "a", Profile: "quick", Commit: "c4"},
+	}
+	for _, r := range runs {
+		if err := s.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A corrupt file is skipped rather than failing to read the rest of the history.
+	if err := ioutil.WriteFile(filepath.Join(dir, "corrupt.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		limit int
+		want  []string
+	}{
+		{0, []string{"c1", "c2", "c3", "c4"}},
+		{2, []string{"c3", "c4"}},
+	} {
+		got, err := s.Runs("a", tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var commits []string
+		for _, r := range got {
+			commits = append(commits, r.Commit)
+		}
+		if diff := cmp.Diff(tt.want, commits); diff != "" {
+			t.Errorf("Runs(\"a\", %d) commits mismatch (-want +got):\n%s", tt.limit, diff)
+		}
+	}
+
+	for _, tt := range []struct {
+		target, variant, profile string
+		want                     string
+	}{
+		{"", "", "", "c2"},
+		{"a", "", "", "c2"},
+		{"a", "go1.14", "", "c3"},
+		{"a", "", "quick", "c4"},
+		{"a", "go1.15", "", ""},
+	} {
+		latest, err := s.Latest(tt.target, tt.variant, tt.profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if latest != nil {
+			got = latest.Commit
+		}
+		if got != tt.want {
+			t.Errorf("Latest(%q, %q, %q) = %q, want %q", tt.target, tt.variant, tt.profile, got, tt.want)
+		}
+	}
+
+	r, err := s.Get(runs[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(runs[1].Results, r.Results); diff != "" {
+		t.Errorf("Get results mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := s.Get("../etc/passwd"); err == nil {
+		t.Error("Get with path traversal succeeded")
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobench-history-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := history.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "src.pprof")
+	if err := ioutil.WriteFile(src, []byte("profile"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := &history.Run{
+		Target: "a",
+		Profiles: []history.ProfileFile{
+			{Pkg: "example.com/a", Kind: "cpu", File: "a.cpu.pprof"},
+			{Pkg: "example.com/a", Benchmark: "BenchmarkFoo", Kind: "cpu", File: "a.BenchmarkFoo.cpu.pprof"},
+		},
+		Results: bench.Set{
+			"BenchmarkFoo-8": {{Name: "BenchmarkFoo-8", Pkg: "example.com/a"}},
+			"BenchmarkBar-8": {{Name: "BenchmarkBar-8", Pkg: "example.com/a"}},
+		},
+	}
+	if err := s.AddWithProfiles(r, []string{src, src}); err != nil {
+		t.Fatal(err)
+	}
+	r, err = s.Get(r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		benchmark, kind, want string
+	}{
+		{"BenchmarkFoo-8", "cpu", "a.BenchmarkFoo.cpu.pprof"},
+		{"BenchmarkFoo", "cpu", "a.BenchmarkFoo.cpu.pprof"},
+		{"BenchmarkBar", "cpu", "a.cpu.pprof"},
+		{"BenchmarkBar", "mem", ""},
+		{"BenchmarkBaz", "cpu", ""},
+	} {
+		got := ""
+		if p := r.FindProfile(tt.benchmark, tt.kind); p != nil {
+			got = p.File
+		}
+		if got != tt.want {
+			t.Errorf("FindProfile(%q, %q) = %q, want %q", tt.benchmark, tt.kind, got, tt.want)
+		}
+	}
+
+	path, err := s.ProfilePath(r.ID, "a.cpu.pprof")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := ioutil.ReadFile(path); err != nil || string(content) != "profile" {
+		t.Errorf("profile file = %q, %v, want %q", content, err, "profile")
+	}
+	if _, err := s.ProfilePath(r.ID, "../a.json"); err == nil {
+		t.Error("ProfilePath with path traversal succeeded")
+	}
+}
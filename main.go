@@ -15,120 +15,65 @@
 package main
 
 import (
-	"fmt"
-	"log"
-	"net/http"
 	"os"
-	"os/exec"
 
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/version"
-	"github.com/tklauser/gobench_exporter/bench"
 	"github.com/tklauser/gobench_exporter/collector"
+	"github.com/tklauser/gobench_exporter/config"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
-// TODO: pass base directory of Go module, invoke `go test -bench` upon trigger (HTTP), report
-// metrics
-
-type handler struct {
-	repoPath  string
-	collector *collector.GoBenchCollector
+// globalFlags holds the flags shared by all commands.
+type globalFlags struct {
+	nameEscaping string
 }
 
-func newHandler(repoPath string, collector *collector.GoBenchCollector) *handler {
-	return &handler{
-		repoPath:  repoPath,
-		collector: collector,
-	}
+// escaping returns the configured name escaping.
+func (g *globalFlags) escaping() (collector.NameEscaping, error) {
+	return collector.ParseNameEscaping(g.nameEscaping)
 }
 
-// ServeHTTP implements http.Handler.
-func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	goArgs := []string{"test", "-run=_NONE_", "-bench=."}
-	gocheckArgs := []string{"test", "-check.b", "-check.bmem"}
-
-	for _, args := range [][]string{goArgs, gocheckArgs} {
-		cmd := exec.Command("go", args...)
-		cmd.Dir = h.repoPath
-		stdout, err := cmd.StdoutPipe()
-		if err != nil {
-			log.Printf("Failed to get command stdout: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		log.Printf("Running go command %v", cmd)
-		if err := cmd.Start(); err != nil {
-			log.Printf("Failed to start command: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		bs, err := bench.ParseSet(stdout)
-		if err == nil {
-			log.Print(bs)
-			w.Write([]byte(fmt.Sprintf("%v\n", bs)))
-		}
-
-		if err := cmd.Wait(); err != nil {
-			log.Printf("Failed to wait for command to exit: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-	}
+// filterFlags registers the flags configuring a benchmark filter using the given flag name
+// prefix. The scope is appended to the flag descriptions.
+func filterFlags(cmd *kingpin.CmdClause, prefix, scope string) *config.FilterConfig {
+	f := &config.FilterConfig{}
+	cmd.Flag(
+		prefix+".include-benchmarks",
+		"Only export benchmarks with names matching this regular expression"+scope+".",
+	).StringVar(&f.IncludeBenchmarks)
+	cmd.Flag(
+		prefix+".exclude-benchmarks",
+		"Do not export benchmarks with names matching this regular expression"+scope+".",
+	).StringVar(&f.ExcludeBenchmarks)
+	cmd.Flag(
+		prefix+".include-packages",
+		"Only export benchmarks of packages matching this regular expression"+scope+".",
+	).StringVar(&f.IncludePackages)
+	cmd.Flag(
+		prefix+".exclude-packages",
+		"Do not export benchmarks of packages matching this regular expression"+scope+".",
+	).StringVar(&f.ExcludePackages)
+	return f
 }
 
 func main() {
-	var (
-		listenAddress = kingpin.Flag(
-			"web.listen-address",
-			"Address on which to expose metrics.",
-		).Default(":9777").String()
-		metricsPath = kingpin.Flag(
-			"web.telemetry-path",
-			"Path under which to expose metrics.",
-		).Default("/metrics").String()
-		triggerPath = kingpin.Flag(
-			"web.trigger-path",
-			"Path under which to trigger benchmarks.",
-		).Default("/trigger").String()
-		repoPath = kingpin.Flag(
-			"fs.repo-path",
-			"Filesystem path of the Go package to benchmark.",
-		).Default(".").String()
-	)
-
-	kingpin.Version(version.Print("gobench_exporter"))
-	kingpin.HelpFlag.Short('h')
-	kingpin.Parse()
-
-	log.Printf("Starting gobench_exporter version %s", version.Info())
-	log.Printf("Benchmarking Go packages in directory %s", *repoPath)
-
-	c := collector.NewGoBenchCollector(os.Stdin)
-	if err := prometheus.Register(c); err != nil {
-		log.Fatalf("Failed to register collector: %v", err)
-	}
-	h := newHandler(*repoPath, c)
-
-	http.Handle(*metricsPath, promhttp.Handler())
-	http.Handle(*triggerPath, h)
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`<html>
-			<head><title>Go Benchmark Exporter</title></head>
-			<body>
-			<h1>Go Benchmark Exporter</h1>
-			<p><a href="` + *metricsPath + `">Metrics</a></p>
-			<p><a href="` + *triggerPath + `">Trigger benchmarks</a></p>
-			</body>
-			</html>`))
-	})
-
-	log.Printf("Listening on %s", *listenAddress)
-	if err := http.ListenAndServe(*listenAddress, nil); err != nil {
-		log.Fatalf("Error listening on %s: %s", *listenAddress, err)
-		os.Exit(1)
-	}
+	app := kingpin.New("gobench_exporter", "Prometheus exporter for Go benchmark results.")
+	g := &globalFlags{}
+	app.Flag(
+		"metrics.name-escaping",
+		"How to convert benchmark names into metric names: sanitize (lossy) or escape (reversible).",
+	).Default("sanitize").EnumVar(&g.nameEscaping, "sanitize", "escape")
+
+	registerServeCommand(app, g)
+	registerRunCommand(app, g)
+	registerParseCommand(app, g)
+	registerCompareCommand(app)
+	registerCheckCommand(app)
+	registerCompareRefsCommand(app)
+	registerProfileDiffCommand(app)
+	registerExportCommand(app, g)
+
+	app.Version(version.Print("gobench_exporter"))
+	app.HelpFlag.Short('h')
+	kingpin.MustParse(app.Parse(os.Args[1:]))
 }
@@ -0,0 +1,325 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/tklauser/gobench_exporter/bench"
+	"github.com/tklauser/gobench_exporter/collector"
+	"github.com/tklauser/gobench_exporter/config"
+	"github.com/tklauser/gobench_exporter/profiles"
+	"github.com/tklauser/gobench_exporter/regression"
+	"github.com/tklauser/gobench_exporter/runner"
+	"github.com/tklauser/gobench_exporter/sysenv"
+	"github.com/tklauser/gobench_exporter/traces"
+)
+
+// goVersionLabel is the label holding the Go version of toolchain matrix variants.
+const goVersionLabel = "go_version"
+
+// variantRun holds the results of running the benchmarks of one variant of a target.
+type variantRun struct {
+	variant config.Variant
+	labels  map[string]string // labels identifying the variant, attached to all its benchmarks
+	env     *sysenv.Reading   // state of the machine before the run, nil if unknown
+	usage   []runner.Usage    // resource usage of the test binaries per package
+	// available are the benchmarks of the target's packages, whether run or not.
+	available []runner.Available
+	// profiles are the recorded pprof profiles, stored in profileDir until cleanup is called.
+	profiles   []runner.Profile
+	profileDir string
+	results    bench.Set
+	// pgoResults are the results of running the benchmarks again with a PGO profile merged from
+	// the CPU profiles, if enabled.
+	pgoResults bench.Set
+	// traces are the summaries of the recorded execution traces per package.
+	traces []traces.Package
+	runID  string // ID of the run in the history store, once recorded
+}
+
+// cleanup removes the recorded profiles of r.
+func (r variantRun) cleanup() {
+	if r.profileDir != "" {
+		os.RemoveAll(r.profileDir)
+	}
+}
+
+// cleanupRuns removes the recorded profiles of runs.
+func cleanupRuns(runs []variantRun) {
+	for _, r := range runs {
+		r.cleanup()
+	}
+}
+
+// runVariants runs the benchmarks of all variants of target t's build matrix using profile p.
+// The results of each variant are labeled with its build matrix dimensions and Go version.
+// If non-nil, override adjusts the runner target and benchmark regular expression of each
+// variant. The state of the machine is read (and checked, if configured) before each variant. If
+// enabled by p, the benchmarks of each variant are run again with a PGO profile.
+// Variants failing to run are skipped; the first error is returned along with the results of the
+// others. If the machine is too noisy, the remaining variants are not run. The most recent
+// reading is returned as well. The caller must clean up the returned runs.
+func runVariants(ctx context.Context, cfg *config.Config, t *config.Target, p *config.Profile, override func(*runner.Target, string) string) ([]variantRun, *sysenv.Reading, error) {
+	variants, benchRegex := cfg.Variants(t, p)
+	var (
+		runs     []variantRun
+		lastEnv  *sysenv.Reading
+		firstErr error
+	)
+	for _, v := range variants {
+		re := benchRegex
+		if override != nil {
+			re = override(&v.Target, re)
+		}
+		vr := variantRun{variant: v}
+		if len(v.Labels) > 0 {
+			vr.labels = make(map[string]string, len(v.Labels)+1)
+			for k, l := range v.Labels {
+				vr.labels[k] = l
+			}
+		}
+		if len(t.Toolchains) > 0 {
+			goVersion, err := runner.GoVersion(ctx, v.Target)
+			if err != nil {
+				err = fmt.Errorf("variant %s: %v", v.Name, err)
+				log.Printf("Skipping variant %s of target %q: %v", v.Name, t.Name, err)
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			if vr.labels == nil {
+				vr.labels = make(map[string]string, 1)
+			}
+			vr.labels[goVersionLabel] = goVersion
+		}
+		env, err := readEnvironment(ctx, cfg.Global.Preflight, cfg.Global.Environment)
+		if env != nil {
+			lastEnv = env
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			break
+		}
+		vr.env = env
+		if v.Target.Profiling != nil {
+			if vr.profileDir, err = ioutil.TempDir("", "gobench-profiles-"); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			opts := *v.Target.Profiling
+			opts.Dir = vr.profileDir
+			v.Target.Profiling = &opts
+		}
+		res, err := runner.RunDetailed(ctx, v.Target, re)
+		if err != nil && firstErr == nil {
+			if v.Name != "" {
+				err = fmt.Errorf("variant %s: %v", v.Name, err)
+			}
+			firstErr = err
+		}
+		if len(res.Benchmarks) == 0 {
+			vr.cleanup()
+			continue
+		}
+		vr.results = res.Benchmarks
+		vr.usage = res.Usage
+		vr.available = res.Available
+		for _, prof := range res.Profiles {
+			// E.g. a test binary failed before writing its profiles.
+			if _, err := os.Stat(prof.Path); err == nil {
+				vr.profiles = append(vr.profiles, prof)
+			}
+		}
+		vr.traces = summarizeTraces(ctx, v.Target, vr.profiles)
+		if p != nil && p.Profiling != nil && p.Profiling.PGO != nil {
+			if err := runPGO(ctx, t, v, p.Profiling.PGO, re, &vr); err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("pgo: %v", err)
+			}
+		}
+		runs = append(runs, vr)
+	}
+	return runs, lastEnv, firstErr
+}
+
+// readEnvironment takes a reading of the machine before running benchmarks if preflight is
+// non-nil or the environment is to be recorded, and returns nil otherwise. If preflight is
+// non-nil, the reading is checked and an error is returned if the benchmarks should not be run.
+// Otherwise, failing to take a reading is not an error.
+func readEnvironment(ctx context.Context, preflight *sysenv.Options, record bool) (*sysenv.Reading, error) {
+	switch {
+	case preflight != nil:
+		return preflight.Wait(ctx, sysenv.DefaultFS)
+	case !record:
+		return nil, nil
+	}
+	env, err := sysenv.DefaultFS.Read(sysenv.DefaultOptions.SampleInterval, sysenv.DefaultOptions.BusyCPU)
+	if err != nil {
+		log.Printf("Failed to read the state of the machine: %v", err)
+		return nil, nil
+	}
+	return env, nil
+}
+
+// source returns the source of the results of r of target t, labeled with the variant.
+func (r variantRun) source(t *config.Target) collector.Source {
+	src := t.Source()
+	if len(r.labels) == 0 {
+		return src
+	}
+	labels := make(map[string]string, len(src.Labels)+len(r.labels))
+	for k, v := range src.Labels {
+		labels[k] = v
+	}
+	for k, v := range r.labels {
+		labels[k] = v
+	}
+	src.Labels = labels
+	return src
+}
+
+// compareVariants compares the results of each variant with those of the first one, i.e. the
+// first value of each build matrix dimension.
+func compareVariants(runs []variantRun, th *regression.Thresholds) []collector.VariantComparison {
+	if len(runs) < 2 {
+		return nil
+	}
+	base := runs[0]
+	cmps := make([]collector.VariantComparison, 0, len(runs)-1)
+	for _, r := range runs[1:] {
+		cmps = append(cmps, collector.VariantComparison{
+			Base:    base.variant.Name,
+			Head:    r.variant.Name,
+			Results: regression.Check(base.results, r.results, th),
+		})
+	}
+	return cmps
+}
+
+// writeVariantResults writes the results of runs as benchmark output, preceded by configuration
+// lines identifying the variant, followed by the comparisons without and with PGO and the
+// cross-variant comparisons.
+func writeVariantResults(w io.Writer, runs []variantRun, th *regression.Thresholds) error {
+	for i, r := range runs {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if r.variant.Name != "" {
+			fmt.Fprintf(w, "variant: %s\n", r.variant.Name)
+		}
+		keys := make([]string, 0, len(r.labels))
+		for k := range r.labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s: %s\n", k, r.labels[k])
+		}
+		if err := bench.WriteText(w, r.results); err != nil {
+			return err
+		}
+	}
+	for _, r := range runs {
+		if r.pgoResults == nil {
+			continue
+		}
+		fmt.Fprintln(w)
+		if r.variant.Name != "" {
+			fmt.Fprintf(w, "%s: ", r.variant.Name)
+		}
+		fmt.Fprintln(w, "without vs. with PGO")
+		if err := regression.WriteReport(w, regression.Check(r.results, r.pgoResults, th), th.Alpha); err != nil {
+			return err
+		}
+	}
+	for _, cmp := range compareVariants(runs, th) {
+		fmt.Fprintf(w, "\n%s vs. %s\n", cmp.Base, cmp.Head)
+		if err := regression.WriteReport(w, cmp.Results, th.Alpha); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// topProfiles returns the n functions with the most flat CPU time in each CPU profile of r.
+func topProfiles(r variantRun, n int) []collector.ProfileTop {
+	var tops []collector.ProfileTop
+	for _, p := range r.profiles {
+		if p.Kind != runner.CPUProfile {
+			continue
+		}
+		f, err := os.Open(p.Path)
+		if err != nil {
+			log.Printf("Failed to open profile: %v", err)
+			continue
+		}
+		prof, err := profiles.Parse(f)
+		f.Close()
+		if err != nil {
+			log.Printf("Failed to parse profile %s: %v", p.Path, err)
+			continue
+		}
+		funcs, err := profiles.Top(prof, n)
+		if err != nil {
+			log.Printf("Failed to analyze profile %s: %v", p.Path, err)
+			continue
+		}
+		tops = append(tops, collector.ProfileTop{Pkg: p.Pkg, Benchmark: p.Benchmark, Functions: funcs})
+	}
+	return tops
+}
+
+// summarizeTraces summarizes the execution traces among profs per package, using the Go
+// toolchain of rt to parse them.
+func summarizeTraces(ctx context.Context, rt runner.Target, profs []runner.Profile) []traces.Package {
+	var (
+		res []traces.Package
+		idx = make(map[string]int)
+	)
+	for _, p := range profs {
+		if p.Kind != runner.Trace {
+			continue
+		}
+		var s *traces.Summary
+		err := runner.DumpTrace(ctx, rt, p.Path, func(r io.Reader) error {
+			var err error
+			s, err = traces.Parse(r)
+			return err
+		})
+		if err != nil {
+			log.Printf("Failed to summarize trace %s: %v", p.Path, err)
+			continue
+		}
+		i, ok := idx[p.Pkg]
+		if !ok {
+			i = len(res)
+			idx[p.Pkg] = i
+			res = append(res, traces.Package{Pkg: p.Pkg})
+		}
+		res[i].Add(*s)
+	}
+	return res
+}
@@ -0,0 +1,131 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/google/pprof/profile"
+	"github.com/tklauser/gobench_exporter/config"
+	"github.com/tklauser/gobench_exporter/profiles"
+	"github.com/tklauser/gobench_exporter/runner"
+)
+
+// unsafePathChars matches characters of variant names replaced in directory names.
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._=,-]`)
+
+// mergeCPUProfiles merges the CPU profiles of r of the packages for which use returns true (all
+// packages if use is nil). It returns nil if there are no such profiles.
+func mergeCPUProfiles(r variantRun, use func(pkg string) bool) (*profile.Profile, error) {
+	var ps []*profile.Profile
+	for _, p := range r.profiles {
+		if p.Kind != runner.CPUProfile || use != nil && !use(p.Pkg) {
+			continue
+		}
+		prof, err := readProfile(p.Path)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, prof)
+	}
+	if len(ps) == 0 {
+		return nil, nil
+	}
+	return profiles.Merge(ps)
+}
+
+// writeProfileFile writes the profile p to path, creating its directory if necessary.
+func writeProfileFile(path string, p *profile.Profile) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := p.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writePGOProfiles writes a PGO profile for each main package of the variant v of target t to
+// the output directory of pc, merged from the CPU profiles of r of the packages the main package
+// uses.
+func writePGOProfiles(ctx context.Context, t *config.Target, v config.Variant, pc *config.PGOConfig, r variantRun) error {
+	mains, err := runner.MainPackages(ctx, v.Target)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(pc.OutputDir, t.Name)
+	if v.Name != "" {
+		dir = filepath.Join(dir, unsafePathChars.ReplaceAllString(v.Name, "_"))
+	}
+	for _, m := range mains {
+		p, err := mergeCPUProfiles(r, m.Uses)
+		if err != nil {
+			return err
+		}
+		if p == nil {
+			log.Printf("No CPU profiles of packages used by %s", m.ImportPath)
+			continue
+		}
+		path := filepath.Join(dir, filepath.FromSlash(m.ImportPath), "default.pgo")
+		if err := writeProfileFile(path, p); err != nil {
+			return err
+		}
+		log.Printf("Wrote PGO profile %s", path)
+	}
+	return nil
+}
+
+// runPGO merges the CPU profiles of r, the run of variant v of target t, into a PGO profile and
+// runs the benchmarks matching benchRegex again, built with the PGO profile. The results are
+// stored in r.
+func runPGO(ctx context.Context, t *config.Target, v config.Variant, pc *config.PGOConfig, benchRegex string, r *variantRun) error {
+	p, err := mergeCPUProfiles(*r, nil)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return fmt.Errorf("no CPU profiles recorded")
+	}
+	path := filepath.Join(r.profileDir, "default.pgo")
+	if err := writeProfileFile(path, p); err != nil {
+		return err
+	}
+	if pc.OutputDir != "" {
+		if err := writePGOProfiles(ctx, t, v, pc, *r); err != nil {
+			log.Printf("Failed to write PGO profiles of target %q: %v", t.Name, err)
+		}
+	}
+
+	rt := v.Target
+	rt.GoArgs = append(append([]string(nil), rt.GoArgs...), "-pgo="+path)
+	rt.Profiling = nil
+	// The PGO profile differs from run to run, so caching the test binaries is pointless.
+	rt.CacheDir = ""
+	bs, err := runner.Run(ctx, rt, benchRegex)
+	if len(bs) > 0 {
+		r.pgoResults = bs
+	}
+	return err
+}
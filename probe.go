@@ -0,0 +1,147 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tklauser/gobench_exporter/bench"
+	"github.com/tklauser/gobench_exporter/collector"
+	"github.com/tklauser/gobench_exporter/config"
+	"github.com/tklauser/gobench_exporter/runner"
+)
+
+// prober runs the benchmarks of a target on request and exposes only the results of that run,
+// following the multi-target exporter pattern of the blackbox and snmp exporters.
+type prober struct {
+	exporter      *exporter
+	repoPath      string
+	timeoutOffset time.Duration
+}
+
+func newProber(e *exporter, repoPath string, timeoutOffset time.Duration) *prober {
+	return &prober{
+		exporter:      e,
+		repoPath:      repoPath,
+		timeoutOffset: timeoutOffset,
+	}
+}
+
+// resolveTarget returns the configured target with the given name. Otherwise, name is treated as
+// a package path to benchmark in the default repository.
+func (p *prober) resolveTarget(cfg *config.Config, name string) (*config.Target, error) {
+	if t := cfg.Target(name); t != nil {
+		return t, nil
+	}
+	if strings.HasPrefix(name, "-") || strings.ContainsAny(name, " \t\n") {
+		return nil, fmt.Errorf("invalid target %q", name)
+	}
+	return &config.Target{Name: name, RepoPath: p.repoPath, Packages: []string{name}}, nil
+}
+
+// probeTimeout returns the time available to run benchmarks for a scrape, based on the timeout
+// announced by Prometheus in the X-Prometheus-Scrape-Timeout-Seconds header. A zero duration
+// means no timeout.
+func probeTimeout(r *http.Request, offset time.Duration) (time.Duration, error) {
+	v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if v == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.ParseFloat(v, 64)
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("invalid scrape timeout %q", v)
+	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > offset {
+		timeout -= offset
+	}
+	return timeout, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (p *prober) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cfg := p.exporter.config()
+	params := r.URL.Query()
+	target, err := p.resolveTarget(cfg, params.Get("target"))
+	if params.Get("target") == "" {
+		err = fmt.Errorf("target parameter is missing")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	profile, err := cfg.Profile(params.Get("profile"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rt, benchRegex := target.RunnerTarget(profile)
+	if params.Get("bench") != "" {
+		benchRegex = params.Get("bench")
+	}
+	if _, err := regexp.Compile(benchRegex); err != nil {
+		http.Error(w, fmt.Sprintf("invalid bench parameter: %v", err), http.StatusBadRequest)
+		return
+	}
+	timeout, err := probeTimeout(r, p.timeoutOffset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	probeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gobench_probe_success",
+		Help: "Whether the benchmarks of the target ran successfully",
+	})
+	probeDuration := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "gobench_probe_duration_seconds",
+		Help: "Time taken to run the benchmarks of the target",
+	})
+	c := collector.NewGoBenchCollectorWithOptions(cfg.CollectorOptions(p.exporter.escaping))
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(probeSuccess, probeDuration, c)
+
+	var bs bench.Set
+	release, err := p.exporter.acquireRun(ctx)
+	if err == nil {
+		start := time.Now()
+		bs, err = runner.Run(ctx, rt, benchRegex)
+		probeDuration.Set(time.Since(start).Seconds())
+		release()
+	}
+	if err != nil {
+		log.Printf("Probe of target %q failed: %v", target.Name, err)
+	} else {
+		probeSuccess.Set(1)
+	}
+	c.Update(bs, target.Source())
+
+	collector.Handler(registry, c.Unit).ServeHTTP(w, r)
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProbeTimeout(t *testing.T) {
+	timeouts := []struct {
+		header  string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"10", 9500 * time.Millisecond, false},
+		{"0.25", 250 * time.Millisecond, false},
+		{"-1", 0, true},
+		{"foo", 0, true},
+	}
+
+	for _, tt := range timeouts {
+		r := httptest.NewRequest("GET", "/probe?target=default", nil)
+		if tt.header != "" {
+			r.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", tt.header)
+		}
+		got, err := probeTimeout(r, 500*time.Millisecond)
+		if !tt.wantErr && err != nil {
+			t.Errorf("probeTimeout(%q): %v", tt.header, err)
+		} else if tt.wantErr && err == nil {
+			t.Errorf("probeTimeout(%q): want an error, got nil", tt.header)
+		}
+		if got != tt.want {
+			t.Errorf("probeTimeout(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
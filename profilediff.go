@@ -0,0 +1,150 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/pprof/profile"
+	"github.com/tklauser/gobench_exporter/history"
+	"github.com/tklauser/gobench_exporter/profiles"
+	"github.com/tklauser/gobench_exporter/runner"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// Output formats of profile diffs.
+var profileDiffFormats = []string{"text", "json", "pprof"}
+
+// readProfile reads the pprof profile in the file at path.
+func readProfile(path string) (*profile.Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, err := profiles.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("parsing profile %s: %v", path, err)
+	}
+	return p, nil
+}
+
+// runProfile reads the profile of the given kind of benchmark stored with run id.
+func runProfile(store *history.Store, id, benchmark, kind string) (*profile.Profile, error) {
+	r, err := store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	pf := r.FindProfile(benchmark, kind)
+	if pf == nil {
+		return nil, fmt.Errorf("no %s profile of benchmark %q in run %s", kind, benchmark, id)
+	}
+	path, err := store.ProfilePath(id, pf.File)
+	if err != nil {
+		return nil, err
+	}
+	return readProfile(path)
+}
+
+// writeProfileDiff writes the difference between the base and head profiles to w in the given
+// format, limited to the top functions with the largest change unless top is 0. The pprof format
+// is a profile with the base samples negated, e.g. for go tool pprof.
+func writeProfileDiff(w io.Writer, base, head *profile.Profile, format string, top int) error {
+	if format == "pprof" {
+		p, err := profiles.DiffProfile(base, head)
+		if err != nil {
+			return err
+		}
+		return p.Write(w)
+	}
+	d, err := profiles.Compare(base, head)
+	if err != nil {
+		return err
+	}
+	d.Top(top)
+	switch format {
+	case "text":
+		return d.Write(w)
+	case "json":
+		return json.NewEncoder(w).Encode(d)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// profileDiffCommand prints the per-function change between two profiles.
+type profileDiffCommand struct {
+	base        string
+	head        string
+	benchmark   string
+	kind        string
+	historyPath string
+	format      string
+	top         int
+}
+
+func registerProfileDiffCommand(app *kingpin.Application) {
+	c := &profileDiffCommand{}
+	cmd := app.Command("profile-diff", "Compare the profiles of a benchmark in two runs, or two profile files.")
+	cmd.Arg("base", "ID of the base run in the history store, or a profile file.").Required().StringVar(&c.base)
+	cmd.Arg("head", "ID of the head run in the history store, or a profile file.").Required().StringVar(&c.head)
+	cmd.Flag(
+		"benchmark",
+		"Benchmark whose profiles to compare. Required for runs.",
+	).StringVar(&c.benchmark)
+	cmd.Flag("kind", "Kind of profile to compare.").Default(runner.CPUProfile).EnumVar(&c.kind, runner.CPUProfile, runner.MemProfile)
+	cmd.Flag(
+		"history.path",
+		"Directory of the history store holding the runs.",
+	).StringVar(&c.historyPath)
+	cmd.Flag("format", "Output format.").Default("text").EnumVar(&c.format, profileDiffFormats...)
+	cmd.Flag(
+		"top",
+		"Number of functions with the largest change to print. 0 prints all functions.",
+	).Default("20").IntVar(&c.top)
+	cmd.Action(c.run)
+}
+
+// profile reads the profile given by arg, a profile file or a run ID.
+func (c *profileDiffCommand) profile(store *history.Store, arg string) (*profile.Profile, error) {
+	if _, err := os.Stat(arg); err == nil {
+		return readProfile(arg)
+	}
+	if store == nil {
+		return nil, fmt.Errorf("%s is not a profile file, and --history.path is required for runs", arg)
+	}
+	if c.benchmark == "" {
+		return nil, fmt.Errorf("--benchmark is required for runs")
+	}
+	return runProfile(store, arg, c.benchmark, c.kind)
+}
+
+func (c *profileDiffCommand) run(*kingpin.ParseContext) error {
+	store, err := openHistory(c.historyPath)
+	if err != nil {
+		return err
+	}
+	base, err := c.profile(store, c.base)
+	if err != nil {
+		return err
+	}
+	head, err := c.profile(store, c.head)
+	if err != nil {
+		return err
+	}
+	return writeProfileDiff(os.Stdout, base, head, c.format, c.top)
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profiles
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/google/pprof/profile"
+)
+
+// FunctionDelta is the change of the samples of a function from a base to a head profile.
+type FunctionDelta struct {
+	Name     string  `json:"name"`
+	BaseFlat float64 `json:"base_flat"`
+	HeadFlat float64 `json:"head_flat"`
+	BaseCum  float64 `json:"base_cum"`
+	HeadCum  float64 `json:"head_cum"`
+	Flat     float64 `json:"flat"` // HeadFlat - BaseFlat
+	Cum      float64 `json:"cum"`  // HeadCum - BaseCum
+}
+
+// Diff is the per-function difference between two profiles.
+type Diff struct {
+	Unit      string          `json:"unit"`
+	BaseTotal float64         `json:"base_total"`
+	HeadTotal float64         `json:"head_total"`
+	Functions []FunctionDelta `json:"functions"`
+}
+
+// total returns the sum of the samples of the analyzed sample type of p.
+func total(p *profile.Profile) (float64, error) {
+	idx, err := sampleIndex(p)
+	if err != nil {
+		return 0, err
+	}
+	var t float64
+	for _, s := range p.Sample {
+		t += float64(s.Value[idx])
+	}
+	return t, nil
+}
+
+// Compare returns the change of the flat and cumulative samples of each function from base to
+// head, sorted by decreasing absolute change of the flat and then the cumulative samples.
+// Functions whose samples did not change are omitted.
+func Compare(base, head *profile.Profile) (*Diff, error) {
+	bi, err := sampleIndex(base)
+	if err != nil {
+		return nil, err
+	}
+	hi, err := sampleIndex(head)
+	if err != nil {
+		return nil, err
+	}
+	if bt, ht := base.SampleType[bi], head.SampleType[hi]; bt.Type != ht.Type || bt.Unit != ht.Unit {
+		return nil, fmt.Errorf("incompatible profiles: %s/%s and %s/%s samples", bt.Type, bt.Unit, ht.Type, ht.Unit)
+	}
+	d := &Diff{Unit: Unit(head)}
+	if d.BaseTotal, err = total(base); err != nil {
+		return nil, err
+	}
+	if d.HeadTotal, err = total(head); err != nil {
+		return nil, err
+	}
+	baseFuncs, err := Functions(base)
+	if err != nil {
+		return nil, err
+	}
+	headFuncs, err := Functions(head)
+	if err != nil {
+		return nil, err
+	}
+	deltas := make(map[string]*FunctionDelta)
+	get := func(name string) *FunctionDelta {
+		fd, ok := deltas[name]
+		if !ok {
+			fd = &FunctionDelta{Name: name}
+			deltas[name] = fd
+		}
+		return fd
+	}
+	for _, f := range baseFuncs {
+		fd := get(f.Name)
+		fd.BaseFlat, fd.BaseCum = f.Flat, f.Cum
+	}
+	for _, f := range headFuncs {
+		fd := get(f.Name)
+		fd.HeadFlat, fd.HeadCum = f.Flat, f.Cum
+	}
+	for _, fd := range deltas {
+		fd.Flat = fd.HeadFlat - fd.BaseFlat
+		fd.Cum = fd.HeadCum - fd.BaseCum
+		if fd.Flat != 0 || fd.Cum != 0 {
+			d.Functions = append(d.Functions, *fd)
+		}
+	}
+	sort.Slice(d.Functions, func(i, j int) bool {
+		fi, fj := d.Functions[i], d.Functions[j]
+		if math.Abs(fi.Flat) != math.Abs(fj.Flat) {
+			return math.Abs(fi.Flat) > math.Abs(fj.Flat)
+		}
+		if math.Abs(fi.Cum) != math.Abs(fj.Cum) {
+			return math.Abs(fi.Cum) > math.Abs(fj.Cum)
+		}
+		return fi.Name < fj.Name
+	})
+	return d, nil
+}
+
+// Top limits d to the n functions with the largest change. n <= 0 means no limit.
+func (d *Diff) Top(n int) {
+	if n > 0 && len(d.Functions) > n {
+		d.Functions = d.Functions[:n]
+	}
+}
+
+// Write writes d as a table to w.
+func (d *Diff) Write(w io.Writer) error {
+	fmt.Fprintf(w, "unit: %s, base total: %.6g, head total: %.6g\n", d.Unit, d.BaseTotal, d.HeadTotal)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "base flat\thead flat\tflat delta\tbase cum\thead cum\tcum delta\tfunction\t")
+	for _, f := range d.Functions {
+		fmt.Fprintf(tw, "%.6g\t%.6g\t%+.6g\t%.6g\t%.6g\t%+.6g\t%s\t\n",
+			f.BaseFlat, f.HeadFlat, f.Flat, f.BaseCum, f.HeadCum, f.Cum, f.Name)
+	}
+	return tw.Flush()
+}
+
+// DiffProfile returns a profile holding the samples of head and the negated samples of base,
+// which pprof shows as the change from base to head, like with its -diff_base flag.
+func DiffProfile(base, head *profile.Profile) (*profile.Profile, error) {
+	neg := base.Copy()
+	neg.Scale(-1)
+	return profile.Merge([]*profile.Profile{head.Copy(), neg})
+}
@@ -0,0 +1,91 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profiles
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/pprof/profile"
+)
+
+func TestCompare(t *testing.T) {
+	base := testProfile(
+		int64(30), []string{"a", "main"},
+		int64(20), []string{"b", "main"},
+		int64(10), []string{"c", "main"},
+	)
+	head := testProfile(
+		int64(30), []string{"a", "main"},
+		int64(50), []string{"b", "main"},
+		int64(5), []string{"d", "c", "main"},
+	)
+
+	d, err := Compare(base, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Diff{
+		Unit:      "nanoseconds",
+		BaseTotal: 60,
+		HeadTotal: 85,
+		Functions: []FunctionDelta{
+			{Name: "b", BaseFlat: 20, HeadFlat: 50, BaseCum: 20, HeadCum: 50, Flat: 30, Cum: 30},
+			{Name: "c", BaseFlat: 10, HeadFlat: 0, BaseCum: 10, HeadCum: 5, Flat: -10, Cum: -5},
+			{Name: "d", BaseFlat: 0, HeadFlat: 5, BaseCum: 0, HeadCum: 5, Flat: 5, Cum: 5},
+			{Name: "main", BaseFlat: 0, HeadFlat: 0, BaseCum: 60, HeadCum: 85, Flat: 0, Cum: 25},
+		},
+	}
+	if diff := cmp.Diff(want, d); diff != "" {
+		t.Errorf("Compare() mismatch (-want +got):\n%s", diff)
+	}
+
+	d.Top(1)
+	var buf bytes.Buffer
+	if err := d.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(strings.TrimSpace(lines[2]), "b") {
+		t.Errorf("Write() = %q, want a header and a row for b", buf.String())
+	}
+
+	dp, err := DiffProfile(base, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	funcs, err := Functions(dp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flat := make(map[string]float64)
+	for _, f := range funcs {
+		flat[f.Name] = f.Flat
+	}
+	// Merging drops the samples of a, which cancel out.
+	wantFlat := map[string]float64{"b": 30, "c": -10, "d": 5, "main": 0}
+	if diff := cmp.Diff(wantFlat, flat); diff != "" {
+		t.Errorf("DiffProfile() flat samples mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCompareIncompatible(t *testing.T) {
+	mem := &profile.Profile{SampleType: []*profile.ValueType{{Type: "alloc_space", Unit: "bytes"}}}
+	if _, err := Compare(testProfile(), mem); err == nil {
+		t.Error("Compare() succeeded on a CPU and a memory profile")
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package profiles analyzes pprof profiles recorded while running benchmarks.
+package profiles
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/google/pprof/profile"
+)
+
+// Function is the share of a function in a profile.
+type Function struct {
+	Name string  `json:"name"`
+	Flat float64 `json:"flat"` // samples in the function itself, in the unit of the sample type
+	Cum  float64 `json:"cum"`  // samples in the function and its callees
+}
+
+// Parse parses a profile in any format supported by pprof, e.g. a gzipped protobuf.
+func Parse(r io.Reader) (*profile.Profile, error) {
+	return profile.Parse(r)
+}
+
+// sampleIndex returns the index of the sample type to analyze: cpu for CPU profiles, alloc_space
+// for memory profiles and the last sample type otherwise.
+func sampleIndex(p *profile.Profile) (int, error) {
+	if len(p.SampleType) == 0 {
+		return 0, fmt.Errorf("profile has no sample types")
+	}
+	for i, st := range p.SampleType {
+		if st.Type == "cpu" || st.Type == "alloc_space" {
+			return i, nil
+		}
+	}
+	return len(p.SampleType) - 1, nil
+}
+
+// Unit returns the unit of the analyzed sample type of p, e.g. "nanoseconds" or "bytes".
+func Unit(p *profile.Profile) string {
+	i, err := sampleIndex(p)
+	if err != nil {
+		return ""
+	}
+	return p.SampleType[i].Unit
+}
+
+// Functions returns the flat and cumulative samples of each function in p, sorted by decreasing
+// flat samples and name.
+func Functions(p *profile.Profile) ([]Function, error) {
+	idx, err := sampleIndex(p)
+	if err != nil {
+		return nil, err
+	}
+	funcs := make(map[string]*Function)
+	get := func(name string) *Function {
+		f, ok := funcs[name]
+		if !ok {
+			f = &Function{Name: name}
+			funcs[name] = f
+		}
+		return f
+	}
+	for _, s := range p.Sample {
+		v := float64(s.Value[idx])
+		seen := make(map[string]bool)
+		for i, loc := range s.Location {
+			// The innermost inlined function of the leaf location gets the flat samples.
+			for j, line := range loc.Line {
+				if line.Function == nil {
+					continue
+				}
+				name := line.Function.Name
+				if i == 0 && j == 0 {
+					get(name).Flat += v
+				}
+				if !seen[name] {
+					// Count recursive functions once per sample.
+					seen[name] = true
+					get(name).Cum += v
+				}
+			}
+		}
+	}
+	res := make([]Function, 0, len(funcs))
+	for _, f := range funcs {
+		res = append(res, *f)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Flat != res[j].Flat {
+			return res[i].Flat > res[j].Flat
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res, nil
+}
+
+// Top returns the n functions of p with the most flat samples.
+func Top(p *profile.Profile, n int) ([]Function, error) {
+	funcs, err := Functions(p)
+	if err != nil {
+		return nil, err
+	}
+	if len(funcs) > n {
+		funcs = funcs[:n]
+	}
+	return funcs, nil
+}
+
+// Merge merges profiles of the same kind, e.g. the CPU profiles of several benchmarks, into a
+// single profile, e.g. for profile-guided optimization.
+func Merge(ps []*profile.Profile) (*profile.Profile, error) {
+	if len(ps) == 0 {
+		return nil, fmt.Errorf("no profiles to merge")
+	}
+	return profile.Merge(ps)
+}
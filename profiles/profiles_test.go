@@ -0,0 +1,100 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profiles
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/pprof/profile"
+)
+
+// testProfile returns a CPU profile with the given samples, each a value and a stack of function
+// names, leaf first.
+func testProfile(samples ...interface{}) *profile.Profile {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "samples", Unit: "count"},
+			{Type: "cpu", Unit: "nanoseconds"},
+		},
+	}
+	funcs := make(map[string]*profile.Function)
+	for i := 0; i < len(samples); i += 2 {
+		s := &profile.Sample{Value: []int64{1, samples[i].(int64)}}
+		for _, name := range samples[i+1].([]string) {
+			f, ok := funcs[name]
+			if !ok {
+				f = &profile.Function{ID: uint64(len(funcs) + 1), Name: name}
+				funcs[name] = f
+				p.Function = append(p.Function, f)
+			}
+			loc := &profile.Location{ID: uint64(len(p.Location) + 1), Line: []profile.Line{{Function: f}}}
+			p.Location = append(p.Location, loc)
+			s.Location = append(s.Location, loc)
+		}
+		p.Sample = append(p.Sample, s)
+	}
+	return p
+}
+
+func TestFunctions(t *testing.T) {
+	p := testProfile(
+		int64(30), []string{"a", "b", "main"},
+		int64(20), []string{"b", "main"},
+		int64(10), []string{"c", "c", "main"},
+	)
+
+	// Round trip through the encoded form read from disk.
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := Unit(p); u != "nanoseconds" {
+		t.Errorf("Unit() = %q, want nanoseconds", u)
+	}
+
+	funcs, err := Functions(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Function{
+		{Name: "a", Flat: 30, Cum: 30},
+		{Name: "b", Flat: 20, Cum: 50},
+		{Name: "c", Flat: 10, Cum: 10},
+		{Name: "main", Flat: 0, Cum: 60},
+	}
+	if diff := cmp.Diff(want, funcs); diff != "" {
+		t.Errorf("Functions() mismatch (-want +got):\n%s", diff)
+	}
+
+	top, err := Top(p, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want[:2], top); diff != "" {
+		t.Errorf("Top() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFunctionsNoSampleTypes(t *testing.T) {
+	if _, err := Functions(&profile.Profile{}); err == nil {
+		t.Error("Functions() succeeded on a profile without sample types")
+	}
+}
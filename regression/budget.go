@@ -0,0 +1,165 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regression
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/tklauser/gobench_exporter/bench"
+	"gopkg.in/yaml.v2"
+)
+
+// Budget holds absolute limits for benchmark measurements, keyed by benchmark glob pattern and
+// unit, e.g.
+//
+//	BenchmarkParse*:
+//	  ns/op: 2000
+//	  allocs/op: 3
+//	  MB/s: 100
+//
+// The limits are ceilings, except for units where higher is better (see HigherIsBetter), for
+// which they are floors.
+type Budget struct {
+	entries []budgetEntry
+}
+
+type budgetEntry struct {
+	pattern string
+	limits  map[string]float64 // keyed by unit
+	match   func(string) bool
+}
+
+// ParseBudget parses a budget in YAML format.
+func ParseBudget(content []byte) (*Budget, error) {
+	var raw yaml.MapSlice
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+	b := &Budget{}
+	for _, item := range raw {
+		pattern, ok := item.Key.(string)
+		if !ok {
+			return nil, fmt.Errorf("benchmark pattern %v is not a string", item.Key)
+		}
+		re, err := globRegexp(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid benchmark pattern %q: %v", pattern, err)
+		}
+		value, err := yaml.Marshal(item.Value)
+		if err != nil {
+			return nil, err
+		}
+		var limits map[string]float64
+		if err := yaml.UnmarshalStrict(value, &limits); err != nil {
+			return nil, fmt.Errorf("%s: %v", pattern, err)
+		}
+		b.entries = append(b.entries, budgetEntry{pattern: pattern, limits: limits, match: re.MatchString})
+	}
+	return b, nil
+}
+
+// LoadBudget reads a budget from a YAML file.
+func LoadBudget(filename string) (*Budget, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ParseBudget(content)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", filename, err)
+	}
+	return b, nil
+}
+
+// Limit returns the strictest limit of all patterns matching the benchmark name in unit, i.e. the
+// lowest ceiling or, for units where higher is better, the highest floor.
+func (b *Budget) Limit(name, unit string) (float64, bool) {
+	floor := HigherIsBetter(unit)
+	limit, found := 0.0, false
+	for _, e := range b.entries {
+		l, ok := e.limits[unit]
+		if ok && e.match(name) && (!found || (l < limit) != floor) {
+			limit, found = l, true
+		}
+	}
+	return limit, found
+}
+
+// BudgetResult is the outcome of evaluating a benchmark in one unit against the budget.
+type BudgetResult struct {
+	Name  string
+	Unit  string
+	Value float64 // median of all samples
+	Limit float64
+	// Floor reports whether Limit is a floor rather than a ceiling, as for units where higher
+	// is better.
+	Floor     bool
+	Violation bool
+}
+
+// Evaluate checks the median of the samples of each benchmark in bs against the budget. Only
+// benchmarks and units with a limit are returned, sorted by benchmark name and unit.
+func (b *Budget) Evaluate(bs bench.Set) []BudgetResult {
+	var results []BudgetResult
+	for name, bb := range bs {
+		if len(bb) == 0 {
+			continue
+		}
+		for _, unit := range bb[len(bb)-1].Units() {
+			limit, ok := b.Limit(name, unit)
+			if !ok {
+				continue
+			}
+			value := bench.Summarize(bench.Values(bb, unit)).Median
+			floor := HigherIsBetter(unit)
+			results = append(results, BudgetResult{
+				Name:      name,
+				Unit:      unit,
+				Value:     value,
+				Limit:     limit,
+				Floor:     floor,
+				Violation: value > limit && !floor || value < limit && floor,
+			})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Name != results[j].Name {
+			return results[i].Name < results[j].Name
+		}
+		return results[i].Unit < results[j].Unit
+	})
+	return results
+}
+
+// WriteBudgetReport writes results to w as a table.
+func WriteBudgetReport(w io.Writer, results []BudgetResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "name\tunit\tvalue\tbudget\tstatus\t")
+	for _, r := range results {
+		status := "ok"
+		switch {
+		case r.Violation && r.Floor:
+			status = "UNDER BUDGET"
+		case r.Violation:
+			status = "OVER BUDGET"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.6g\t%.6g\t%s\t\n", r.Name, r.Unit, r.Value, r.Limit, status)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,182 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regression
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/tklauser/gobench_exporter/bench"
+)
+
+// HigherIsBetter reports whether larger values in unit indicate better performance, as is the
+// case for throughput units such as MB/s.
+func HigherIsBetter(unit string) bool {
+	return strings.HasSuffix(unit, "/s")
+}
+
+// MinSamples is the minimum number of samples on either side for the Mann-Whitney U test to be
+// able to find a change significant at the default alpha of 0.05. With fewer samples, p never
+// drops below 0.08.
+const MinSamples = 4
+
+// Result is the outcome of checking a benchmark in one unit.
+type Result struct {
+	Name string
+	Unit string
+	Old  bench.Summary
+	New  bench.Summary
+	// Change is the relative change of the median in percent. Positive values mean worse
+	// performance, regardless of the unit's direction.
+	Change float64
+	// P is the p-value of the Mann-Whitney U test comparing the old and new samples.
+	P float64
+	// Rule is the threshold rule applied, nil if the benchmark and unit are not checked.
+	Rule *Rule
+	// Unreliable is set if the old or new samples are too noisy for the change to count as a
+	// regression.
+	Unreliable bool
+	// TooFewSamples is set if the rule requires a significant change but the old or new side has
+	// fewer than MinSamples samples, so the change could never be significant. Such results are
+	// inconclusive unless the thresholds require samples, in which case the change is checked
+	// against the rule's threshold alone.
+	TooFewSamples bool
+	// Regression is set if the change violates the rule.
+	Regression bool
+}
+
+// Significant reports whether the change is statistically significant at level alpha.
+func (r *Result) Significant(alpha float64) bool {
+	return r.P < alpha
+}
+
+// worsening returns the relative worsening from old to new in percent.
+func worsening(old, new float64, higherIsBetter bool) float64 {
+	if higherIsBetter {
+		old, new = new, old
+	}
+	switch {
+	case old == new:
+		return 0
+	case old == 0:
+		return math.Inf(1)
+	}
+	return (new - old) / math.Abs(old) * 100
+}
+
+// Check compares the candidate benchmarks in new with the baseline in old. Benchmarks are matched
+// by name and all samples (e.g. from go test -count) of a benchmark are taken into account.
+// Changes of benchmarks exceeding the noise thresholds are not considered regressions. The
+// results are sorted by benchmark name and unit.
+func Check(old, new bench.Set, th *Thresholds) []Result {
+	var results []Result
+	for name, oldBB := range old {
+		newBB, ok := new[name]
+		if !ok || len(oldBB) == 0 || len(newBB) == 0 {
+			continue
+		}
+		for _, unit := range oldBB[0].Units() {
+			oldVs, newVs := bench.Values(oldBB, unit), bench.Values(newBB, unit)
+			if len(newVs) == 0 {
+				continue
+			}
+			r := Result{
+				Name: name,
+				Unit: unit,
+				Old:  bench.Summarize(oldVs),
+				New:  bench.Summarize(newVs),
+				P:    bench.MannWhitneyU(oldVs, newVs),
+				Rule: th.Rule(name, unit),
+			}
+			r.Change = worsening(r.Old.Median, r.New.Median, HigherIsBetter(unit))
+			_, _, oldNoisy, _ := noise(oldVs, th.Noise)
+			_, _, newNoisy, _ := noise(newVs, th.Noise)
+			r.Unreliable = oldNoisy || newNoisy
+			r.TooFewSamples = r.Rule != nil && r.Rule.Significant && (r.Old.N < MinSamples || r.New.N < MinSamples)
+			if r.Rule != nil && !r.Unreliable && r.Change > r.Rule.MaxPercent {
+				if r.TooFewSamples {
+					r.Regression = th.RequireSamples
+				} else {
+					r.Regression = !r.Rule.Significant || r.Significant(th.Alpha)
+				}
+			}
+			results = append(results, r)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Name != results[j].Name {
+			return results[i].Name < results[j].Name
+		}
+		return results[i].Unit < results[j].Unit
+	})
+	return results
+}
+
+// TooFewSamples returns the number of results whose rule requires a significant change but which
+// have too few samples to test for significance.
+func TooFewSamples(results []Result) int {
+	n := 0
+	for _, r := range results {
+		if r.TooFewSamples {
+			n++
+		}
+	}
+	return n
+}
+
+// Regressions returns the number of results violating their rule.
+func Regressions(results []Result) int {
+	n := 0
+	for _, r := range results {
+		if r.Regression {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteReport writes results to w as a table. The delta column shows the worsening of the median,
+// marked with "~" if not significant at level alpha.
+func WriteReport(w io.Writer, results []Result, alpha float64) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "name\tunit\told\tnew\tdelta\tp\tstatus\t")
+	for _, r := range results {
+		change := fmt.Sprintf("%+.2f%%", r.Change)
+		if !r.Significant(alpha) {
+			change += " (~)"
+		}
+		status := "ok"
+		switch {
+		case r.Rule == nil:
+			status = "-"
+		case r.Unreliable:
+			status = "unreliable (skipped)"
+		case r.Regression:
+			status = fmt.Sprintf("REGRESSION (> %g%%)", r.Rule.MaxPercent)
+		case r.TooFewSamples && r.Change > r.Rule.MaxPercent:
+			status = fmt.Sprintf("inconclusive (> %g%%, n < %d)", r.Rule.MaxPercent, MinSamples)
+		}
+		if r.TooFewSamples && r.Regression {
+			status += fmt.Sprintf(" (n < %d)", MinSamples)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.6g (n=%d)\t%.6g (n=%d)\t%s\tp=%.3f\t%s\t\n",
+			r.Name, r.Unit, r.Old.Median, r.Old.N, r.New.Median, r.New.N, change, r.P, status)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regression
+
+import (
+	"math"
+	"sort"
+
+	"github.com/tklauser/gobench_exporter/bench"
+)
+
+// NoiseOptions configures when a benchmark is considered unreliable.
+type NoiseOptions struct {
+	// MaxCV is the maximum coefficient of variation (standard deviation divided by mean) of the
+	// samples of a reliable benchmark.
+	MaxCV float64 `yaml:"max_cv,omitempty"`
+	// MaxRangeRatio is the maximum ratio of the range (max - min) of the samples to their
+	// median of a reliable benchmark.
+	MaxRangeRatio float64 `yaml:"max_range_ratio,omitempty"`
+}
+
+// DefaultNoiseOptions are the default noise options.
+var DefaultNoiseOptions = NoiseOptions{
+	MaxCV:         0.1,
+	MaxRangeRatio: 0.3,
+}
+
+// Noise describes the variation of the samples of a benchmark in one unit within a run.
+type Noise struct {
+	Name       string
+	Unit       string
+	N          int
+	CV         float64 // coefficient of variation
+	RangeRatio float64 // range of the samples divided by their median
+	// Trend is the change of the coefficient of variation per run over the recent runs, i.e.
+	// positive if the benchmark is getting noisier. It is zero without recent runs.
+	Trend      float64
+	Unreliable bool
+}
+
+// noise computes the noise of the samples vs, or returns false if there are less than two.
+func noise(vs []float64, opts NoiseOptions) (cv, rangeRatio float64, unreliable, ok bool) {
+	if len(vs) < 2 {
+		return 0, 0, false, false
+	}
+	s := bench.Summarize(vs)
+	if s.Mean != 0 {
+		cv = s.StdDev / math.Abs(s.Mean)
+	}
+	if s.Median != 0 {
+		rangeRatio = (s.Max - s.Min) / math.Abs(s.Median)
+	}
+	unreliable = cv > opts.MaxCV || rangeRatio > opts.MaxRangeRatio
+	return cv, rangeRatio, unreliable, true
+}
+
+// slope returns the slope of the least-squares line through ys at x = 0, 1, ...
+func slope(ys []float64) float64 {
+	n := float64(len(ys))
+	if n < 2 {
+		return 0
+	}
+	meanX, meanY := (n-1)/2, bench.Mean(ys)
+	num, den := 0.0, 0.0
+	for i, y := range ys {
+		dx := float64(i) - meanX
+		num += dx * (y - meanY)
+		den += dx * dx
+	}
+	return num / den
+}
+
+// AnalyzeNoise computes the noise of each benchmark and unit with at least two samples in bs.
+// recent holds the results of earlier runs in chronological order, used to compute the
+// stability trend. The results are sorted by benchmark name and unit.
+func AnalyzeNoise(bs bench.Set, recent []bench.Set, opts NoiseOptions) []Noise {
+	var res []Noise
+	for name, bb := range bs {
+		if len(bb) == 0 {
+			continue
+		}
+		for _, unit := range bb[len(bb)-1].Units() {
+			vs := bench.Values(bb, unit)
+			cv, rangeRatio, unreliable, ok := noise(vs, opts)
+			if !ok {
+				continue
+			}
+			var cvs []float64
+			for _, r := range recent {
+				if rcv, _, _, ok := noise(bench.Values(r[name], unit), opts); ok {
+					cvs = append(cvs, rcv)
+				}
+			}
+			res = append(res, Noise{
+				Name:       name,
+				Unit:       unit,
+				N:          len(vs),
+				CV:         cv,
+				RangeRatio: rangeRatio,
+				Trend:      slope(append(cvs, cv)),
+				Unreliable: unreliable,
+			})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Name != res[j].Name {
+			return res[i].Name < res[j].Name
+		}
+		return res[i].Unit < res[j].Unit
+	})
+	return res
+}
@@ -0,0 +1,203 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regression_test
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tklauser/gobench_exporter/bench"
+	"github.com/tklauser/gobench_exporter/regression"
+)
+
+func samples(name string, nsPerOp []float64, allocs uint64) []*bench.Benchmark {
+	var bb []*bench.Benchmark
+	for _, ns := range nsPerOp {
+		bb = append(bb, &bench.Benchmark{
+			Name:        name,
+			N:           1000,
+			NsPerOp:     ns,
+			AllocsPerOp: allocs,
+			Measured:    bench.NsPerOp | bench.AllocsPerOp,
+		})
+	}
+	return bb
+}
+
+func TestCheck(t *testing.T) {
+	old := bench.Set{
+		"BenchmarkSlower":  samples("BenchmarkSlower", []float64{100, 101, 102, 103, 104}, 1),
+		"BenchmarkNoisy":   samples("BenchmarkNoisy", []float64{100, 130, 90, 120, 95}, 1),
+		"BenchmarkSingle":  samples("BenchmarkSingle", []float64{100}, 1),
+		"BenchmarkAllocs":  samples("BenchmarkAllocs", []float64{100, 100, 100}, 1),
+		"BenchmarkOnlyOld": samples("BenchmarkOnlyOld", []float64{100}, 1),
+	}
+	new := bench.Set{
+		"BenchmarkSlower": samples("BenchmarkSlower", []float64{110, 111, 112, 113, 114}, 1),
+		"BenchmarkNoisy":  samples("BenchmarkNoisy", []float64{110, 95, 140, 100, 125}, 1),
+		"BenchmarkSingle": samples("BenchmarkSingle", []float64{200}, 1),
+		"BenchmarkAllocs": samples("BenchmarkAllocs", []float64{100, 100, 100}, 2),
+	}
+
+	type outcome struct {
+		Name, Unit                            string
+		Unreliable, TooFewSamples, Regression bool
+	}
+	var got []outcome
+	results := regression.Check(old, new, regression.DefaultThresholds())
+	for _, r := range results {
+		got = append(got, outcome{r.Name, r.Unit, r.Unreliable, r.TooFewSamples, r.Regression})
+	}
+	want := []outcome{
+		{"BenchmarkAllocs", "allocs/op", false, false, true},
+		{"BenchmarkAllocs", "ns/op", false, true, false},
+		{"BenchmarkNoisy", "allocs/op", false, false, false},
+		{"BenchmarkNoisy", "ns/op", true, false, false},
+		{"BenchmarkSingle", "allocs/op", false, false, false},
+		// A single sample can never be significant, so the change is inconclusive.
+		{"BenchmarkSingle", "ns/op", false, true, false},
+		{"BenchmarkSlower", "allocs/op", false, false, false},
+		{"BenchmarkSlower", "ns/op", false, false, true},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Check mismatch (-want +got):\n%s", diff)
+	}
+	if n := regression.Regressions(results); n != 2 {
+		t.Errorf("Regressions() = %d, want 2", n)
+	}
+	if n := regression.TooFewSamples(results); n != 2 {
+		t.Errorf("TooFewSamples() = %d, want 2", n)
+	}
+
+	th := regression.DefaultThresholds()
+	th.RequireSamples = true
+	for _, r := range regression.Check(old, new, th) {
+		if r.Name == "BenchmarkSingle" && r.Unit == "ns/op" && !r.Regression {
+			t.Error("BenchmarkSingle ns/op is no regression with RequireSamples")
+		}
+	}
+}
+
+func TestThresholdsRule(t *testing.T) {
+	f, err := ioutil.TempFile("", "thresholds-*.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`
+alpha: 0.01
+rules:
+  - benchmark: "BenchmarkHot/*"
+    unit: ns/op
+    max_percent: 1
+    significant: true
+  - unit: ns/op
+    max_percent: 10
+`)
+	f.Close()
+
+	th, err := regression.LoadThresholds(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if th.Alpha != 0.01 {
+		t.Errorf("Alpha = %v, want 0.01", th.Alpha)
+	}
+	tests := []struct {
+		name, unit string
+		want       float64 // MaxPercent of the matching rule, -1 if none
+	}{
+		{"BenchmarkHot/size=10-8", "ns/op", 1},
+		{"BenchmarkHotter", "ns/op", 10},
+		{"BenchmarkHot/size=10-8", "B/op", -1},
+	}
+	for _, tt := range tests {
+		got := -1.0
+		if r := th.Rule(tt.name, tt.unit); r != nil {
+			got = r.MaxPercent
+		}
+		if got != tt.want {
+			t.Errorf("Rule(%q, %q).MaxPercent = %v, want %v", tt.name, tt.unit, got, tt.want)
+		}
+	}
+}
+
+func TestBudgetEvaluate(t *testing.T) {
+	b, err := regression.ParseBudget([]byte(`
+BenchmarkParse*:
+  ns/op: 2000
+  allocs/op: 3
+  MB/s: 50
+BenchmarkParseLarge:
+  ns/op: 150
+  MB/s: 100
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs := bench.Set{
+		"BenchmarkParseSmall": samples("BenchmarkParseSmall", []float64{1500, 2500, 1800}, 4),
+		"BenchmarkParseLarge": samples("BenchmarkParseLarge", []float64{100, 200, 300}, 1),
+		"BenchmarkOther":      samples("BenchmarkOther", []float64{5000}, 10),
+	}
+	for _, b := range bs["BenchmarkParseSmall"] {
+		b.MBPerS, b.Measured = 60, b.Measured|bench.MBPerS
+	}
+	for _, b := range bs["BenchmarkParseLarge"] {
+		b.MBPerS, b.Measured = 80, b.Measured|bench.MBPerS
+	}
+	want := []regression.BudgetResult{
+		{Name: "BenchmarkParseLarge", Unit: "MB/s", Value: 80, Limit: 100, Floor: true, Violation: true},
+		{Name: "BenchmarkParseLarge", Unit: "allocs/op", Value: 1, Limit: 3},
+		{Name: "BenchmarkParseLarge", Unit: "ns/op", Value: 200, Limit: 150, Violation: true},
+		{Name: "BenchmarkParseSmall", Unit: "MB/s", Value: 60, Limit: 50, Floor: true},
+		{Name: "BenchmarkParseSmall", Unit: "allocs/op", Value: 4, Limit: 3, Violation: true},
+		{Name: "BenchmarkParseSmall", Unit: "ns/op", Value: 1800, Limit: 2000},
+	}
+	if diff := cmp.Diff(want, b.Evaluate(bs)); diff != "" {
+		t.Errorf("Evaluate mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAnalyzeNoise(t *testing.T) {
+	recent := []bench.Set{
+		{"BenchmarkA": samples("BenchmarkA", []float64{100, 101}, 1)},
+		{"BenchmarkA": samples("BenchmarkA", []float64{100, 110}, 1)},
+	}
+	bs := bench.Set{
+		"BenchmarkA": samples("BenchmarkA", []float64{100, 120, 140}, 1),
+		"BenchmarkB": samples("BenchmarkB", []float64{100}, 1),
+	}
+	got := regression.AnalyzeNoise(bs, recent, regression.DefaultNoiseOptions)
+	if len(got) != 2 {
+		t.Fatalf("got %d results, want 2: %+v", len(got), got)
+	}
+	allocs, ns := got[0], got[1]
+	if allocs.Unit != "allocs/op" || allocs.CV != 0 || allocs.Unreliable {
+		t.Errorf("unexpected allocs/op noise %+v", allocs)
+	}
+	if ns.Unit != "ns/op" || ns.N != 3 || math.Abs(ns.CV-1.0/6) > 1e-9 || ns.RangeRatio != 1.0/3 {
+		t.Errorf("unexpected ns/op noise %+v", ns)
+	}
+	if !ns.Unreliable {
+		t.Error("noisy benchmark not marked unreliable")
+	}
+	if ns.Trend <= 0 {
+		t.Errorf("Trend = %v, want positive", ns.Trend)
+	}
+}
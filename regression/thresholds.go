@@ -0,0 +1,139 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package regression detects performance regressions between benchmark runs.
+package regression
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultAlpha is the default significance level of the statistical test.
+const DefaultAlpha = 0.05
+
+// Rule limits how much the measurements of benchmarks in one unit may worsen.
+type Rule struct {
+	// Benchmark is a glob pattern matched against the benchmark name, "*" matching any
+	// sequence of characters including "/". Empty matches all benchmarks.
+	Benchmark string `yaml:"benchmark,omitempty"`
+	// Unit is the benchmark unit (e.g. "ns/op") the rule applies to. Empty matches all units.
+	Unit string `yaml:"unit,omitempty"`
+	// MaxPercent is the maximum permitted worsening in percent.
+	MaxPercent float64 `yaml:"max_percent"`
+	// Significant requires the change to be statistically significant to violate the rule.
+	Significant bool `yaml:"significant,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Thresholds is a list of rules. The first rule matching a benchmark and unit applies.
+type Thresholds struct {
+	Alpha float64 `yaml:"alpha,omitempty"`
+	Rules []*Rule `yaml:"rules"`
+	// Noise determines which benchmarks are too noisy for their changes to fail the check.
+	Noise NoiseOptions `yaml:"noise,omitempty"`
+	// RequireSamples makes changes beyond the threshold of rules requiring significance fail if
+	// there are too few samples to test for significance. By default, they are inconclusive.
+	RequireSamples bool `yaml:"require_samples,omitempty"`
+}
+
+// DefaultThresholds permits ns/op to worsen by up to 5% and fails on any significant change
+// beyond, and fails on any increase in B/op and allocs/op.
+func DefaultThresholds() *Thresholds {
+	th := &Thresholds{
+		Rules: []*Rule{
+			{Unit: "ns/op", MaxPercent: 5, Significant: true},
+			{Unit: "B/op", MaxPercent: 0},
+			{Unit: "allocs/op", MaxPercent: 0},
+		},
+	}
+	if err := th.Validate(); err != nil {
+		panic(err)
+	}
+	return th
+}
+
+// globRegexp converts a glob pattern into an anchored regular expression. "*" matches any
+// sequence of characters, "?" matches a single character.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	expr := regexp.QuoteMeta(pattern)
+	expr = strings.Replace(expr, `\*`, ".*", -1)
+	expr = strings.Replace(expr, `\?`, ".", -1)
+	return regexp.Compile("^" + expr + "$")
+}
+
+// Validate checks the thresholds for consistency and compiles the benchmark patterns.
+func (th *Thresholds) Validate() error {
+	if th.Alpha == 0 {
+		th.Alpha = DefaultAlpha
+	}
+	if th.Alpha < 0 || th.Alpha >= 1 {
+		return fmt.Errorf("alpha must be in (0, 1), got %v", th.Alpha)
+	}
+	if th.Noise.MaxCV == 0 {
+		th.Noise.MaxCV = DefaultNoiseOptions.MaxCV
+	}
+	if th.Noise.MaxRangeRatio == 0 {
+		th.Noise.MaxRangeRatio = DefaultNoiseOptions.MaxRangeRatio
+	}
+	if th.Noise.MaxCV < 0 || th.Noise.MaxRangeRatio < 0 {
+		return fmt.Errorf("noise thresholds must not be negative")
+	}
+	for i, r := range th.Rules {
+		if r.MaxPercent < 0 {
+			return fmt.Errorf("rule %d: max_percent must not be negative", i)
+		}
+		pattern := r.Benchmark
+		if pattern == "" {
+			pattern = "*"
+		}
+		re, err := globRegexp(pattern)
+		if err != nil {
+			return fmt.Errorf("rule %d: invalid benchmark pattern %q: %v", i, r.Benchmark, err)
+		}
+		r.re = re
+	}
+	return nil
+}
+
+// Rule returns the first rule matching the benchmark name and unit, or nil if there is none.
+func (th *Thresholds) Rule(name, unit string) *Rule {
+	for _, r := range th.Rules {
+		if (r.Unit == "" || r.Unit == unit) && r.re.MatchString(name) {
+			return r
+		}
+	}
+	return nil
+}
+
+// LoadThresholds reads thresholds from a YAML file.
+func LoadThresholds(filename string) (*Thresholds, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	th := &Thresholds{}
+	if err := yaml.UnmarshalStrict(content, th); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", filename, err)
+	}
+	if err := th.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return th, nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"log"
+
+	"github.com/tklauser/gobench_exporter/bench"
+)
+
+// RunAB runs the testing.B benchmarks matching benchRegex of target t at two git refs in an
+// interleaved fashion to cancel out drift of the machine: the test binaries of both refs are
+// built once (or taken from the cache), then run alternately (base, head, base, head, ...) for the given number of rounds.
+// It returns the results of the base and head refs.
+func RunAB(ctx context.Context, t Target, baseRef, headRef string, rounds int, benchRegex string) (base, head bench.Set, err error) {
+	if rounds < 1 {
+		rounds = 1
+	}
+	var bins [2][]testBinary
+	for i, ref := range []string{baseRef, headRef} {
+		dir, cleanup, err := Worktree(ctx, t.RepoPath, ref)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer cleanup()
+		bs, cleanupBins, err := t.testBinaries(ctx, dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer cleanupBins()
+		bins[i] = bs
+	}
+
+	_, testArgs := splitArgs(t.GoArgs)
+	results := [2]bench.Set{make(bench.Set), make(bench.Set)}
+	var ords [2]int
+	for round := 0; round < rounds; round++ {
+		log.Printf("Running A/B round %d of %d", round+1, rounds)
+		for _, b := range bins[0] {
+			for i := range bins {
+				// Run the binaries of the same package of both refs back to back.
+				for _, bi := range bins[i] {
+					if bi.Pkg != b.Pkg {
+						continue
+					}
+					args := append(benchArgs(benchRegex, testArgs), "-test.count=1")
+					if err := t.runBinary(ctx, bi, args, results[i], &ords[i], nil); err != nil {
+						return results[0], results[1], err
+					}
+				}
+			}
+		}
+	}
+	return results[0], results[1], nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"log"
+	"math"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tklauser/gobench_exporter/bench"
+)
+
+// AdaptiveOptions configures the adaptive repetition of benchmarks: each benchmark is run again
+// until the confidence interval of its ns/op results is narrow enough or a limit is reached.
+type AdaptiveOptions struct {
+	// MinRuns is the minimum number of samples per benchmark.
+	MinRuns int `yaml:"min_runs,omitempty"`
+	// MaxRuns is the maximum number of samples per benchmark.
+	MaxRuns int `yaml:"max_runs,omitempty"`
+	// TargetCI is the target half-width of the 95% confidence interval of the mean relative to
+	// the mean, e.g. 0.02 for ±2%.
+	TargetCI float64 `yaml:"target_ci,omitempty"`
+	// MaxTime is the time budget for repeating a single benchmark. Zero means no limit.
+	MaxTime time.Duration `yaml:"max_time,omitempty"`
+}
+
+// DefaultAdaptiveOptions are the default adaptive repetition options.
+var DefaultAdaptiveOptions = AdaptiveOptions{
+	MinRuns:  3,
+	MaxRuns:  20,
+	TargetCI: 0.02,
+}
+
+// stable reports whether the samples vs are numerous and consistent enough.
+func (o *AdaptiveOptions) stable(vs []float64) bool {
+	if len(vs) >= o.MaxRuns {
+		return true
+	}
+	if len(vs) < o.MinRuns {
+		return false
+	}
+	s := bench.Summarize(vs)
+	return s.Mean != 0 && s.ConfidenceInterval()/math.Abs(s.Mean) <= o.TargetCI
+}
+
+// benchProcs returns the GOMAXPROCS values the target's testing.B benchmarks run with using
+// testArgs: the values of -test.cpu if given, or else the GOMAXPROCS of the test binaries.
+func (t Target) benchProcs(testArgs []string) []int {
+	var cpu string
+	for i, arg := range testArgs {
+		switch {
+		case strings.HasPrefix(arg, "-test.cpu="):
+			cpu = strings.TrimPrefix(arg, "-test.cpu=")
+		case arg == "-test.cpu" && i+1 < len(testArgs):
+			cpu = testArgs[i+1]
+		}
+	}
+	if cpu != "" {
+		var procs []int
+		for _, v := range strings.Split(cpu, ",") {
+			if n, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && n > 0 {
+				procs = append(procs, n)
+			}
+		}
+		return procs
+	}
+
+	// The environment of the test binaries, see runBinary. Later values take precedence.
+	env := append(append(os.Environ(), t.Env...), t.Isolation.env()...)
+	for i := len(env) - 1; i >= 0; i-- {
+		if strings.HasPrefix(env[i], "GOMAXPROCS=") {
+			if n, err := strconv.Atoi(strings.TrimPrefix(env[i], "GOMAXPROCS=")); err == nil && n > 0 {
+				return []int{n}
+			}
+			break
+		}
+	}
+	if n := t.Isolation.numCPUs(); n > 0 {
+		return []int{n}
+	}
+	return []int{runtime.GOMAXPROCS(0)}
+}
+
+// trimProcs returns the benchmark name without the "-N" suffix appended by go test if N is one of
+// procs, the GOMAXPROCS values the benchmark ran with. Unlike bench.ParseName, it keeps a trailing
+// number which is part of the name, e.g. of "BenchmarkFoo/size-1024" run with GOMAXPROCS 1, for
+// which go test appends no suffix.
+func trimProcs(name string, procs []int) string {
+	if i := strings.LastIndexByte(name, '-'); i > 0 {
+		if n, err := strconv.Atoi(name[i+1:]); err == nil && n > 1 {
+			for _, p := range procs {
+				if p == n {
+					return name[:i]
+				}
+			}
+		}
+	}
+	return name
+}
+
+// exactBenchRegex returns the -bench argument selecting only the benchmark with the given name,
+// which ran with the GOMAXPROCS values procs. Sub-benchmark names are matched level by level.
+func exactBenchRegex(name string, procs []int) string {
+	parts := strings.Split(trimProcs(name, procs), "/")
+	for i, part := range parts {
+		parts[i] = "^" + regexp.QuoteMeta(part) + "$"
+	}
+	return strings.Join(parts, "/")
+}
+
+// repeat runs the testing.B benchmarks in res again one at a time using the test binaries bins,
+// merging the samples into res, until they are stable or the limits of the adaptive options are
+// reached. ord is the ordinal assigned to the next benchmark result. The resource usage of the
+// runs is added to us.
+func (t Target) repeat(ctx context.Context, res bench.Set, bins []testBinary, testArgs []string, ord *int, us usages) {
+	opts := t.Adaptive
+	procs := t.benchProcs(testArgs)
+	for _, first := range res.Benchmarks() {
+		name := first.Name
+		if !strings.HasPrefix(name, "Benchmark") || first.Ord != res[name][0].Ord {
+			// gocheck benchmark, or a benchmark already repeated
+			continue
+		}
+		var bin *testBinary
+		for i := range bins {
+			if bins[i].Pkg == first.Pkg {
+				bin = &bins[i]
+			}
+		}
+		if bin == nil {
+			continue
+		}
+		args := append(benchArgs(exactBenchRegex(name, procs), testArgs), "-test.count=1")
+
+		start := time.Now()
+		for !opts.stable(bench.Values(res[name], "ns/op")) {
+			if opts.MaxTime > 0 && time.Since(start) >= opts.MaxTime {
+				log.Printf("Time budget for repeating benchmark %s exhausted", name)
+				break
+			}
+			bs := make(bench.Set)
+			if err := t.runBinary(ctx, *bin, args, bs, ord, us); err != nil {
+				log.Printf("Failed to repeat benchmark %s: %v", name, err)
+			}
+			if len(bs[name]) == 0 {
+				break
+			}
+			res[name] = append(res[name], bs[name]...)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExactBenchRegex(t *testing.T) {
+	tests := []struct {
+		name  string
+		procs []int
+		want  string
+	}{
+		{"BenchmarkFoo", []int{8}, "^BenchmarkFoo$"},
+		{"BenchmarkFoo-8", []int{8}, "^BenchmarkFoo$"},
+		{"BenchmarkFoo-4", []int{1, 4}, "^BenchmarkFoo$"},
+		{"BenchmarkFoo/size=10/fast-8", []int{8}, "^BenchmarkFoo$/^size=10$/^fast$"},
+		{"BenchmarkFoo/a.b+c", []int{8}, `^BenchmarkFoo$/^a\.b\+c$`},
+		// No suffix is appended with GOMAXPROCS 1, so a trailing number belongs to the name.
+		{"BenchmarkFoo/size-1024", []int{1}, "^BenchmarkFoo$/^size-1024$"},
+		{"BenchmarkFoo/size-1024-8", []int{8}, "^BenchmarkFoo$/^size-1024$"},
+		{"BenchmarkFoo/size-1024", []int{8}, "^BenchmarkFoo$/^size-1024$"},
+	}
+	for _, tt := range tests {
+		if got := exactBenchRegex(tt.name, tt.procs); got != tt.want {
+			t.Errorf("exactBenchRegex(%q, %v) = %q, want %q", tt.name, tt.procs, got, tt.want)
+		}
+	}
+}
+
+func TestBenchProcs(t *testing.T) {
+	if os.Getenv("GOMAXPROCS") != "" {
+		t.Skip("GOMAXPROCS is set in the environment")
+	}
+	tests := []struct {
+		target   Target
+		testArgs []string
+		want     []int
+	}{
+		{Target{}, []string{"-test.cpu=1,2,4"}, []int{1, 2, 4}},
+		{Target{}, []string{"-test.benchtime=1s", "-test.cpu", "2"}, []int{2}},
+		{Target{Env: []string{"GOMAXPROCS=3"}}, nil, []int{3}},
+		{Target{Env: []string{"GOMAXPROCS=3"}, Isolation: &Isolation{GOMAXPROCS: 2}}, nil, []int{2}},
+		{Target{Isolation: &Isolation{CPUs: "0-2,5"}}, nil, []int{4}},
+	}
+	for _, tt := range tests {
+		if diff := cmp.Diff(tt.want, tt.target.benchProcs(tt.testArgs)); diff != "" {
+			t.Errorf("benchProcs(%q) mismatch (-want +got):\n%s", tt.testArgs, diff)
+		}
+	}
+}
+
+func TestAdaptiveStable(t *testing.T) {
+	opts := &AdaptiveOptions{MinRuns: 3, MaxRuns: 5, TargetCI: 0.02}
+	tests := []struct {
+		vs   []float64
+		want bool
+	}{
+		{[]float64{100, 100}, false},             // below MinRuns
+		{[]float64{100, 100.5, 99.5}, true},      // narrow interval
+		{[]float64{100, 120, 80}, false},         // wide interval
+		{[]float64{100, 120, 80, 130, 70}, true}, // MaxRuns reached
+	}
+	for _, tt := range tests {
+		if got := opts.stable(tt.vs); got != tt.want {
+			t.Errorf("stable(%v) = %v, want %v", tt.vs, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tklauser/gobench_exporter/bench"
+)
+
+// testFlags lists the go test flags passed on to the test binary, mapped to whether they are
+// boolean flags, see 'go help testflag'.
+var testFlags = map[string]bool{
+	"bench":                false,
+	"benchmem":             true,
+	"benchtime":            false,
+	"blockprofile":         false,
+	"blockprofilerate":     false,
+	"count":                false,
+	"cpu":                  false,
+	"cpuprofile":           false,
+	"failfast":             true,
+	"memprofile":           false,
+	"memprofilerate":       false,
+	"mutexprofile":         false,
+	"mutexprofilefraction": false,
+	"outputdir":            false,
+	"parallel":             false,
+	"run":                  false,
+	"short":                true,
+	"timeout":              false,
+	"trace":                false,
+	"v":                    true,
+}
+
+// splitArgs splits go test arguments into build flags, passed to go test -c, and test flags,
+// converted to the -test. prefixed form understood by the test binary.
+func splitArgs(args []string) (buildArgs, testArgs []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name := strings.TrimLeft(arg, "-")
+		if j := strings.IndexByte(name, '='); j >= 0 {
+			name = name[:j]
+		}
+		name = strings.TrimPrefix(name, "test.")
+		isBool, ok := testFlags[name]
+		if !ok || !strings.HasPrefix(arg, "-") {
+			buildArgs = append(buildArgs, arg)
+			continue
+		}
+		testArg := "-test." + strings.TrimPrefix(strings.TrimLeft(arg, "-"), "test.")
+		testArgs = append(testArgs, testArg)
+		if !isBool && !strings.Contains(arg, "=") && i+1 < len(args) {
+			i++
+			testArgs = append(testArgs, args[i])
+		}
+	}
+	return buildArgs, testArgs
+}
+
+// testBinary is a compiled test binary of a package.
+type testBinary struct {
+	Pkg     string `json:"pkg"`     // import path of the package
+	Dir     string `json:"dir"`     // directory of the package, in which the binary is run
+	Path    string `json:"path"`    // path of the binary
+	Gocheck bool   `json:"gocheck"` // whether the tests use gocheck
+	Cached  bool   `json:"-"`       // whether the binary is taken from the cache
+}
+
+// gocheckImportPath is the import path of gocheck.
+const gocheckImportPath = "gopkg.in/check.v1"
+
+// command returns a command invoking the target's go tool in dir with the target's environment.
+func (t Target) command(ctx context.Context, dir string, args ...string) *exec.Cmd {
+	goBinary := t.GoBinary
+	if goBinary == "" {
+		goBinary = "go"
+	}
+	cmd := exec.CommandContext(ctx, goBinary, args...)
+	cmd.Dir = dir
+	if len(t.Env) > 0 {
+		cmd.Env = append(os.Environ(), t.Env...)
+	}
+	return cmd
+}
+
+// output runs the go tool in dir and returns its output.
+func (t Target) output(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := t.command(ctx, dir, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// GoVersion returns the version of the Go toolchain used by the target, e.g. "go1.22.0".
+func GoVersion(ctx context.Context, t Target) (string, error) {
+	out, err := t.output(ctx, t.RepoPath, "env", "GOVERSION")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// buildTestBinaries compiles the test binaries of the target's packages in dir into outDir.
+// Packages without test files are skipped.
+func (t Target) buildTestBinaries(ctx context.Context, dir, outDir string) ([]testBinary, error) {
+	buildArgs, _ := splitArgs(t.GoArgs)
+
+	args := append([]string{"list"}, buildArgs...)
+	args = append(args, "-f", "{{if or .TestGoFiles .XTestGoFiles}}{{.ImportPath}}\t{{.Dir}}\t{{join .TestImports \",\"}},{{join .XTestImports \",\"}}{{end}}")
+	args = append(args, t.packages()...)
+	out, err := t.output(ctx, dir, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list packages: %v", err)
+	}
+
+	var bins []testBinary
+	scan := bufio.NewScanner(bytes.NewReader(out))
+	for scan.Scan() {
+		fields := strings.Split(scan.Text(), "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		b := testBinary{
+			Pkg:  fields[0],
+			Dir:  fields[1],
+			Path: filepath.Join(outDir, strings.Replace(fields[0], "/", "_", -1)+".test"),
+		}
+		for _, imp := range strings.Split(fields[2], ",") {
+			if imp == gocheckImportPath {
+				b.Gocheck = true
+			}
+		}
+		args := append([]string{"test", "-c", "-o", b.Path}, buildArgs...)
+		args = append(args, b.Pkg)
+		cmd := t.command(ctx, dir, args...)
+		log.Printf("Building test binary %v", cmd)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("failed to build test binary of %s: %v: %s", b.Pkg, err, strings.TrimSpace(string(out)))
+		}
+		bins = append(bins, b)
+	}
+	return bins, nil
+}
+
+// testBinaries returns the test binaries of the target's packages in dir, taking them from the
+// cache if possible. The returned function removes binaries which are not cached.
+func (t Target) testBinaries(ctx context.Context, dir string) ([]testBinary, func(), error) {
+	if t.CacheDir != "" {
+		key, err := t.cacheKey(ctx, dir)
+		if err == nil {
+			bins, err := t.cachedTestBinaries(ctx, dir, key)
+			return bins, func() {}, err
+		}
+		log.Printf("Not caching test binaries: %v", err)
+	}
+	tmp, err := ioutil.TempDir("", "gobench-bin-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+	bins, err := t.buildTestBinaries(ctx, dir, tmp)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return bins, cleanup, nil
+}
+
+// gctraceEnv returns the GODEBUG environment variable enabling gctrace in addition to the
+// GODEBUG settings of the environment env or of the exporter.
+func gctraceEnv(env []string) string {
+	godebug := os.Getenv("GODEBUG")
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "GODEBUG=") {
+			godebug = strings.TrimPrefix(kv, "GODEBUG=")
+		}
+	}
+	if godebug == "" {
+		return "GODEBUG=gctrace=1"
+	}
+	// Later settings take precedence.
+	return "GODEBUG=" + godebug + ",gctrace=1"
+}
+
+// gcSummary summarizes the gctrace lines in the standard error output stderr of a test binary
+// and removes them from it.
+func gcSummary(stderr *bytes.Buffer) bench.GCSummary {
+	var (
+		cycles []bench.GCCycle
+		rest   bytes.Buffer
+	)
+	for _, line := range strings.SplitAfter(stderr.String(), "\n") {
+		if c, ok := bench.ParseGCTraceLine(line); ok {
+			cycles = append(cycles, c)
+		} else {
+			rest.WriteString(line)
+		}
+	}
+	*stderr = rest
+	return bench.SummarizeGC(cycles)
+}
+
+// runBinary runs the test binary b with the given arguments and adds the benchmark results to
+// res and its resource usage to us. ord is the ordinal assigned to the first benchmark and is
+// advanced past the last one.
+func (t Target) runBinary(ctx context.Context, b testBinary, args []string, res bench.Set, ord *int, us usages) error {
+	name, args := t.Isolation.wrap(b.Path, args)
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = b.Dir
+	env := t.Isolation.env()
+	if t.GCTrace {
+		env = append(env, gctraceEnv(t.Env))
+	}
+	if len(t.Env)+len(env) > 0 {
+		cmd.Env = append(append(os.Environ(), t.Env...), env...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	log.Printf("Running test binary %v", cmd)
+	start := time.Now()
+	err := cmd.Start()
+	if err == nil {
+		// taskset, nice and ionice exec the test binary, keeping the PID.
+		s := startSampler(cmd.Process.Pid)
+		err = cmd.Wait()
+		u := processUsage(b.Pkg, cmd.ProcessState, time.Since(start), s)
+		if t.GCTrace {
+			gc := gcSummary(&stderr)
+			u.GC = &gc
+		}
+		us.add(u)
+	}
+	if bs, perr := bench.ParseSetPackage(&stdout, b.Pkg); perr == nil {
+		for _, bm := range bs.Benchmarks() {
+			bm.Ord = *ord
+			*ord++
+		}
+		res.Add(bs)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run test binary of %s: %v: %s", b.Pkg, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
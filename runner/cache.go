@@ -0,0 +1,135 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// manifestFile is the name of the file listing the binaries in a cache entry.
+const manifestFile = "manifest.json"
+
+// cacheKey returns the key of the test binaries of the target's packages in dir. It depends on
+// the commit checked out, the build flags, the environment and the Go version. An error is
+// returned if dir is not in a git repository or has uncommitted changes.
+func (t Target) cacheKey(ctx context.Context, dir string) (string, error) {
+	commit, err := git(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	status, err := git(ctx, dir, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return "", err
+	}
+	if status != "" {
+		return "", fmt.Errorf("uncommitted changes in %s", dir)
+	}
+	prefix, err := git(ctx, dir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return "", err
+	}
+	version, err := t.output(ctx, dir, "version")
+	if err != nil {
+		return "", err
+	}
+	buildArgs, _ := splitArgs(t.GoArgs)
+	env := append([]string(nil), t.Env...)
+	sort.Strings(env)
+
+	h := sha256.New()
+	for _, part := range [][]string{
+		{commit, prefix, strings.TrimSpace(string(version)), os.Getenv("GOFLAGS")},
+		buildArgs,
+		env,
+		t.packages(),
+	} {
+		fmt.Fprintf(h, "%q\n", part)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cachedTestBinaries returns the test binaries of the cache entry with the given key, building
+// them if the entry does not exist yet. As the repository may be checked out elsewhere (e.g. in
+// a worktree), package directories are stored relative to dir.
+func (t Target) cachedTestBinaries(ctx context.Context, dir, key string) ([]testBinary, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	entry := filepath.Join(t.CacheDir, key)
+	if content, err := ioutil.ReadFile(filepath.Join(entry, manifestFile)); err == nil {
+		var bins []testBinary
+		if err := json.Unmarshal(content, &bins); err == nil {
+			for i := range bins {
+				bins[i].Dir = filepath.Join(absDir, bins[i].Dir)
+				bins[i].Path = filepath.Join(entry, bins[i].Path)
+				bins[i].Cached = true
+			}
+			log.Printf("Using cached test binaries %s", entry)
+			return bins, nil
+		}
+		log.Printf("Ignoring invalid cache entry %s: %v", entry, err)
+	}
+
+	if err := os.MkdirAll(t.CacheDir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempDir(t.CacheDir, key+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	bins, err := t.buildTestBinaries(ctx, absDir, tmp)
+	if err != nil {
+		return nil, err
+	}
+	manifest := make([]testBinary, len(bins))
+	for i, b := range bins {
+		rel, err := filepath.Rel(absDir, b.Dir)
+		if err != nil {
+			return nil, err
+		}
+		manifest[i] = testBinary{Pkg: b.Pkg, Dir: rel, Path: filepath.Base(b.Path), Gocheck: b.Gocheck}
+	}
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmp, manifestFile), content, 0644); err != nil {
+		return nil, err
+	}
+	os.RemoveAll(entry) // invalid entry, if any
+	if err := os.Rename(tmp, entry); err != nil {
+		// Another run may have populated the entry concurrently.
+		if _, serr := os.Stat(filepath.Join(entry, manifestFile)); serr != nil {
+			return nil, err
+		}
+	}
+	for i := range bins {
+		bins[i].Path = filepath.Join(entry, manifest[i].Path)
+		bins[i].Cached = true
+	}
+	return bins, nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CompilerDiagnostics builds the test binary of the package pkg of the target's repository
+// checked out in dir with -gcflags=-m=2 and returns the escape analysis and inlining decisions
+// printed by the compiler, with file names relative to the returned directory of the package.
+// The -gcflags=-m=2 flag replaces any -gcflags of the target.
+func CompilerDiagnostics(ctx context.Context, t Target, dir, pkg string) ([]byte, string, error) {
+	buildArgs, _ := splitArgs(t.GoArgs)
+	args := append([]string{"list"}, buildArgs...)
+	args = append(args, "-f", "{{.Dir}}", pkg)
+	out, err := t.output(ctx, dir, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find package %s: %v", pkg, err)
+	}
+	pkgDir := strings.TrimSpace(string(out))
+
+	tmp, err := ioutil.TempDir("", "gobench-diag-")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(tmp)
+	args = append([]string{"test", "-c", "-o", filepath.Join(tmp, "pkg.test")}, buildArgs...)
+	args = append(args, "-gcflags=-m=2", pkg)
+	cmd := t.command(ctx, pkgDir, args...)
+	log.Printf("Building test binary %v", cmd)
+	// The compiler prints its decisions to stderr, also when replaying cached builds.
+	out, err = cmd.CombinedOutput()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to build test binary of %s: %v: %s", pkg, err, strings.TrimSpace(string(out)))
+	}
+	return out, pkgDir, nil
+}
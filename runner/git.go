@@ -0,0 +1,87 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// git runs a git command in dir and returns its trimmed output.
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+			return "", fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(ee.Stderr)))
+		}
+		return "", fmt.Errorf("git %s: %v", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Commit returns the commit checked out in the git repository containing dir.
+func Commit(ctx context.Context, dir string) (string, error) {
+	return git(ctx, dir, "rev-parse", "HEAD")
+}
+
+// ResolveCommit returns the SHA of the commit ref refers to in the git repository containing dir.
+// Refs starting with "-" are rejected so that they are not taken as options.
+func ResolveCommit(ctx context.Context, dir, ref string) (string, error) {
+	if ref == "" || strings.HasPrefix(ref, "-") {
+		return "", fmt.Errorf("invalid git ref %q", ref)
+	}
+	return git(ctx, dir, "rev-parse", "--verify", "--end-of-options", ref+"^{commit}")
+}
+
+// Worktree checks out ref of the git repository containing dir into a temporary worktree. The ref
+// is resolved with ResolveCommit first. It returns the directory corresponding to dir within the worktree and a function removing the
+// worktree again.
+func Worktree(ctx context.Context, dir, ref string) (string, func(), error) {
+	top, err := git(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", nil, err
+	}
+	prefix, err := git(ctx, dir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return "", nil, err
+	}
+	commit, err := ResolveCommit(ctx, dir, ref)
+	if err != nil {
+		return "", nil, err
+	}
+	tmp, err := ioutil.TempDir("", "gobench-worktree-")
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := git(ctx, top, "worktree", "add", "--detach", tmp, commit); err != nil {
+		os.RemoveAll(tmp)
+		return "", nil, err
+	}
+	cleanup := func() {
+		if _, err := git(context.Background(), top, "worktree", "remove", "--force", tmp); err != nil {
+			log.Printf("Failed to remove worktree %s: %v", tmp, err)
+		}
+		os.RemoveAll(tmp)
+	}
+	return filepath.Join(tmp, prefix), cleanup, nil
+}
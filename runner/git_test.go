@@ -0,0 +1,60 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestResolveCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir, err := ioutil.TempDir("", "gobench-git-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "initial"},
+	} {
+		if _, err := git(ctx, dir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	head, err := git(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := ResolveCommit(ctx, dir, "HEAD"); err != nil || got != head {
+		t.Errorf("ResolveCommit(HEAD) = %q, %v, want %q", got, err, head)
+	}
+	for _, ref := range []string{"", "--lock", "-b", "nonexistent"} {
+		if got, err := ResolveCommit(ctx, dir, ref); err == nil {
+			t.Errorf("ResolveCommit(%q) = %q, want error", ref, got)
+		}
+		if _, cleanup, err := Worktree(ctx, dir, ref); err == nil {
+			cleanup()
+			t.Errorf("Worktree(%q) succeeded, want error", ref)
+		}
+	}
+}
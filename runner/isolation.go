@@ -0,0 +1,90 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Isolation controls the environment test binaries run in to reduce interference from the rest
+// of the machine.
+type Isolation struct {
+	// CPUs is the list of CPUs to pin the test binaries to, e.g. "2-3" (using taskset -c).
+	CPUs string `yaml:"cpus,omitempty"`
+	// Nice is the niceness of the test binaries (using nice -n), e.g. -10 to prefer them.
+	Nice int `yaml:"nice,omitempty"`
+	// IONiceClass is the I/O scheduling class of the test binaries (using ionice -c): 1 for
+	// realtime, 2 for best-effort and 3 for idle. 0 keeps the default.
+	IONiceClass int `yaml:"ionice_class,omitempty"`
+	// IONiceLevel is the priority within the realtime and best-effort classes, 0 (highest) to 7.
+	IONiceLevel int `yaml:"ionice_level,omitempty"`
+	// GOMAXPROCS fixes the GOMAXPROCS of the test binaries if positive.
+	GOMAXPROCS int `yaml:"gomaxprocs,omitempty"`
+}
+
+// wrap returns the command line running the test binary at path with args under i.
+func (i *Isolation) wrap(path string, args []string) (string, []string) {
+	if i == nil {
+		return path, args
+	}
+	var prefix []string
+	if i.CPUs != "" {
+		prefix = append(prefix, "taskset", "-c", i.CPUs)
+	}
+	if i.Nice != 0 {
+		prefix = append(prefix, "nice", "-n", strconv.Itoa(i.Nice))
+	}
+	if i.IONiceClass != 0 {
+		prefix = append(prefix, "ionice", "-c", strconv.Itoa(i.IONiceClass))
+		if i.IONiceClass != 3 {
+			prefix = append(prefix, "-n", strconv.Itoa(i.IONiceLevel))
+		}
+	}
+	if len(prefix) == 0 {
+		return path, args
+	}
+	return prefix[0], append(append(prefix[1:], path), args...)
+}
+
+// numCPUs returns the number of CPUs in the list of CPUs to pin the test binaries to, or 0 if
+// there is none or it cannot be parsed.
+func (i *Isolation) numCPUs() int {
+	if i == nil || i.CPUs == "" {
+		return 0
+	}
+	n := 0
+	for _, r := range strings.Split(i.CPUs, ",") {
+		lo, hi := r, r
+		if j := strings.IndexByte(r, '-'); j >= 0 {
+			lo, hi = r[:j], r[j+1:]
+		}
+		first, err1 := strconv.Atoi(strings.TrimSpace(lo))
+		last, err2 := strconv.Atoi(strings.TrimSpace(hi))
+		if err1 != nil || err2 != nil || last < first {
+			return 0
+		}
+		n += last - first + 1
+	}
+	return n
+}
+
+// env returns the environment variables set by i.
+func (i *Isolation) env() []string {
+	if i == nil || i.GOMAXPROCS <= 0 {
+		return nil
+	}
+	return []string{"GOMAXPROCS=" + strconv.Itoa(i.GOMAXPROCS)}
+}
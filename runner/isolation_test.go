@@ -0,0 +1,49 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestIsolationWrap(t *testing.T) {
+	for _, tt := range []struct {
+		i    *Isolation
+		want []string
+	}{
+		{
+			want: []string{"/tmp/a.test", "-test.bench=."},
+		},
+		{
+			i:    &Isolation{GOMAXPROCS: 2},
+			want: []string{"/tmp/a.test", "-test.bench=."},
+		},
+		{
+			i:    &Isolation{CPUs: "2-3", Nice: -5, IONiceClass: 2},
+			want: []string{"taskset", "-c", "2-3", "nice", "-n", "-5", "ionice", "-c", "2", "-n", "0", "/tmp/a.test", "-test.bench=."},
+		},
+		{
+			i:    &Isolation{IONiceClass: 3},
+			want: []string{"ionice", "-c", "3", "/tmp/a.test", "-test.bench=."},
+		},
+	} {
+		name, args := tt.i.wrap("/tmp/a.test", []string{"-test.bench=."})
+		if diff := cmp.Diff(tt.want, append([]string{name}, args...)); diff != "" {
+			t.Errorf("%+v: wrap [-want +got]:\n%s", tt.i, diff)
+		}
+	}
+}
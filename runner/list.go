@@ -0,0 +1,246 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tklauser/gobench_exporter/bench"
+)
+
+// Available is a benchmark found in the test binary of a package without running it.
+type Available struct {
+	Pkg string `json:"package"`
+	// Name is the name of the benchmark, e.g. BenchmarkFoo or Suite.BenchmarkFoo for gocheck
+	// benchmarks. Sub-benchmarks are only known when running the benchmark and not listed.
+	Name    string `json:"benchmark"`
+	Gocheck bool   `json:"gocheck,omitempty"`
+	// Results reports whether the run listing the benchmark produced results of it. It is
+	// always false for benchmarks returned by List.
+	Results bool `json:"results"`
+}
+
+// gocheckBenchmarkRegexp matches the gocheck benchmarks listed by -check.list.
+var gocheckBenchmarkRegexp = regexp.MustCompile(`^\w+\.Benchmark\w*$`)
+
+// List returns the testing.B and gocheck benchmarks of target t's packages without running them,
+// sorted by package and name.
+func List(ctx context.Context, t Target) ([]Available, error) {
+	bins, cleanup, err := t.testBinaries(ctx, t.RepoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	return t.list(ctx, bins)
+}
+
+// list lists the benchmarks of the test binaries bins, see listBinary.
+func (t Target) list(ctx context.Context, bins []testBinary) ([]Available, error) {
+	var res []Available
+	for _, b := range bins {
+		av, err := t.listBinary(ctx, b)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, av...)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Pkg != res[j].Pkg {
+			return res[i].Pkg < res[j].Pkg
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res, nil
+}
+
+// listFileSuffix is appended to the path of a cached test binary to name the file caching the
+// list of its benchmarks.
+const listFileSuffix = ".benchmarks.json"
+
+// listBinary lists the benchmarks of the test binary b using -test.list and, for gocheck suites,
+// -check.list. The list of a cached binary is cached along with it.
+func (t Target) listBinary(ctx context.Context, b testBinary) ([]Available, error) {
+	listFile := b.Path + listFileSuffix
+	if b.Cached {
+		if content, err := ioutil.ReadFile(listFile); err == nil {
+			var av []Available
+			if err := json.Unmarshal(content, &av); err == nil {
+				return av, nil
+			}
+		}
+	}
+
+	var av []Available
+	out, err := t.binaryOutput(ctx, b, "-test.list=^Benchmark")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range out {
+		if strings.HasPrefix(name, "Benchmark") {
+			av = append(av, Available{Pkg: b.Pkg, Name: name})
+		}
+	}
+	if b.Gocheck {
+		// gocheck lists the suites' benchmarks (with -check.b) from within the tests running the
+		// suites, so only those are run.
+		entries, err := gocheckEntryPoints(b.Dir)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			log.Printf("Not listing gocheck benchmarks of %s: no test running the suites found", b.Pkg)
+		} else {
+			run := "-test.run=^(" + strings.Join(entries, "|") + ")$"
+			if out, err = t.binaryOutput(ctx, b, run, "-check.list", "-check.b"); err != nil {
+				return nil, err
+			}
+			for _, name := range out {
+				if gocheckBenchmarkRegexp.MatchString(name) {
+					av = append(av, Available{Pkg: b.Pkg, Name: name, Gocheck: true})
+				}
+			}
+		}
+	}
+
+	if b.Cached {
+		if err := writeListFile(listFile, av); err != nil {
+			log.Printf("Failed to cache benchmarks of %s: %v", b.Pkg, err)
+		}
+	}
+	return av, nil
+}
+
+// writeListFile atomically writes the list of benchmarks av to filename.
+func writeListFile(filename string, av []Available) error {
+	content, err := json.Marshal(av)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// gocheckEntryPoints returns the names of the test functions in the test files in dir which run
+// gocheck suites, i.e. call TestingT or RunAll of gocheck.
+func gocheckEntryPoints(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*_test.go"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil || fn.Body == nil || !strings.HasPrefix(fn.Name.Name, "Test") {
+				continue
+			}
+			found := false
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok {
+					return !found
+				}
+				var name string
+				switch fun := call.Fun.(type) {
+				case *ast.SelectorExpr:
+					name = fun.Sel.Name
+				case *ast.Ident: // dot import
+					name = fun.Name
+				}
+				if name == "TestingT" || name == "RunAll" {
+					found = true
+				}
+				return !found
+			})
+			if found {
+				names = append(names, regexp.QuoteMeta(fn.Name.Name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// MarkResults sets the Results field of the benchmarks in av with results in bs.
+func MarkResults(av []Available, bs bench.Set) {
+	type key struct{ pkg, name string }
+	found := make(map[key]bool)
+	for name, bb := range bs {
+		if len(bb) == 0 {
+			continue
+		}
+		base, _, _ := bench.ParseName(name)
+		if i := strings.IndexByte(base, '/'); i >= 0 {
+			base = base[:i]
+		}
+		found[key{bb[0].Pkg, base}] = true
+	}
+	for i := range av {
+		av[i].Results = found[key{av[i].Pkg, av[i].Name}]
+	}
+}
+
+// binaryOutput runs the test binary b with the given arguments in the target's environment and
+// returns the lines of its standard output.
+func (t Target) binaryOutput(ctx context.Context, b testBinary, args ...string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, b.Path, args...)
+	cmd.Dir = b.Dir
+	if len(t.Env) > 0 {
+		cmd.Env = append(os.Environ(), t.Env...)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list benchmarks of %s: %v: %s", b.Pkg, err, strings.TrimSpace(stderr.String()))
+	}
+	var lines []string
+	scan := bufio.NewScanner(bytes.NewReader(out))
+	for scan.Scan() {
+		lines = append(lines, strings.TrimSpace(scan.Text()))
+	}
+	return lines, nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/tklauser/gobench_exporter/bench"
+)
+
+func TestMarkResults(t *testing.T) {
+	av := []Available{
+		{Pkg: "a", Name: "BenchmarkFoo"},
+		{Pkg: "a", Name: "BenchmarkBar"},
+		{Pkg: "b", Name: "BenchmarkFoo"},
+		{Pkg: "b", Name: "Suite.BenchmarkBaz", Gocheck: true},
+	}
+	bs := bench.Set{
+		"BenchmarkFoo/n=10-8":  {{Name: "BenchmarkFoo/n=10-8", Pkg: "a"}},
+		"Suite.BenchmarkBaz":   {{Name: "Suite.BenchmarkBaz", Pkg: "b"}},
+		"BenchmarkUnlisted-8":  {{Name: "BenchmarkUnlisted-8", Pkg: "a"}},
+		"BenchmarkNoResults-8": nil,
+	}
+	MarkResults(av, bs)
+	want := []Available{
+		{Pkg: "a", Name: "BenchmarkFoo", Results: true},
+		{Pkg: "a", Name: "BenchmarkBar"},
+		{Pkg: "b", Name: "BenchmarkFoo"},
+		{Pkg: "b", Name: "Suite.BenchmarkBaz", Gocheck: true, Results: true},
+	}
+	if diff := cmp.Diff(want, av); diff != "" {
+		t.Errorf("MarkResults [-want +got]:\n%s", diff)
+	}
+}
+
+func TestGocheckEntryPoints(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gobench-list-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, src := range map[string]string{
+		"suite_test.go": `package foo
+
+import (
+	"testing"
+
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+func TestOther(t *testing.T) {}
+`,
+		"dot_test.go": `package foo
+
+import (
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+func TestDot(t *testing.T) { TestingT(t) }
+`,
+		"foo.go": `package foo
+
+func TestingT() {}
+
+func TestNotATest() { TestingT() }
+`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := gocheckEntryPoints(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"Test", "TestDot"}, got); diff != "" {
+		t.Errorf("gocheckEntryPoints [-want +got]:\n%s", diff)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// MainPackage is a main package of a target.
+type MainPackage struct {
+	ImportPath string
+	Deps       []string // import paths of the packages it depends on
+}
+
+// MainPackages returns the main packages among the target's packages.
+func MainPackages(ctx context.Context, t Target) ([]MainPackage, error) {
+	buildArgs, _ := splitArgs(t.GoArgs)
+	args := append([]string{"list"}, buildArgs...)
+	args = append(args, "-f", `{{if eq .Name "main"}}{{.ImportPath}}	{{join .Deps ","}}{{end}}`)
+	args = append(args, t.packages()...)
+	out, err := t.output(ctx, t.RepoPath, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list packages: %v", err)
+	}
+	var pkgs []MainPackage
+	scan := bufio.NewScanner(bytes.NewReader(out))
+	for scan.Scan() {
+		fields := strings.Split(scan.Text(), "\t")
+		if len(fields) != 2 {
+			continue
+		}
+		p := MainPackage{ImportPath: fields[0]}
+		if fields[1] != "" {
+			p.Deps = strings.Split(fields[1], ",")
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs, nil
+}
+
+// Uses reports whether the main package p is or depends on the package pkg.
+func (p MainPackage) Uses(pkg string) bool {
+	if p.ImportPath == pkg {
+		return true
+	}
+	for _, d := range p.Deps {
+		if d == pkg {
+			return true
+		}
+	}
+	return false
+}
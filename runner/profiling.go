@@ -0,0 +1,155 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/tklauser/gobench_exporter/bench"
+)
+
+// ProfilingOptions configures the recording of pprof profiles and execution traces while running
+// the testing.B benchmarks.
+type ProfilingOptions struct {
+	// CPU and Mem enable CPU and memory profiles, Trace execution traces.
+	CPU   bool `yaml:"cpu,omitempty"`
+	Mem   bool `yaml:"mem,omitempty"`
+	Trace bool `yaml:"trace,omitempty"`
+	// PerBenchmark records the profiles of each benchmark in a separate run of the benchmark
+	// instead of profiling the run of all benchmarks of a package.
+	PerBenchmark bool `yaml:"per_benchmark,omitempty"`
+	// Dir is the directory the profiles are written to.
+	Dir string `yaml:"-"`
+}
+
+// Profile kinds.
+const (
+	CPUProfile = "cpu"
+	MemProfile = "mem"
+	Trace      = "trace"
+)
+
+// profileKinds lists the profile kinds with the test flags recording them and the extensions of
+// their files.
+var profileKinds = []struct {
+	kind, flag, ext string
+}{
+	{CPUProfile, "cpuprofile", ".cpu.pprof"},
+	{MemProfile, "memprofile", ".mem.pprof"},
+	{Trace, "trace", ".trace"},
+}
+
+// Profile is a pprof profile or execution trace recorded while running benchmarks.
+type Profile struct {
+	Pkg string
+	// Benchmark is the profiled benchmark, or empty if the profile covers all benchmarks of
+	// the package.
+	Benchmark string
+	Kind      string // CPUProfile, MemProfile or Trace
+	Path      string
+}
+
+// unsafeFileChars matches characters replaced in profile file names.
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._=-]`)
+
+// profileArgs returns the test binary arguments recording the enabled profiles of the package
+// pkg (and benchmark, unless empty) and the profiles they record.
+func (o *ProfilingOptions) profileArgs(pkg, benchmark string) ([]string, []Profile) {
+	var (
+		args     []string
+		profiles []Profile
+	)
+	enabled := map[string]bool{CPUProfile: o.CPU, MemProfile: o.Mem, Trace: o.Trace}
+	for _, k := range profileKinds {
+		if !enabled[k.kind] {
+			continue
+		}
+		name := strings.Replace(pkg, "/", "_", -1)
+		if benchmark != "" {
+			name += "." + benchmark
+		}
+		p := Profile{
+			Pkg:       pkg,
+			Benchmark: benchmark,
+			Kind:      k.kind,
+			Path:      filepath.Join(o.Dir, unsafeFileChars.ReplaceAllString(name, "_")+k.ext),
+		}
+		args = append(args, fmt.Sprintf("-test.%s=%s", k.flag, p.Path))
+		profiles = append(profiles, p)
+	}
+	return args, profiles
+}
+
+// profileBenchmarks runs each testing.B benchmark in res once more using the test binaries bins
+// to record its profiles. The results of the profiling runs are discarded.
+func (t Target) profileBenchmarks(ctx context.Context, res bench.Set, bins []testBinary, testArgs []string) []Profile {
+	var profiles []Profile
+	seen := make(map[string]bool)
+	procs := t.benchProcs(testArgs)
+	for _, first := range res.Benchmarks() {
+		name := first.Name
+		base := trimProcs(name, procs)
+		if !strings.HasPrefix(name, "Benchmark") || seen[first.Pkg+"."+base] {
+			// gocheck benchmark, or a benchmark already profiled (e.g. with another -cpu)
+			continue
+		}
+		seen[first.Pkg+"."+base] = true
+		for _, b := range bins {
+			if b.Pkg != first.Pkg {
+				continue
+			}
+			pargs, ps := t.Profiling.profileArgs(b.Pkg, base)
+			args := append(benchArgs(exactBenchRegex(name, procs), testArgs), "-test.count=1")
+			var ord int
+			if err := t.runBinary(ctx, b, append(args, pargs...), make(bench.Set), &ord, nil); err != nil {
+				log.Printf("Failed to profile benchmark %s: %v", name, err)
+				continue
+			}
+			profiles = append(profiles, ps...)
+		}
+	}
+	return profiles
+}
+
+// DumpTrace prints the events of the execution trace at path using go tool trace -d=parsed of the
+// target's Go toolchain, i.e. the trace parser matching the runtime that recorded the trace, and
+// passes the output to parse.
+func DumpTrace(ctx context.Context, t Target, path string, parse func(io.Reader) error) error {
+	cmd := t.command(ctx, t.RepoPath, "tool", "trace", "-d=parsed", path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	perr := parse(stdout)
+	// Let go tool trace finish if parse stopped early.
+	io.Copy(ioutil.Discard, stdout)
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("go tool trace %s: %v: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	return perr
+}
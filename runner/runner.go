@@ -0,0 +1,148 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package runner runs Go benchmarks using the go command.
+package runner
+
+import (
+	"context"
+	"log"
+
+	"github.com/tklauser/gobench_exporter/bench"
+)
+
+// Target describes a set of Go packages to benchmark.
+type Target struct {
+	Name     string   // name of the target
+	RepoPath string   // directory in which go test is invoked
+	Packages []string // package patterns passed to go test, defaults to "."
+	GoArgs   []string // additional arguments passed to go test
+	Env      []string // additional environment variables in the form "key=value"
+	// Adaptive enables adaptive repetition of the testing.B benchmarks if non-nil.
+	Adaptive *AdaptiveOptions
+	// GoBinary is the go command used to build the test binaries, defaults to "go" in $PATH.
+	GoBinary string
+	// Isolation controls the environment the test binaries run in if non-nil.
+	Isolation *Isolation
+	// Profiling enables recording pprof profiles of the testing.B benchmarks if non-nil.
+	Profiling *ProfilingOptions
+	// GCTrace runs the test binaries with GODEBUG=gctrace=1 and summarizes the garbage
+	// collections in the resource usage of each package.
+	GCTrace bool
+	// CacheDir is the directory in which compiled test binaries are cached. Binaries are not
+	// cached if empty.
+	CacheDir string
+	// ListBenchmarks makes RunDetailed list the available benchmarks, see List. The list of
+	// cached test binaries is cached along with them.
+	ListBenchmarks bool
+}
+
+// packages returns the package patterns of the target.
+func (t Target) packages() []string {
+	if len(t.Packages) == 0 {
+		return []string{"."}
+	}
+	return t.Packages
+}
+
+// Run runs the testing.B and gocheck benchmarks of target t matching benchRegex (all benchmarks
+// if empty) and returns the results. The test binaries of the target's packages are compiled
+// (or taken from the cache) first and run directly. If a test binary fails, the results parsed
+// so far are returned along with the error. If adaptive repetition is enabled for the target,
+// the testing.B benchmarks are repeated until their results are stable.
+func Run(ctx context.Context, t Target, benchRegex string) (bench.Set, error) {
+	res, err := RunDetailed(ctx, t, benchRegex)
+	return res.Benchmarks, err
+}
+
+// Result is the outcome of running the benchmarks of a target.
+type Result struct {
+	Benchmarks bench.Set
+	// Usage is the resource usage of the test binary runs of each package, sorted by package.
+	Usage []Usage
+	// Profiles are the profiles recorded if profiling is enabled.
+	Profiles []Profile
+	// Available are the benchmarks of the target's packages, including those not selected by
+	// the benchmark regular expression, if the target lists them.
+	Available []Available
+}
+
+// RunDetailed is like Run, but also returns the resource usage of the test binary runs, the
+// recorded profiles and, if ListBenchmarks is set, the available benchmarks. The result is non-nil even if an error is returned.
+func RunDetailed(ctx context.Context, t Target, benchRegex string) (*Result, error) {
+	res := &Result{Benchmarks: make(bench.Set)}
+	us := make(usages)
+	defer func() { res.Usage = us.list() }()
+	bins, cleanup, err := t.testBinaries(ctx, t.RepoPath)
+	if err != nil {
+		return res, err
+	}
+	defer cleanup()
+
+	if t.ListBenchmarks {
+		if res.Available, err = t.list(ctx, bins); err != nil {
+			log.Printf("Failed to list benchmarks of target %q: %v", t.Name, err)
+		}
+		defer func() { MarkResults(res.Available, res.Benchmarks) }()
+	}
+	_, testArgs := splitArgs(t.GoArgs)
+	ord := 0
+	for _, b := range bins {
+		args := benchArgs(benchRegex, testArgs)
+		var profiles []Profile
+		if t.Profiling != nil && !t.Profiling.PerBenchmark {
+			var pargs []string
+			pargs, profiles = t.Profiling.profileArgs(b.Pkg, "")
+			args = append(args, pargs...)
+		}
+		if err := t.runBinary(ctx, b, args, res.Benchmarks, &ord, us); err != nil {
+			return res, err
+		}
+		res.Profiles = append(res.Profiles, profiles...)
+	}
+	if t.Profiling != nil && t.Profiling.PerBenchmark {
+		res.Profiles = t.profileBenchmarks(ctx, res.Benchmarks, bins, testArgs)
+	}
+	if t.Adaptive != nil {
+		t.repeat(ctx, res.Benchmarks, bins, testArgs, &ord, us)
+	}
+	for _, b := range bins {
+		if !b.Gocheck {
+			continue
+		}
+		if err := t.runBinary(ctx, b, gocheckArgs(benchRegex, testArgs), res.Benchmarks, &ord, us); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// benchArgs returns the test binary arguments to run the testing.B benchmarks matching
+// benchRegex.
+func benchArgs(benchRegex string, testArgs []string) []string {
+	if benchRegex == "" {
+		benchRegex = "."
+	}
+	return append([]string{"-test.run=_NONE_", "-test.bench=" + benchRegex}, testArgs...)
+}
+
+// gocheckArgs returns the test binary arguments to run the gocheck benchmarks matching
+// benchRegex.
+func gocheckArgs(benchRegex string, testArgs []string) []string {
+	args := append([]string{"-check.b", "-check.bmem"}, testArgs...)
+	if benchRegex != "" && benchRegex != "." {
+		args = append(args, "-check.f="+benchRegex)
+	}
+	return args
+}
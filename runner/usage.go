@@ -0,0 +1,117 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"github.com/tklauser/gobench_exporter/bench"
+)
+
+// Usage is the resource usage of the test binary runs of a package.
+type Usage struct {
+	Pkg  string `json:"pkg"`
+	Runs int    `json:"runs"` // number of test binary runs
+	// Wall, User and System are the elapsed real time and the user and system CPU time of all
+	// runs.
+	Wall   time.Duration `json:"wall"`
+	User   time.Duration `json:"user"`
+	System time.Duration `json:"system"`
+	// MaxRSS is the maximum resident set size of any run in bytes.
+	MaxRSS uint64 `json:"max_rss"`
+	// AvgRSS is the average resident set size in bytes, sampled from /proc while running.
+	AvgRSS uint64 `json:"avg_rss,omitempty"`
+	// MaxThreads is the maximum number of threads, sampled from /proc while running.
+	MaxThreads int `json:"max_threads,omitempty"`
+	// VoluntaryCtxSwitches and InvoluntaryCtxSwitches are the context switches of all runs.
+	VoluntaryCtxSwitches   uint64 `json:"voluntary_ctx_switches"`
+	InvoluntaryCtxSwitches uint64 `json:"involuntary_ctx_switches"`
+	// GC summarizes the garbage collections of the runs if the target is run with gctrace.
+	GC *bench.GCSummary `json:"gc,omitempty"`
+
+	rssSamples uint64 // number of samples averaged in AvgRSS
+}
+
+// add adds the resource usage of another run of the package to u.
+func (u *Usage) add(o Usage) {
+	if n := u.rssSamples + o.rssSamples; n > 0 {
+		u.AvgRSS = (u.AvgRSS*u.rssSamples + o.AvgRSS*o.rssSamples) / n
+		u.rssSamples = n
+	}
+	u.Runs += o.Runs
+	u.Wall += o.Wall
+	u.User += o.User
+	u.System += o.System
+	if o.MaxRSS > u.MaxRSS {
+		u.MaxRSS = o.MaxRSS
+	}
+	if o.MaxThreads > u.MaxThreads {
+		u.MaxThreads = o.MaxThreads
+	}
+	u.VoluntaryCtxSwitches += o.VoluntaryCtxSwitches
+	u.InvoluntaryCtxSwitches += o.InvoluntaryCtxSwitches
+	if o.GC != nil {
+		if u.GC == nil {
+			u.GC = &bench.GCSummary{}
+		}
+		u.GC.Add(*o.GC)
+	}
+}
+
+// usages accumulates the resource usage of test binary runs per package. A nil usages discards
+// the resource usage.
+type usages map[string]*Usage
+
+func (us usages) add(u Usage) {
+	if us == nil {
+		return
+	}
+	if acc, ok := us[u.Pkg]; ok {
+		acc.add(u)
+	} else {
+		us[u.Pkg] = &u
+	}
+}
+
+// list returns the resource usage of all packages, sorted by package.
+func (us usages) list() []Usage {
+	res := make([]Usage, 0, len(us))
+	for _, u := range us {
+		res = append(res, *u)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Pkg < res[j].Pkg
+	})
+	return res
+}
+
+// processUsage returns the resource usage of the exited process ps, which ran for wall.
+func processUsage(pkg string, ps *os.ProcessState, wall time.Duration, s *procSampler) Usage {
+	u := Usage{Pkg: pkg, Runs: 1, Wall: wall}
+	if ps != nil {
+		u.User = ps.UserTime()
+		u.System = ps.SystemTime()
+		addRusage(&u, ps)
+	}
+	if s != nil {
+		u.AvgRSS, u.rssSamples, u.MaxThreads = s.stop()
+		if u.AvgRSS > u.MaxRSS {
+			u.MaxRSS = u.AvgRSS
+		}
+	}
+	return u
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// sampleInterval is the interval at which /proc/<pid>/status of running test binaries is
+// sampled.
+const sampleInterval = 100 * time.Millisecond
+
+// addRusage adds the maximum resident set size and context switches reported by the kernel for
+// the exited process ps to u.
+func addRusage(u *Usage, ps *os.ProcessState) {
+	ru, ok := ps.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return
+	}
+	u.MaxRSS = uint64(ru.Maxrss) * 1024 // in KiB
+	u.VoluntaryCtxSwitches = uint64(ru.Nvcsw)
+	u.InvoluntaryCtxSwitches = uint64(ru.Nivcsw)
+}
+
+// procSampler periodically samples the resident set size and number of threads of a running
+// process from /proc/<pid>/status.
+type procSampler struct {
+	done chan struct{}
+	res  chan [3]uint64 // total RSS, number of samples and maximum number of threads
+}
+
+// startSampler starts sampling the process with the given PID until stop is called.
+func startSampler(pid int) *procSampler {
+	s := &procSampler{done: make(chan struct{}), res: make(chan [3]uint64, 1)}
+	status := "/proc/" + strconv.Itoa(pid) + "/status"
+	go func() {
+		var total, n, maxThreads uint64
+		ticker := time.NewTicker(sampleInterval)
+		defer ticker.Stop()
+		for {
+			if rss, threads, ok := readStatus(status); ok {
+				total += rss
+				n++
+				if threads > maxThreads {
+					maxThreads = threads
+				}
+			}
+			select {
+			case <-s.done:
+				s.res <- [3]uint64{total, n, maxThreads}
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return s
+}
+
+// stop stops sampling and returns the average resident set size in bytes, the number of samples
+// and the maximum number of threads.
+func (s *procSampler) stop() (avgRSS, samples uint64, maxThreads int) {
+	close(s.done)
+	res := <-s.res
+	if res[1] == 0 {
+		return 0, 0, int(res[2])
+	}
+	return res[0] / res[1], res[1], int(res[2])
+}
+
+// readStatus returns the resident set size in bytes and number of threads from a
+// /proc/<pid>/status file.
+func readStatus(path string) (rss, threads uint64, ok bool) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, 0, false
+	}
+	s := bufio.NewScanner(bytes.NewReader(content))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "VmRSS:":
+			kb, _ := strconv.ParseUint(fields[1], 10, 64)
+			rss = kb * 1024
+			ok = true
+		case "Threads:":
+			threads, _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	return rss, threads, ok
+}
@@ -0,0 +1,31 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package runner
+
+import "os"
+
+// addRusage is a no-op on platforms other than Linux.
+func addRusage(u *Usage, ps *os.ProcessState) {}
+
+// procSampler is not supported on platforms other than Linux.
+type procSampler struct{}
+
+// startSampler returns nil on platforms other than Linux.
+func startSampler(pid int) *procSampler { return nil }
+
+func (s *procSampler) stop() (avgRSS, samples uint64, maxThreads int) { return 0, 0, 0 }
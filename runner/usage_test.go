@@ -0,0 +1,79 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runner
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/tklauser/gobench_exporter/bench"
+)
+
+func TestUsages(t *testing.T) {
+	us := make(usages)
+	us.add(Usage{Pkg: "b", Runs: 1, Wall: time.Second, User: 800 * time.Millisecond, MaxRSS: 100, AvgRSS: 60, rssSamples: 1, MaxThreads: 4, VoluntaryCtxSwitches: 10})
+	us.add(Usage{Pkg: "a", Runs: 1, Wall: time.Second})
+	us.add(Usage{Pkg: "b", Runs: 1, Wall: 2 * time.Second, User: 1200 * time.Millisecond, MaxRSS: 80, AvgRSS: 30, rssSamples: 2, MaxThreads: 6, InvoluntaryCtxSwitches: 5})
+	usages(nil).add(Usage{Pkg: "c"})
+
+	want := []Usage{
+		{Pkg: "a", Runs: 1, Wall: time.Second},
+		{Pkg: "b", Runs: 2, Wall: 3 * time.Second, User: 2 * time.Second, MaxRSS: 100, AvgRSS: 40, MaxThreads: 6, VoluntaryCtxSwitches: 10, InvoluntaryCtxSwitches: 5},
+	}
+	if diff := cmp.Diff(want, us.list(), cmpopts.IgnoreUnexported(Usage{})); diff != "" {
+		t.Errorf("usages [-want +got]:\n%s", diff)
+	}
+}
+
+func TestGCSummary(t *testing.T) {
+	stderr := bytes.NewBufferString(`gc 1 @0.004s 3%: 0.011+0.56+0.003 ms clock, 0.089+0.10/0.61/0.25+0.029 ms cpu, 3->4->1 MB, 4 MB goal, 0 MB stacks, 0 MB globals, 8 P
+--- FAIL: BenchmarkA
+gc 2 @0.010s 4%: 0.1+1+0.1 ms clock, 1+1/1/1+1 ms cpu, 6->8->2 MB, 8 MB goal, 0 MB stacks, 0 MB globals, 8 P (forced)
+`)
+	us := make(usages)
+	for i := 0; i < 2; i++ {
+		gc := gcSummary(stderr)
+		us.add(Usage{Pkg: "a", Runs: 1, GC: &gc})
+	}
+	want := bench.GCSummary{
+		Runs: 2, Cycles: 2, Forced: 1,
+		Pause: 214 * time.Microsecond, MaxPause: 200 * time.Microsecond, Mark: 1560 * time.Microsecond, CPU: 6078 * time.Microsecond,
+		CPUPercent:   4,
+		AvgHeapStart: 9 << 19, AvgHeapEnd: 6 << 20, AvgHeapLive: 3 << 19, MaxHeap: 8 << 20,
+	}
+	if diff := cmp.Diff(want, *us.list()[0].GC); diff != "" {
+		t.Errorf("GC summary [-want +got]:\n%s", diff)
+	}
+	if got, want := stderr.String(), "--- FAIL: BenchmarkA\n"; got != want {
+		t.Errorf("stderr = %q, want %q", got, want)
+	}
+
+	os.Setenv("GODEBUG", "")
+	for _, tt := range []struct {
+		env  []string
+		want string
+	}{
+		{nil, "GODEBUG=gctrace=1"},
+		{[]string{"GODEBUG=madvdontneed=1", "FOO=bar"}, "GODEBUG=madvdontneed=1,gctrace=1"},
+	} {
+		if got := gctraceEnv(tt.env); got != tt.want {
+			t.Errorf("gctraceEnv(%q) = %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/version"
+	"github.com/tklauser/gobench_exporter/bench"
+	"github.com/tklauser/gobench_exporter/collector"
+	"github.com/tklauser/gobench_exporter/config"
+	"github.com/tklauser/gobench_exporter/regression"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// serveCommand runs the exporter.
+type serveCommand struct {
+	global *globalFlags
+
+	listenAddress     string
+	metricsPath       string
+	triggerPath       string
+	probePath         string
+	timeoutOffset     time.Duration
+	configFile        string
+	repoPath          string
+	seriesLimit       int
+	relabelConfigFile string
+	historyPath       string
+	budgetFile        string
+	cachePath         string
+	listAvailable     bool
+	filter            *config.FilterConfig
+	stdinFilter       *config.FilterConfig
+	triggerFilter     *config.FilterConfig
+}
+
+func registerServeCommand(app *kingpin.Application, g *globalFlags) {
+	s := &serveCommand{global: g}
+	cmd := app.Command("serve", "Run the exporter (default). Benchmark output piped to stdin is exported as well.").Default()
+	cmd.Flag(
+		"web.listen-address",
+		"Address on which to expose metrics.",
+	).Default(":9777").StringVar(&s.listenAddress)
+	cmd.Flag(
+		"web.telemetry-path",
+		"Path under which to expose metrics.",
+	).Default("/metrics").StringVar(&s.metricsPath)
+	cmd.Flag(
+		"web.trigger-path",
+		"Path under which to trigger benchmarks.",
+	).Default("/trigger").StringVar(&s.triggerPath)
+	cmd.Flag(
+		"web.probe-path",
+		"Path under which to run benchmarks of a target and expose their results.",
+	).Default("/probe").StringVar(&s.probePath)
+	cmd.Flag(
+		"probe.timeout-offset",
+		"Offset to subtract from the scrape timeout when running benchmarks for a probe.",
+	).Default("0.5s").DurationVar(&s.timeoutOffset)
+	cmd.Flag(
+		"config.file",
+		"YAML configuration file declaring targets, schedules and run profiles. Overrides the target, filter, series limit and relabeling flags.",
+	).StringVar(&s.configFile)
+	cmd.Flag(
+		"fs.repo-path",
+		"Filesystem path of the Go package to benchmark.",
+	).Default(".").StringVar(&s.repoPath)
+	cmd.Flag(
+		"metrics.series-limit",
+		"Maximum number of exported benchmark series. Least-recently-updated benchmarks are dropped first. 0 means no limit.",
+	).Default("0").IntVar(&s.seriesLimit)
+	cmd.Flag(
+		"metrics.relabel-config-file",
+		"YAML file with a list of Prometheus-style relabeling rules applied to benchmarks before export.",
+	).StringVar(&s.relabelConfigFile)
+	cmd.Flag(
+		"history.path",
+		"Directory of the history store recording the results of all runs. Runs are not recorded if empty.",
+	).StringVar(&s.historyPath)
+	cmd.Flag(
+		"cache.path",
+		"Directory in which compiled test binaries are cached by commit, build flags and Go version.",
+	).StringVar(&s.cachePath)
+	cmd.Flag(
+		"benchmarks.list",
+		"List the benchmarks available in the packages of each target on every run, exporting them as gobench_benchmark_available. Otherwise, they are only listed on request at /api/benchmarks/available or /benchmarks.",
+	).BoolVar(&s.listAvailable)
+	cmd.Flag(
+		"budget.file",
+		"YAML file with absolute limits per benchmark glob pattern and unit to evaluate all results against.",
+	).StringVar(&s.budgetFile)
+	s.filter = filterFlags(cmd, "filter", "")
+	s.stdinFilter = filterFlags(cmd, "stdin.filter", " (benchmarks read from stdin only)")
+	s.triggerFilter = filterFlags(cmd, "trigger.filter", " (triggered benchmarks only)")
+	cmd.Action(s.run)
+}
+
+// loadConfig loads the configuration file or, if none is given, builds the configuration from
+// the flags.
+func (s *serveCommand) loadConfig() (*config.Config, error) {
+	if s.configFile != "" {
+		cfg, err := config.Load(s.configFile)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Loaded configuration file %s", s.configFile)
+		return cfg, nil
+	}
+
+	log.Printf("Benchmarking Go packages in directory %s", s.repoPath)
+	cfg := defaultConfig(s.repoPath)
+	cfg.Global.Filter = *s.filter
+	cfg.Global.SeriesLimit = s.seriesLimit
+	cfg.Global.BinaryCache = s.cachePath
+	cfg.Targets[0].Filter = *s.triggerFilter
+	if s.relabelConfigFile != "" {
+		var err error
+		cfg.Global.RelabelConfigs, err = collector.LoadRelabelConfigs(s.relabelConfigFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load relabel configs: %v", err)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid flags: %v", err)
+	}
+	return cfg, nil
+}
+
+func (s *serveCommand) run(*kingpin.ParseContext) error {
+	log.Printf("Starting gobench_exporter version %s", version.Info())
+
+	escaping, err := s.global.escaping()
+	if err != nil {
+		log.Fatalf("Invalid name escaping: %v", err)
+	}
+	cfg, err := s.loadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	stdinSource, err := s.stdinFilter.Filter()
+	if err != nil {
+		log.Fatalf("Invalid stdin filter: %v", err)
+	}
+
+	store, err := openHistory(s.historyPath)
+	if err != nil {
+		log.Fatalf("Failed to open history store: %v", err)
+	}
+
+	var budget *collector.BudgetCollector
+	if s.budgetFile != "" {
+		b, err := regression.LoadBudget(s.budgetFile)
+		if err != nil {
+			log.Fatalf("Failed to load budget: %v", err)
+		}
+		budget = collector.NewBudgetCollector(b)
+		if err := prometheus.Register(budget); err != nil {
+			log.Fatalf("Failed to register budget collector: %v", err)
+		}
+	}
+
+	e := newExporter(s.configFile, escaping, cfg, store, budget)
+	e.listAvailable = s.listAvailable
+	if err := prometheus.Register(e.noise); err != nil {
+		log.Fatalf("Failed to register noise collector: %v", err)
+	}
+	if err := prometheus.Register(e.ab); err != nil {
+		log.Fatalf("Failed to register A/B collector: %v", err)
+	}
+	if err := prometheus.Register(e.variants); err != nil {
+		log.Fatalf("Failed to register variant collector: %v", err)
+	}
+	if err := prometheus.Register(e.env); err != nil {
+		log.Fatalf("Failed to register environment collector: %v", err)
+	}
+	if err := prometheus.Register(e.usage); err != nil {
+		log.Fatalf("Failed to register resource usage collector: %v", err)
+	}
+	if err := prometheus.Register(e.profiles); err != nil {
+		log.Fatalf("Failed to register profile collector: %v", err)
+	}
+	if err := prometheus.Register(e.pgo); err != nil {
+		log.Fatalf("Failed to register PGO collector: %v", err)
+	}
+	if err := prometheus.Register(e.traces); err != nil {
+		log.Fatalf("Failed to register trace collector: %v", err)
+	}
+	if err := prometheus.Register(e.available); err != nil {
+		log.Fatalf("Failed to register available benchmarks collector: %v", err)
+	}
+	if e.changePoints != nil {
+		for _, t := range cfg.Targets {
+			e.detectChangePoints(t.Name, e.targetRuns(t.Name))
+		}
+		if err := prometheus.Register(e.changePoints); err != nil {
+			log.Fatalf("Failed to register change point collector: %v", err)
+		}
+	}
+	c := e.collector
+	bs, err := bench.ParseSet(os.Stdin)
+	if err != nil {
+		log.Fatalf("Failed to parse benchmarks from stdin: %v", err)
+	}
+	e.update("", "", bs, collector.Source{Filter: stdinSource}, nil)
+	for _, r := range c.Renames() {
+		if r.Unit != "" {
+			log.Printf("Unit %q of benchmark %q exported as %q to avoid a metric name collision", r.Unit, r.Benchmark, r.MetricName)
+		} else if r.Collision {
+			log.Printf("Benchmark %q exported as %q to avoid a metric name collision", r.Benchmark, r.MetricName)
+		} else {
+			log.Printf("Benchmark %q exported as %q", r.Benchmark, r.MetricName)
+		}
+	}
+	if err := prometheus.Register(c); err != nil {
+		log.Fatalf("Failed to register collector: %v", err)
+	}
+	p := newProber(e, s.repoPath, s.timeoutOffset)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := e.reload(); err != nil {
+				log.Printf("Failed to reload configuration: %v", err)
+			}
+		}
+	}()
+
+	http.Handle(s.metricsPath, promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer, collector.Handler(prometheus.DefaultGatherer, c.Unit),
+	))
+	http.Handle(s.triggerPath, e)
+	http.HandleFunc("/-/reload", e.reloadHandler)
+	http.HandleFunc("/api/changepoints", e.changePointsHandler)
+	http.HandleFunc("/runs/", e.profileHandler)
+	http.HandleFunc("/api/profiles/diff", e.profileDiffHandler)
+	http.HandleFunc("/api/benchmarks/available", e.availableHandler)
+	http.HandleFunc("/benchmarks", e.availablePageHandler(s.triggerPath))
+	http.Handle(s.probePath, p)
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html>
+			<head><title>Go Benchmark Exporter</title></head>
+			<body>
+			<h1>Go Benchmark Exporter</h1>
+			<p><a href="` + s.metricsPath + `">Metrics</a></p>
+			<p><a href="` + s.triggerPath + `">Trigger benchmarks</a></p>
+			<p><a href="/benchmarks">Available benchmarks</a></p>
+			<p><a href="` + s.probePath + `?target=default">Probe default target</a></p>
+			</body>
+			</html>`))
+	})
+
+	log.Printf("Listening on %s", s.listenAddress)
+	if err := http.ListenAndServe(s.listenAddress, nil); err != nil {
+		log.Fatalf("Error listening on %s: %s", s.listenAddress, err)
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sysenv
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Actions taken if the machine is too noisy to run benchmarks.
+const (
+	ActionDelay = "delay" // wait until the machine is quiet, up to the maximum delay
+	ActionAbort = "abort" // do not run the benchmarks
+	ActionWarn  = "warn"  // log the failed checks and run the benchmarks anyway
+)
+
+// Options configures the checks run before benchmarks. Checks of zero (or nil) limits are
+// skipped.
+type Options struct {
+	// MaxLoad is the maximum 1 minute load average.
+	MaxLoad float64 `yaml:"max_load,omitempty"`
+	// Governor is the required CPU frequency governor of all CPUs, e.g. "performance".
+	Governor string `yaml:"governor,omitempty"`
+	// MaxSwapRate is the maximum number of pages swapped in or out per second.
+	MaxSwapRate *float64 `yaml:"max_swap_rate,omitempty"`
+	// MaxBusyProcesses is the maximum number of other processes using more than BusyCPU.
+	MaxBusyProcesses *int `yaml:"max_busy_processes,omitempty"`
+	// BusyCPU is the CPU time per second of wall time above which a process is busy.
+	BusyCPU float64 `yaml:"busy_cpu,omitempty"`
+	// SampleInterval is the time over which swap activity and CPU usage are sampled.
+	SampleInterval time.Duration `yaml:"sample_interval,omitempty"`
+	// Action is the action taken if a check fails, one of delay, abort and warn.
+	Action string `yaml:"action,omitempty"`
+	// MaxDelay is the maximum time to wait for the machine to become quiet.
+	MaxDelay time.Duration `yaml:"max_delay,omitempty"`
+	// RetryInterval is the time between readings while waiting.
+	RetryInterval time.Duration `yaml:"retry_interval,omitempty"`
+}
+
+// DefaultOptions are the options used for unset fields. No checks are enabled by default.
+var DefaultOptions = Options{
+	BusyCPU:        0.5,
+	SampleInterval: time.Second,
+	Action:         ActionDelay,
+	MaxDelay:       10 * time.Minute,
+	RetryInterval:  30 * time.Second,
+}
+
+// Validate checks the options and sets unset fields to their defaults.
+func (o *Options) Validate() error {
+	if o.BusyCPU == 0 {
+		o.BusyCPU = DefaultOptions.BusyCPU
+	}
+	if o.SampleInterval == 0 {
+		o.SampleInterval = DefaultOptions.SampleInterval
+	}
+	if o.Action == "" {
+		o.Action = DefaultOptions.Action
+	}
+	if o.MaxDelay == 0 {
+		o.MaxDelay = DefaultOptions.MaxDelay
+	}
+	if o.RetryInterval == 0 {
+		o.RetryInterval = DefaultOptions.RetryInterval
+	}
+	switch o.Action {
+	case ActionDelay, ActionAbort, ActionWarn:
+	default:
+		return fmt.Errorf("invalid action %q, want delay, abort or warn", o.Action)
+	}
+	if o.MaxLoad < 0 || o.BusyCPU < 0 || o.SampleInterval < 0 || o.MaxDelay < 0 || o.RetryInterval < 0 ||
+		o.MaxSwapRate != nil && *o.MaxSwapRate < 0 || o.MaxBusyProcesses != nil && *o.MaxBusyProcesses < 0 {
+		return fmt.Errorf("limits and durations must not be negative")
+	}
+	return nil
+}
+
+// Check returns the checks of o failed by reading r.
+func (o *Options) Check(r *Reading) []string {
+	var violations []string
+	if o.MaxLoad > 0 && r.Load1 > o.MaxLoad {
+		violations = append(violations, fmt.Sprintf("load average %.2f > %.2f", r.Load1, o.MaxLoad))
+	}
+	if o.Governor != "" && r.Governor != o.Governor {
+		violations = append(violations, fmt.Sprintf("CPU frequency governor %q, want %q", r.Governor, o.Governor))
+	}
+	if o.MaxSwapRate != nil {
+		if rate := r.SwapIn + r.SwapOut; rate > *o.MaxSwapRate {
+			violations = append(violations, fmt.Sprintf("swapping %.0f pages/s > %.0f", rate, *o.MaxSwapRate))
+		}
+	}
+	if o.MaxBusyProcesses != nil && len(r.BusyProcesses) > *o.MaxBusyProcesses {
+		names := make([]string, len(r.BusyProcesses))
+		for i, p := range r.BusyProcesses {
+			names[i] = fmt.Sprintf("%s[%d]", p.Command, p.PID)
+		}
+		violations = append(violations, fmt.Sprintf("%d busy processes > %d (%s)",
+			len(r.BusyProcesses), *o.MaxBusyProcesses, strings.Join(names, ", ")))
+	}
+	return violations
+}
+
+// Wait takes a reading and checks it. If a check fails, it waits for the machine to become quiet,
+// aborts or only logs the failed checks, depending on the action. An error is returned along with
+// the last reading if the benchmarks should not be run.
+func (o *Options) Wait(ctx context.Context, fs FS) (*Reading, error) {
+	start := time.Now()
+	for {
+		r, err := fs.Read(o.SampleInterval, o.BusyCPU)
+		if err != nil {
+			return nil, err
+		}
+		r.Violations = o.Check(r)
+		r.Delay = r.Time.Sub(start)
+		if len(r.Violations) == 0 {
+			return r, nil
+		}
+		reason := strings.Join(r.Violations, "; ")
+		switch o.Action {
+		case ActionWarn:
+			log.Printf("Machine is noisy, running benchmarks anyway: %s", reason)
+			return r, nil
+		case ActionAbort:
+			return r, fmt.Errorf("machine too noisy: %s", reason)
+		}
+		if time.Since(start)+o.RetryInterval > o.MaxDelay {
+			return r, fmt.Errorf("machine still too noisy after %v: %s", time.Since(start).Round(time.Second), reason)
+		}
+		log.Printf("Machine is noisy, delaying benchmarks by %v: %s", o.RetryInterval, reason)
+		select {
+		case <-ctx.Done():
+			return r, ctx.Err()
+		case <-time.After(o.RetryInterval):
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sysenv reads the state of the machine benchmarks run on, e.g. its load and CPU
+// frequency governor, and checks whether it is quiet enough to run benchmarks.
+package sysenv
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is the number of clock ticks per second used for process CPU times in /proc
+// (USER_HZ), which is 100 on all common Linux platforms.
+const clockTicks = 100
+
+// Process is a process using CPU while a reading was taken.
+type Process struct {
+	PID     int     `json:"pid"`
+	Command string  `json:"command"`
+	CPU     float64 `json:"cpu"` // CPU time used per second of wall time
+}
+
+// Reading is the state of the machine at a point in time.
+type Reading struct {
+	Time   time.Time `json:"time"`
+	Load1  float64   `json:"load1"`
+	Load5  float64   `json:"load5"`
+	Load15 float64   `json:"load15"`
+	NumCPU int       `json:"num_cpu"`
+	// Governor is the CPU frequency governor of all CPUs, "mixed" if they differ, or empty if
+	// CPU frequency scaling is not available.
+	Governor string `json:"governor,omitempty"`
+	// SwapIn and SwapOut are the pages swapped in and out per second while sampling.
+	SwapIn  float64 `json:"swap_in"`
+	SwapOut float64 `json:"swap_out"`
+	// BusyProcesses are the processes using more CPU than the busy threshold while sampling,
+	// sorted by decreasing CPU usage.
+	BusyProcesses []Process `json:"busy_processes,omitempty"`
+	// Violations are the failed checks, if the reading was checked.
+	Violations []string `json:"violations,omitempty"`
+	// Delay is the time waited for the machine to become quiet before the reading was taken.
+	Delay time.Duration `json:"delay,omitempty"`
+}
+
+// FS is the location of the proc and sys filesystems.
+type FS struct {
+	Proc string
+	Sys  string
+}
+
+// DefaultFS are the proc and sys filesystems of the running system.
+var DefaultFS = FS{Proc: "/proc", Sys: "/sys"}
+
+// Read takes a reading, sampling swap activity and process CPU usage over interval. Processes
+// using more than busyCPU CPU time per second of wall time, except the current process, are
+// reported as busy.
+func (fs FS) Read(interval time.Duration, busyCPU float64) (*Reading, error) {
+	r := &Reading{Time: time.Now()}
+	var err error
+	if r.Load1, r.Load5, r.Load15, err = fs.loadAvg(); err != nil {
+		return nil, err
+	}
+	if r.NumCPU, r.Governor, err = fs.governor(); err != nil {
+		return nil, err
+	}
+	swapIn, swapOut, err := fs.swap()
+	if err != nil {
+		return nil, err
+	}
+	cpu := fs.processCPU()
+	start := time.Now()
+	time.Sleep(interval)
+	elapsed := time.Since(start).Seconds()
+
+	swapIn2, swapOut2, err := fs.swap()
+	if err != nil {
+		return nil, err
+	}
+	r.SwapIn = float64(swapIn2-swapIn) / elapsed
+	r.SwapOut = float64(swapOut2-swapOut) / elapsed
+	self := os.Getpid()
+	for pid, p := range fs.processCPU() {
+		before, ok := cpu[pid]
+		if !ok || pid == self {
+			continue
+		}
+		usage := float64(p.ticks-before.ticks) / clockTicks / elapsed
+		if usage > busyCPU {
+			r.BusyProcesses = append(r.BusyProcesses, Process{PID: pid, Command: p.comm, CPU: usage})
+		}
+	}
+	sort.Slice(r.BusyProcesses, func(i, j int) bool {
+		return r.BusyProcesses[i].CPU > r.BusyProcesses[j].CPU
+	})
+	return r, nil
+}
+
+// loadAvg returns the 1, 5 and 15 minute load averages.
+func (fs FS) loadAvg() (load1, load5, load15 float64, err error) {
+	content, err := ioutil.ReadFile(filepath.Join(fs.Proc, "loadavg"))
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) < 3 {
+		return 0, 0, 0, fmt.Errorf("invalid loadavg %q", content)
+	}
+	var loads [3]float64
+	for i := range loads {
+		if loads[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid loadavg %q: %v", content, err)
+		}
+	}
+	return loads[0], loads[1], loads[2], nil
+}
+
+// governor returns the number of CPUs and their CPU frequency governor.
+func (fs FS) governor() (int, string, error) {
+	cpus, err := filepath.Glob(filepath.Join(fs.Sys, "devices", "system", "cpu", "cpu[0-9]*"))
+	if err != nil {
+		return 0, "", err
+	}
+	governor := ""
+	for _, cpu := range cpus {
+		content, err := ioutil.ReadFile(filepath.Join(cpu, "cpufreq", "scaling_governor"))
+		if err != nil {
+			continue // no CPU frequency scaling
+		}
+		g := strings.TrimSpace(string(content))
+		switch governor {
+		case "":
+			governor = g
+		case g:
+		default:
+			governor = "mixed"
+		}
+	}
+	return len(cpus), governor, nil
+}
+
+// swap returns the total number of pages swapped in and out since boot.
+func (fs FS) swap() (in, out uint64, err error) {
+	content, err := ioutil.ReadFile(filepath.Join(fs.Proc, "vmstat"))
+	if err != nil {
+		return 0, 0, err
+	}
+	s := bufio.NewScanner(bytes.NewReader(content))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case "pswpin":
+			in, err = strconv.ParseUint(fields[1], 10, 64)
+		case "pswpout":
+			out, err = strconv.ParseUint(fields[1], 10, 64)
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid vmstat %s: %v", fields[0], err)
+		}
+	}
+	return in, out, s.Err()
+}
+
+// procStat is the CPU usage of a process.
+type procStat struct {
+	comm  string
+	ticks uint64 // user and system time in clock ticks
+}
+
+// processCPU returns the CPU usage of all processes, keyed by PID. Processes whose stat cannot be
+// read, e.g. because they exited, are skipped.
+func (fs FS) processCPU() map[int]procStat {
+	res := make(map[int]procStat)
+	dirs, err := ioutil.ReadDir(fs.Proc)
+	if err != nil {
+		return res
+	}
+	for _, fi := range dirs {
+		pid, err := strconv.Atoi(fi.Name())
+		if err != nil || !fi.IsDir() {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(fs.Proc, fi.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		if ps, ok := parseStat(string(content)); ok {
+			res[pid] = ps
+		}
+	}
+	return res
+}
+
+// parseStat parses the command and CPU times of /proc/<pid>/stat. The command is enclosed in
+// parentheses and may contain spaces.
+func parseStat(stat string) (procStat, bool) {
+	open, closing := strings.IndexByte(stat, '('), strings.LastIndexByte(stat, ')')
+	if open < 0 || closing < open {
+		return procStat{}, false
+	}
+	// Fields after the command, starting with the state (field 3); utime and stime are
+	// fields 14 and 15.
+	fields := strings.Fields(stat[closing+1:])
+	if len(fields) < 13 {
+		return procStat{}, false
+	}
+	utime, err1 := strconv.ParseUint(fields[11], 10, 64)
+	stime, err2 := strconv.ParseUint(fields[12], 10, 64)
+	if err1 != nil || err2 != nil {
+		return procStat{}, false
+	}
+	return procStat{comm: stat[open+1 : closing], ticks: utime + stime}, true
+}
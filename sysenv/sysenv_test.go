@@ -0,0 +1,112 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sysenv
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeFS creates proc and sys filesystems containing the given files.
+func fakeFS(t *testing.T, files map[string]string) (FS, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "sysenv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return FS{Proc: filepath.Join(dir, "proc"), Sys: filepath.Join(dir, "sys")}, func() { os.RemoveAll(dir) }
+}
+
+func TestRead(t *testing.T) {
+	fs, cleanup := fakeFS(t, map[string]string{
+		"proc/loadavg": "1.50 0.75 0.25 2/300 4242\n",
+		"proc/vmstat":  "nr_free_pages 1000\npswpin 10\npswpout 20\n",
+		"proc/42/stat": "42 (my prog) S 1 42 42 0 -1 4194560 100 0 0 0 500 200 0 0 20 0 1 0 100 0 0\n",
+		"sys/devices/system/cpu/cpu0/cpufreq/scaling_governor":    "performance\n",
+		"sys/devices/system/cpu/cpu1/cpufreq/scaling_governor":    "powersave\n",
+		"sys/devices/system/cpu/cpufreq/policy0/scaling_governor": "performance\n",
+	})
+	defer cleanup()
+
+	r, err := fs.Read(0, 0.5)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	want := &Reading{Time: r.Time, Load1: 1.5, Load5: 0.75, Load15: 0.25, NumCPU: 2, Governor: "mixed"}
+	if diff := cmp.Diff(want, r); diff != "" {
+		t.Errorf("Read [-want +got]:\n%s", diff)
+	}
+
+	ps, ok := parseStat("42 (my prog) S 1 42 42 0 -1 4194560 100 0 0 0 500 200 0 0 20 0 1 0 100 0 0")
+	if !ok || ps.comm != "my prog" || ps.ticks != 700 {
+		t.Errorf("parseStat = %+v, %v, want my prog with 700 ticks", ps, ok)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	zero, one := 0, 1.0
+	o := &Options{MaxLoad: 2, Governor: "performance", MaxSwapRate: &one, MaxBusyProcesses: &zero}
+	if err := o.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	for _, tt := range []struct {
+		name string
+		r    Reading
+		want []string
+	}{
+		{
+			name: "quiet",
+			r:    Reading{Load1: 1, Governor: "performance"},
+		},
+		{
+			name: "noisy",
+			r: Reading{
+				Load1:         3,
+				Governor:      "powersave",
+				SwapIn:        2,
+				BusyProcesses: []Process{{PID: 7, Command: "make", CPU: 0.9}},
+			},
+			want: []string{
+				"load average 3.00 > 2.00",
+				`CPU frequency governor "powersave", want "performance"`,
+				"swapping 2 pages/s > 1",
+				"1 busy processes > 0 (make[7])",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, o.Check(&tt.r)); diff != "" {
+				t.Errorf("Check [-want +got]:\n%s", diff)
+			}
+		})
+	}
+
+	if err := (&Options{Action: "retry"}).Validate(); err == nil {
+		t.Error("Validate with invalid action: want an error, got nil")
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package traces summarizes the garbage collection and scheduling in Go execution traces, as
+// recorded by go test -trace.
+package traces
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Summary summarizes the garbage collection and scheduling in an execution trace.
+type Summary struct {
+	Duration time.Duration `json:"duration"` // from the first to the last event
+	// GCCycles is the number of garbage collection cycles and GCTime their total duration from
+	// the start of the concurrent mark phase to the end of mark termination.
+	GCCycles int           `json:"gc_cycles"`
+	GCTime   time.Duration `json:"gc_time"`
+	// GCPause is the time the world was stopped for garbage collection, STW the time the world
+	// was stopped for any reason.
+	GCPause time.Duration `json:"gc_pause"`
+	STW     time.Duration `json:"stw"`
+	// Goroutines is the number of goroutines created, MaxGoroutines the maximum number of
+	// goroutines existing at the same time.
+	Goroutines    int `json:"goroutines"`
+	MaxGoroutines int `json:"max_goroutines"`
+	// SyscallTime is the total time goroutines spent in system calls.
+	SyscallTime time.Duration `json:"syscall_time"`
+	// SchedLatency is the total time goroutines spent runnable before they were scheduled, over
+	// SchedWaits waits, and MaxSchedLatency the longest wait.
+	SchedLatency    time.Duration `json:"sched_latency"`
+	SchedWaits      int           `json:"sched_waits"`
+	MaxSchedLatency time.Duration `json:"max_sched_latency"`
+}
+
+// Package is the summary of the traces of the benchmarks of a package.
+type Package struct {
+	Pkg string `json:"pkg"`
+	Summary
+}
+
+// Add adds the summary of another trace to s, e.g. of another run of the same package.
+func (s *Summary) Add(o Summary) {
+	s.Duration += o.Duration
+	s.GCCycles += o.GCCycles
+	s.GCTime += o.GCTime
+	s.GCPause += o.GCPause
+	s.STW += o.STW
+	s.Goroutines += o.Goroutines
+	if o.MaxGoroutines > s.MaxGoroutines {
+		s.MaxGoroutines = o.MaxGoroutines
+	}
+	s.SyscallTime += o.SyscallTime
+	s.SchedLatency += o.SchedLatency
+	s.SchedWaits += o.SchedWaits
+	if o.MaxSchedLatency > s.MaxSchedLatency {
+		s.MaxSchedLatency = o.MaxSchedLatency
+	}
+}
+
+// gcMarkPhase is the name of the range covering a garbage collection cycle.
+const gcMarkPhase = "GC concurrent mark phase"
+
+// fields splits an event line into fields separated by spaces, keeping quoted strings intact.
+func fields(line string) []string {
+	var (
+		fs     []string
+		start  = -1
+		quoted bool
+	)
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\' && quoted:
+			i++
+		case c == '"':
+			quoted = !quoted
+			if start < 0 {
+				start = i
+			}
+		case c == ' ' && !quoted:
+			if start >= 0 {
+				fs = append(fs, line[start:i])
+				start = -1
+			}
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	if start >= 0 {
+		fs = append(fs, line[start:])
+	}
+	return fs
+}
+
+// value returns the value of the field key=value in fs, unquoted if necessary.
+func value(fs []string, key string) string {
+	for _, f := range fs {
+		if strings.HasPrefix(f, key+"=") {
+			v := f[len(key)+1:]
+			if u, err := strconv.Unquote(v); err == nil {
+				return u
+			}
+			return v
+		}
+	}
+	return ""
+}
+
+// Parse summarizes the events of a trace printed by go tool trace -d=parsed, which uses the
+// trace parser of the Go toolchain that recorded the trace.
+func Parse(r io.Reader) (*Summary, error) {
+	var (
+		s             Summary
+		first, last   int64 = -1, -1
+		ranges              = make(map[string]int64) // start of active ranges by name and scope
+		runnableSince       = make(map[string]int64)
+		syscallSince        = make(map[string]int64)
+		live          int
+	)
+	scan := bufio.NewScanner(r)
+	scan.Buffer(nil, 1024*1024)
+	for scan.Scan() {
+		line := scan.Text()
+		if !strings.HasPrefix(line, "M=") {
+			// Stack traces of events.
+			continue
+		}
+		fs := fields(line)
+		if len(fs) < 5 {
+			continue
+		}
+		t, err := strconv.ParseInt(value(fs, "Time"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid event %q: %v", line, err)
+		}
+		if first < 0 {
+			first = t
+		}
+		last = t
+
+		switch kind := fs[3]; kind {
+		case "RangeBegin", "RangeActive":
+			name := value(fs, "Name")
+			ranges[name+"\x00"+value(fs, "Scope")] = t
+			if name == gcMarkPhase {
+				s.GCCycles++
+			}
+		case "RangeEnd":
+			name := value(fs, "Name")
+			key := name + "\x00" + value(fs, "Scope")
+			start, ok := ranges[key]
+			if !ok {
+				continue
+			}
+			delete(ranges, key)
+			d := time.Duration(t - start)
+			switch {
+			case name == gcMarkPhase:
+				s.GCTime += d
+			case strings.HasPrefix(name, "stop-the-world"):
+				s.STW += d
+				if strings.Contains(name, "(GC") {
+					s.GCPause += d
+				}
+			}
+		case "StateTransition":
+			g := value(fs, "GoID")
+			if g == "" {
+				// Proc state transition.
+				continue
+			}
+			var from, to string
+			for _, f := range fs {
+				if i := strings.Index(f, "->"); i > 0 && !strings.Contains(f, "=") {
+					from, to = f[:i], f[i+2:]
+				}
+			}
+			switch {
+			case from == "NotExist" && to != "NotExist":
+				s.Goroutines++
+				live++
+			case from == "Undetermined" && to != "NotExist":
+				// Existing when the trace started.
+				live++
+			case to == "NotExist" && from != "NotExist":
+				live--
+			}
+			if live > s.MaxGoroutines {
+				s.MaxGoroutines = live
+			}
+			if from == "Runnable" && to == "Running" {
+				if since, ok := runnableSince[g]; ok {
+					d := time.Duration(t - since)
+					s.SchedLatency += d
+					s.SchedWaits++
+					if d > s.MaxSchedLatency {
+						s.MaxSchedLatency = d
+					}
+				}
+			}
+			if from == "Syscall" {
+				if since, ok := syscallSince[g]; ok {
+					s.SyscallTime += time.Duration(t - since)
+				}
+			}
+			delete(runnableSince, g)
+			delete(syscallSince, g)
+			switch to {
+			case "Runnable":
+				runnableSince[g] = t
+			case "Syscall":
+				syscallSince[g] = t
+			}
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+	if first < 0 {
+		return nil, fmt.Errorf("no events in trace")
+	}
+	s.Duration = time.Duration(last - first)
+	return &s, nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 Isovalent, Inc
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package traces
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testTrace is an excerpt of the output of go tool trace -d=parsed. Times are in nanoseconds.
+const testTrace = `M=-1 P=-1 G=-1 Sync Time=1000000 N=1 Trace=1000000 Mono=1000000 Wall=2026-10-18T19:14:26.648494998Z
+M=1 P=0 G=-1 StateTransition Time=1000000 GoID=1 Undetermined->Running Reason=""
+M=1 P=0 G=1 StateTransition Time=1001000 GoID=2 NotExist->Runnable Reason=""
+Stack=
+	main.main @ 0x5435fa
+		_testmain.go:48
+
+M=1 P=0 G=1 StateTransition Time=1003000 GoID=2 Runnable->Running Reason=""
+M=1 P=0 G=2 RangeBegin Time=1004000 Name="GC concurrent mark phase" Scope=None
+M=1 P=0 G=2 RangeBegin Time=1004000 Name="stop-the-world (GC sweep termination)" Scope=Goroutine(2)
+M=1 P=0 G=2 RangeEnd Time=1004100 Name="stop-the-world (GC sweep termination)" Scope=Goroutine(2) Attributes=[]
+M=1 P=0 G=2 StateTransition Time=1005000 GoID=2 Running->Syscall Reason=""
+M=1 P=0 G=2 StateTransition Time=1007000 GoID=2 Syscall->Running Reason=""
+M=1 P=0 G=2 RangeBegin Time=1008000 Name="stop-the-world (read mem stats)" Scope=Goroutine(2)
+M=1 P=0 G=2 RangeEnd Time=1008050 Name="stop-the-world (read mem stats)" Scope=Goroutine(2) Attributes=[]
+M=1 P=0 G=2 RangeEnd Time=1009000 Name="GC concurrent mark phase" Scope=None Attributes=[]
+M=1 P=0 G=2 StateTransition Time=1009500 GoID=2 Running->Runnable Reason="preempted"
+M=1 P=0 G=2 StateTransition Time=1010000 GoID=2 Runnable->Running Reason=""
+M=1 P=0 G=2 StateTransition Time=1011000 GoID=2 Running->NotExist Reason=""
+M=1 P=0 G=1 Metric Time=1012000 Name="/gc/heap/goal:bytes" Value=Value{Uint64(4194304)}
+`
+
+func TestParse(t *testing.T) {
+	s, err := Parse(strings.NewReader(testTrace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Summary{
+		Duration:        12 * time.Microsecond,
+		GCCycles:        1,
+		GCTime:          5 * time.Microsecond,
+		GCPause:         100 * time.Nanosecond,
+		STW:             150 * time.Nanosecond,
+		Goroutines:      1,
+		MaxGoroutines:   2,
+		SyscallTime:     2 * time.Microsecond,
+		SchedLatency:    2500 * time.Nanosecond,
+		SchedWaits:      2,
+		MaxSchedLatency: 2 * time.Microsecond,
+	}
+	if diff := cmp.Diff(want, s); diff != "" {
+		t.Errorf("Parse() mismatch (-want +got):\n%s", diff)
+	}
+
+	s.Add(*want)
+	if s.GCCycles != 2 || s.MaxGoroutines != 2 || s.STW != 300*time.Nanosecond {
+		t.Errorf("Add() = %+v", s)
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	if _, err := Parse(strings.NewReader("")); err == nil {
+		t.Error("Parse() succeeded on an empty trace")
+	}
+}